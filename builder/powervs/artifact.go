@@ -1,5 +1,72 @@
 package powervs
 
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
+)
+
+// CaptureCOSObjectSuffix is appended to the capture name by PowerVS to name the image it exports to
+// Cloud Object Storage.
+const CaptureCOSObjectSuffix = ".ova.gz"
+
+// RegistryProviderName is the provider of the images in the HCP Packer registry.
+const RegistryProviderName = "ibm-powervs"
+
+// registryLabels are the artifact state data recorded as labels of the image in the HCP Packer
+// registry, when they are set.
+var registryLabels = []string{
+	"image_name",
+	"zone",
+	"service_instance_id",
+	"os_type",
+	"storage_type",
+	"capture_destination",
+	"source_image_id",
+	"cos_bucket",
+	"cos_region",
+	"cos_object",
+}
+
+// ArtifactStateKeys are the keys of the state data of the artifact. Post-processors receive the artifact
+// over RPC, where its state data can only be read key by key.
+var ArtifactStateKeys = []string{
+	"generated_data",
+	"run_tags",
+	"image_tags",
+	"zone",
+	"service_instance_id",
+	"capture_destination",
+	"fingerprint",
+	"unchanged",
+	"os_type",
+	"source_image_id",
+	"image_id",
+	"image_name",
+	"storage_type",
+	"cos_bucket",
+	"cos_region",
+	"cos_object",
+	"imported_images",
+	"target_images",
+}
+
+// CopyArtifact returns an artifact with the state data of source, an artifact of the builder, for the
+// post-processors returning an updated artifact.
+func CopyArtifact(source packersdk.Artifact) *Artifact {
+	stateData := map[string]interface{}{}
+	for _, key := range ArtifactStateKeys {
+		if value := source.State(key); value != nil {
+			stateData[key] = value
+		}
+	}
+	return &Artifact{StateData: stateData}
+}
+
 // packersdk.Artifact implementation
 type Artifact struct {
 	// StateData should store data such as GeneratedData
@@ -15,18 +82,142 @@ func (a *Artifact) Files() []string {
 	return []string{}
 }
 
-func (*Artifact) Id() string {
+// Id returns the ID of the captured image, or the bucket and object of the image exported to Cloud
+// Object Storage when it is not in the image catalog.
+func (a *Artifact) Id() string {
+	if id := a.stateString("image_id"); id != "" {
+		return id
+	}
+	if object := a.stateString("cos_object"); object != "" {
+		return a.stateString("cos_bucket") + "/" + object
+	}
 	return ""
 }
 
 func (a *Artifact) String() string {
-	return ""
+	var parts []string
+	if id := a.stateString("image_id"); id != "" {
+		parts = append(parts, fmt.Sprintf("image %s (%s) in the image catalog of %s",
+			a.stateString("image_name"), id, a.stateString("service_instance_id")))
+	}
+	if object := a.stateString("cos_object"); object != "" {
+		parts = append(parts, fmt.Sprintf("object %s in the bucket %s (%s)",
+			object, a.stateString("cos_bucket"), a.stateString("cos_region")))
+	}
+	for _, images := range []struct{ key, description string }{
+		{"target_images", "images built in the other targets"},
+		{"imported_images", "imported images"},
+	} {
+		if list := a.listImages(images.key); list != "" {
+			parts = append(parts, images.description+" "+list)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "PowerVS " + strings.Join(parts, " and ")
 }
 
 func (a *Artifact) State(name string) interface{} {
+	if name == registryimage.ArtifactStateURI {
+		return a.registryImages()
+	}
 	return a.StateData[name]
 }
 
 func (a *Artifact) Destroy() error {
 	return nil
 }
+
+func (a *Artifact) stateString(name string) string {
+	s, _ := a.StateData[name].(string)
+	return s
+}
+
+// workspaceImages returns the images of other workspaces in the state data key, by workspace as
+// `<zone>/<service instance ID>`: the images built in the other targets in `target_images`, the images
+// imported by the powervs-import post-processor in `imported_images`. The workspace of the artifact
+// itself is left out. Over RPC the map comes back with interface keys and values.
+func (a *Artifact) workspaceImages(key string) map[string]string {
+	images := map[string]string{}
+	switch m := a.StateData[key].(type) {
+	case map[string]string:
+		maps.Copy(images, m)
+	case map[interface{}]interface{}:
+		for workspace, id := range m {
+			workspace, _ := workspace.(string)
+			images[workspace], _ = id.(string)
+		}
+	case map[string]interface{}:
+		for workspace, id := range m {
+			images[workspace], _ = id.(string)
+		}
+	}
+	delete(images, a.stateString("zone")+"/"+a.stateString("service_instance_id"))
+	return images
+}
+
+// listImages lists the images of other workspaces in the state data key, see workspaceImages.
+func (a *Artifact) listImages(key string) string {
+	images := a.workspaceImages(key)
+	var list []string
+	for _, workspace := range slices.Sorted(maps.Keys(images)) {
+		list = append(list, fmt.Sprintf("%s (%s)", images[workspace], workspace))
+	}
+	return strings.Join(list, ", ")
+}
+
+// registryImages returns the metadata of the image for the HCP Packer registry. The region of the image
+// is its workspace, as `<zone>/<service instance ID>`: images are only usable in their workspace. The
+// images built in the other targets and imported into other workspaces are listed after it.
+func (a *Artifact) registryImages() []*registryimage.Image {
+	id := a.Id()
+	if id == "" {
+		return nil
+	}
+	labels := map[string]string{}
+	for _, key := range registryLabels {
+		if value := a.stateString(key); value != "" {
+			labels[key] = value
+		}
+	}
+	image := &registryimage.Image{
+		ImageID:        id,
+		ProviderName:   RegistryProviderName,
+		ProviderRegion: a.stateString("zone") + "/" + a.stateString("service_instance_id"),
+		SourceImageID:  a.stateString("source_image_id"),
+		Labels:         labels,
+	}
+	images := []*registryimage.Image{image}
+	// The images of the other workspaces share the name and OS of the image. The imported images come
+	// from the same source image, the other targets imported their own, unknown to the artifact.
+	for _, other := range []struct {
+		key           string
+		sourceImageID string
+	}{
+		{"target_images", ""},
+		{"imported_images", image.SourceImageID},
+	} {
+		workspaceImages := a.workspaceImages(other.key)
+		for _, workspace := range slices.Sorted(maps.Keys(workspaceImages)) {
+			zone, serviceInstanceID, _ := strings.Cut(workspace, "/")
+			otherLabels := map[string]string{"zone": zone, "service_instance_id": serviceInstanceID}
+			for _, key := range []string{"image_name", "os_type"} {
+				if value := labels[key]; value != "" {
+					otherLabels[key] = value
+				}
+			}
+			if other.sourceImageID != "" {
+				otherLabels["source_image_id"] = other.sourceImageID
+			}
+			images = append(images, &registryimage.Image{
+				ImageID:        workspaceImages[workspace],
+				ProviderName:   RegistryProviderName,
+				ProviderRegion: workspace,
+				SourceImageID:  other.sourceImageID,
+				Labels:         otherLabels,
+			})
+		}
+	}
+	return images
+}
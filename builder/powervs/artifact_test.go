@@ -0,0 +1,111 @@
+package powervs
+
+import (
+	"reflect"
+	"testing"
+
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
+)
+
+func TestArtifact_RegistryImages(t *testing.T) {
+	artifact := &Artifact{StateData: map[string]interface{}{
+		"zone":                "dal10",
+		"service_instance_id": "workspace",
+		"capture_destination": CaptureDestinationImageCatalog,
+		"os_type":             OSTypeLinux,
+		"source_image_id":     "source",
+		"image_id":            "captured",
+		"image_name":          "rhel-9-golden",
+		"storage_type":        "tier1",
+	}}
+
+	images, ok := artifact.State(registryimage.ArtifactStateURI).([]*registryimage.Image)
+	if !ok || len(images) != 1 {
+		t.Fatalf("registry images = %v, want one image", artifact.State(registryimage.ArtifactStateURI))
+	}
+	image := images[0]
+	if err := image.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := &registryimage.Image{
+		ImageID:        "captured",
+		ProviderName:   RegistryProviderName,
+		ProviderRegion: "dal10/workspace",
+		SourceImageID:  "source",
+		Labels: map[string]string{
+			"zone":                "dal10",
+			"service_instance_id": "workspace",
+			"capture_destination": CaptureDestinationImageCatalog,
+			"os_type":             OSTypeLinux,
+			"source_image_id":     "source",
+			"image_name":          "rhel-9-golden",
+			"storage_type":        "tier1",
+		},
+	}
+	if !reflect.DeepEqual(image, want) {
+		t.Errorf("registry image = %+v, want %+v", image, want)
+	}
+}
+
+func TestArtifact_RegistryImages_CloudStorage(t *testing.T) {
+	artifact := &Artifact{StateData: map[string]interface{}{
+		"zone":                "dal10",
+		"service_instance_id": "workspace",
+		"capture_destination": CaptureDestinationCloudStorage,
+		"cos_bucket":          "images",
+		"cos_region":          "us-south",
+		"cos_object":          "rhel-9-golden.ova.gz",
+	}}
+
+	images := artifact.State(registryimage.ArtifactStateURI).([]*registryimage.Image)
+	if len(images) != 1 || images[0].ImageID != "images/rhel-9-golden.ova.gz" || images[0].Labels["cos_region"] != "us-south" {
+		t.Errorf("registry images = %+v, want the exported object", images)
+	}
+}
+
+func TestArtifact_ImportedImages(t *testing.T) {
+	artifact := &Artifact{StateData: map[string]interface{}{
+		"zone":                "dal10",
+		"service_instance_id": "workspace",
+		"image_id":            "captured",
+		"image_name":          "rhel-9-golden",
+		// As received over RPC.
+		"imported_images": map[interface{}]interface{}{"wdc06/other": "imported-wdc", "syd05/third": "imported-syd"},
+	}}
+
+	images := artifact.State(registryimage.ArtifactStateURI).([]*registryimage.Image)
+	var regions []string
+	for _, image := range images {
+		if err := image.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		regions = append(regions, image.ProviderRegion+"="+image.ImageID)
+	}
+	if want := []string{"dal10/workspace=captured", "syd05/third=imported-syd", "wdc06/other=imported-wdc"}; !reflect.DeepEqual(regions, want) {
+		t.Errorf("registry images = %v, want %v", regions, want)
+	}
+	if labels := images[2].Labels; labels["zone"] != "wdc06" || labels["service_instance_id"] != "other" || labels["image_name"] != "rhel-9-golden" {
+		t.Errorf("labels = %v, want those of the imported image", labels)
+	}
+	if got, want := artifact.String(), "PowerVS image rhel-9-golden (captured) in the image catalog of workspace and imported images imported-syd (syd05/third), imported-wdc (wdc06/other)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestCopyArtifact(t *testing.T) {
+	source := &Artifact{StateData: map[string]interface{}{
+		"zone":     "dal10",
+		"image_id": "captured",
+		"unknown":  "dropped",
+	}}
+	artifact := CopyArtifact(source)
+	artifact.StateData["cos_object"] = "captured.ova.gz"
+
+	want := map[string]interface{}{"zone": "dal10", "image_id": "captured", "cos_object": "captured.ova.gz"}
+	if !reflect.DeepEqual(artifact.StateData, want) {
+		t.Errorf("state data = %v, want %v", artifact.StateData, want)
+	}
+	if _, ok := source.StateData["cos_object"]; ok {
+		t.Error("source artifact modified")
+	}
+}
@@ -1,12 +1,16 @@
 //go:generate packer-sdc struct-markdown
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,Target
 
 package powervs
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"sync"
 	"time"
 
+	"github.com/IBM-Cloud/power-go-client/power/models"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
@@ -20,18 +24,35 @@ import (
 
 const BuilderId = "packer.builder.powervs"
 
+// generatedDataKeys are the variables the builder publishes to the provisioners and post-processors,
+// as `build.<name>` in templates.
+var generatedDataKeys = []string{
+	"InstanceID",
+	"SourceImageID",
+	"NetworkID",
+	"InstanceIP",
+	"Zone",
+}
+
 type Config struct {
 	common.PackerConfig        `mapstructure:",squash"`
 	powervscommon.AccessConfig `mapstructure:",squash"`
 	powervscommon.ImageConfig  `mapstructure:",squash"`
 	powervscommon.RunConfig    `mapstructure:",squash"`
 
+	// The workspaces the image is built in, concurrently, instead of the workspace of
+	// `service_instance_id` or `workspace_name`. Each target runs the whole build, from the import of
+	// the source image to the capture, with its own resources and cleanup. The artifact is the one of
+	// the first target, with the images of every target in `target_images`.
+	Targets []Target `mapstructure:"targets" required:"false"`
+
 	ctx interpolate.Context
 }
 
 type Builder struct {
 	config Config
-	runner multistep.Runner
+	// targets are the configurations of the builds in each of the targets.
+	targets []*Config
 }
 
 func (b *Builder) ConfigSpec() hcldec.ObjectSpec { return b.config.FlatMapstructure().HCL2Spec() }
@@ -47,48 +68,128 @@ func (b *Builder) Prepare(raws ...interface{}) (generatedVars []string, warnings
 		return nil, nil, err
 	}
 	var errs *packer.MultiError
+	if len(b.config.Targets) == 0 {
+		errs = packer.MultiErrorAppend(errs, b.config.AccessConfig.Prepare()...)
+	}
 	errs = packer.MultiErrorAppend(errs, b.config.RunConfig.Prepare(&b.config.ctx)...)
 
+	switch b.config.Capture.Destination {
+	case CaptureDestinationImageCatalog, CaptureDestinationBoth:
+	default:
+		catalogOptions := []struct {
+			name string
+			set  bool
+		}{
+			{"skip_if_unchanged", b.config.SkipIfUnchanged},
+			{"force_deregister", b.config.Capture.ForceDeregister},
+			{"keep_last_n", b.config.Capture.KeepLastN != 0},
+		}
+		for _, option := range catalogOptions {
+			if option.set {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("%s requires the capture destination %q or %q",
+					option.name, CaptureDestinationImageCatalog, CaptureDestinationBoth))
+			}
+		}
+	}
+
+	if b.config.CleanupJournal == "" {
+		// Concurrent builds of the same instance name each get their own journal.
+		name := fmt.Sprintf("%s-%d.journal.json", b.config.InstanceName, os.Getpid())
+		if b.config.PackerBuildName != "" {
+			name = b.config.PackerBuildName + "-" + name
+		}
+		b.config.CleanupJournal, err = packer.CachePath("powervs", name)
+		if err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("failed to get the cleanup_journal path: %w", err))
+		}
+	}
+
+	b.targets = nil
+	if len(b.config.Targets) != 0 {
+		var targetErrs []error
+		b.targets, targetErrs = b.prepareTargets()
+		errs = packer.MultiErrorAppend(errs, targetErrs...)
+	}
+
 	if errs != nil && len(errs.Errors) > 0 {
 		return nil, nil, errs
 	}
 
+	if err := b.config.ResolveWorkspace(context.Background()); err != nil {
+		return nil, nil, err
+	}
+	if err := resolveTargets(context.Background(), b.targets); err != nil {
+		return nil, nil, err
+	}
+
 	packer.LogSecretFilter.Set(b.config.APIKey)
+	for _, target := range b.targets {
+		packer.LogSecretFilter.Set(target.APIKey)
+	}
+	if b.config.Source.COS != nil && b.config.Source.COS.SecretKey != "" {
+		packer.LogSecretFilter.Set(b.config.Source.COS.AccessKey, b.config.Source.COS.SecretKey)
+	}
 	if b.config.Capture.COS != nil {
 		packer.LogSecretFilter.Set(b.config.Capture.COS.AccessKey)
 		packer.LogSecretFilter.Set(b.config.Capture.COS.SecretKey)
 	}
 
-	return []string{}, nil, nil
+	return generatedDataKeys, nil, nil
 }
 
 func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (packer.Artifact, error) {
-	session, err := b.config.Session()
+	if len(b.targets) != 0 {
+		return b.runTargets(ctx, ui, hook)
+	}
+	artifact, err := b.run(ctx, &b.config, ui, hook, nil)
+	if err != nil {
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// run runs the build in the workspace of config. The provisioning step holds the provisioning lock
+// when it is set.
+func (b *Builder) run(ctx context.Context, config *Config, ui packer.Ui, hook packer.Hook, provisioning *sync.Mutex) (*Artifact, error) {
+	if err := config.CheckWorkspaceZone(ctx); err != nil {
+		return nil, err
+	}
+	session, err := config.Session()
+	if err != nil {
+		return nil, err
+	}
+
+	imageClient, err := config.ImageClient(ctx, config.ServiceInstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	jobClient, err := config.JobClient(ctx, config.ServiceInstanceID)
 	if err != nil {
 		return nil, err
 	}
 
-	imageClient, err := b.config.ImageClient(ctx, b.config.ServiceInstanceID)
+	instanceClient, err := config.InstanceClient(ctx, config.ServiceInstanceID)
 	if err != nil {
 		return nil, err
 	}
 
-	jobClient, err := b.config.JobClient(ctx, b.config.ServiceInstanceID)
+	networkClient, err := config.NetworkClient(ctx, config.ServiceInstanceID)
 	if err != nil {
 		return nil, err
 	}
 
-	instanceClient, err := b.config.InstanceClient(ctx, b.config.ServiceInstanceID)
+	dhcpClient, err := config.DHCPClient(ctx, config.ServiceInstanceID)
 	if err != nil {
 		return nil, err
 	}
 
-	networkClient, err := b.config.NetworkClient(ctx, b.config.ServiceInstanceID)
+	taggingClient, err := config.TaggingClient()
 	if err != nil {
 		return nil, err
 	}
 
-	dhcpClient, err := b.config.DHCPClient(ctx, b.config.ServiceInstanceID)
+	searchClient, err := config.SearchClient()
 	if err != nil {
 		return nil, err
 	}
@@ -96,62 +197,190 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 	var steps []multistep.Step
 
 	// Parse cleanup timeout
-	cleanupTimeout, _ := time.ParseDuration(b.config.CleanupTimeout)
+	cleanupTimeout, _ := time.ParseDuration(config.CleanupTimeout)
 	if cleanupTimeout == 0 {
 		cleanupTimeout = 10 * time.Minute // Default
 	}
 
+	shutdownTimeout, _ := time.ParseDuration(config.ShutdownTimeout)
+
+	runTags := powervscommon.TagList(config.RunTags)
+
+	if config.SkipIfUnchanged {
+		steps = append(steps, &StepCheckUnchanged{
+			Source:              config.Source,
+			UserData:            config.UserData,
+			ContentHash:         config.ContentHash,
+			UsePrivateEndpoints: config.UsePrivateEndpoints,
+		})
+	}
+
 	steps = append(steps,
 		&StepImageBaseImage{
-			Source: b.config.Source,
+			Source:  config.Source,
+			RunTags: runTags,
 		},
 		&StepCreateNetwork{
-			SubnetIDs:   b.config.SubnetIDs,
-			DHCPNetwork: b.config.DHCPNetwork,
+			SubnetIDs:   config.SubnetIDs,
+			DHCPNetwork: config.DHCPNetwork,
+			RunTags:     runTags,
 		},
 		&StepCreateInstance{
-			InstanceName:   b.config.InstanceName,
-			KeyPairName:    b.config.KeyPairName,
-			UserData:       b.config.UserData,
-			CleanupTimeout: cleanupTimeout,
+			InstanceName:              config.InstanceName,
+			KeyPairName:               config.KeyPairName,
+			UserData:                  config.UserData,
+			CleanupTimeout:            cleanupTimeout,
+			PlacementGroup:            config.PlacementGroup,
+			PinPolicy:                 config.PinPolicy,
+			AffinityPolicy:            config.AffinityPolicy,
+			AffinityInstance:          config.AffinityInstance,
+			HostID:                    config.HostID,
+			DeploymentType:            config.DeploymentType,
+			LicenseRepositoryCapacity: config.LicenseRepositoryCapacity,
+			RunTags:                   runTags,
 		},
 		&communicator.StepConnect{
-			Config:    &b.config.RunConfig.Comm,
-			Host:      powervscommon.SSHHost(),
+			Config:    &config.RunConfig.Comm,
+			Host:      instanceIP(powervscommon.SSHHost()),
 			SSHPort:   powervscommon.Port(),
-			SSHConfig: b.config.RunConfig.Comm.SSHConfigFunc(),
+			SSHConfig: config.RunConfig.Comm.SSHConfigFunc(),
+		},
+	)
+	if provisioning != nil {
+		steps = append(steps, &stepSerialized{Step: new(commonsteps.StepProvision), mu: provisioning})
+	} else {
+		steps = append(steps, new(commonsteps.StepProvision))
+	}
+
+	if config.Generalize {
+		steps = append(steps, &StepGeneralize{
+			Steps:   config.GeneralizeSteps,
+			UseSudo: config.Comm.SSHUsername != "root",
+		})
+	}
+
+	steps = append(steps,
+		&StepPrepare{
+			ShutdownCommand:  config.ShutdownCommand,
+			ShutdownBehavior: config.ShutdownBehavior,
+			ShutdownTimeout:  shutdownTimeout,
+			UseSudo:          config.Comm.SSHUsername != "root",
 		},
-		new(commonsteps.StepProvision),
-		&StepPrepare{},
 		&StepCaptureInstance{
-			Capture: b.config.RunConfig.Capture,
+			Capture:   config.RunConfig.Capture,
+			ImageTags: powervscommon.TagList(config.ImageTags),
 		},
 	)
+	if config.Capture.ForceDeregister || config.Capture.KeepLastN > 0 {
+		steps = append(steps, &StepPruneImages{
+			Prefix:          config.Capture.Name,
+			NameSuffix:      config.Capture.NameSuffix,
+			ForceDeregister: config.Capture.ForceDeregister,
+			KeepLastN:       config.Capture.KeepLastN,
+		})
+	}
 
 	// Setup the state bag and initial state for the steps
 	state := new(multistep.BasicStateBag)
 	state.Put("hook", hook)
 	state.Put("ui", ui)
 	state.Put("powervsSession", session)
-	state.Put("imageClient", imageClient)
-	state.Put("jobClient", jobClient)
-	state.Put("instanceClient", instanceClient)
-	state.Put("networkClient", networkClient)
-	state.Put("dhcpClient", dhcpClient)
+	retrier := config.Retrier(ctx)
+	state.Put("imageClient", retrier.ImageClient(imageClient))
+	state.Put("jobClient", retrier.JobClient(jobClient))
+	state.Put("instanceClient", retrier.InstanceClient(instanceClient))
+	state.Put("networkClient", retrier.NetworkClient(networkClient))
+	state.Put("dhcpClient", retrier.DHCPClient(dhcpClient))
+	state.Put("taggingClient", taggingClient)
+	state.Put("searchClient", searchClient)
+	journal, err := powervscommon.OpenJournal(config.CleanupJournal, &config.AccessConfig)
+	if err != nil {
+		return nil, err
+	}
+	if left := len(journal.Resources); left != 0 {
+		ui.Error(fmt.Sprintf("The cleanup journal %s holds %d resources of an earlier build, they are kept in it. "+
+			"Delete them with: packer-plugin-powervs cleanup --journal %s --force", journal.Path(), left, journal.Path()))
+	}
+	state.Put("journal", journal)
+	generatedData(state).Put("Zone", config.Zone)
+
+	events, err := powervscommon.OpenEventLog(config.EventLog, config.PackerBuildName, &config.AccessConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer events.Close()
+	if events != nil {
+		state.Put("eventLog", events)
+		steps = withEvents(steps)
+	}
+	events.Emit(powervscommon.Event{Type: powervscommon.EventBuildStarted})
 
 	// Run!
-	b.runner = commonsteps.NewRunner(steps, b.config.PackerConfig, ui)
-	b.runner.Run(ctx, state)
+	runner := commonsteps.NewRunner(steps, config.PackerConfig, ui)
+	runner.Run(ctx, state)
+
+	finished := powervscommon.Event{Type: powervscommon.EventBuildFinished}
+	if err, ok := state.GetOk("error"); ok {
+		finished.Halted = true
+		finished.Error = err.(error).Error()
+	}
+	events.Emit(finished)
+
+	if left, err := journal.Finish(); err != nil {
+		ui.Error(fmt.Sprintf("Failed to remove the cleanup journal %s: %v", journal.Path(), err))
+	} else if left != 0 {
+		ui.Error(fmt.Sprintf("%d resources were not deleted, they are recorded in %s. "+
+			"Delete them with: packer-plugin-powervs cleanup --journal %s --force", left, journal.Path(), journal.Path()))
+	}
 
 	// If there was an error, return that
 	if err, ok := state.GetOk("error"); ok {
 		return nil, err.(error)
 	}
 
+	captureDestination := config.Capture.Destination
+	if captureDestination == "" {
+		captureDestination = CaptureDestinationDefault
+	}
 	artifact := &Artifact{
 		// Add the builder generated data to the artifact StateData so that post-processors
 		// can access them.
-		StateData: map[string]interface{}{"generated_data": state.Get("generated_data")},
+		StateData: map[string]interface{}{
+			"generated_data":      state.Get("generated_data"),
+			"run_tags":            config.RunTags,
+			"image_tags":          config.ImageTags,
+			"zone":                config.Zone,
+			"service_instance_id": config.ServiceInstanceID,
+			"capture_destination": captureDestination,
+		},
+	}
+	if fingerprint, ok := state.GetOk("fingerprint"); ok {
+		artifact.StateData["fingerprint"] = fingerprint
+		_, unchanged := state.GetOk("unchanged")
+		artifact.StateData["unchanged"] = unchanged
+	}
+	if osType, ok := state.GetOk("os_type"); ok {
+		artifact.StateData["os_type"] = osType
+	}
+	if image, ok := state.GetOk("source_image"); ok {
+		artifact.StateData["source_image_id"] = *image.(*models.ImageReference).ImageID
+	}
+	if image, ok := state.GetOk("captured_image"); ok {
+		image := image.(*models.ImageReference)
+		artifact.StateData["image_id"] = *image.ImageID
+		artifact.StateData["image_name"] = *image.Name
+		if image.StorageType != nil {
+			artifact.StateData["storage_type"] = *image.StorageType
+		}
+	}
+	if captureDestination != CaptureDestinationImageCatalog && config.Capture.COS != nil {
+		artifact.StateData["cos_bucket"] = config.Capture.COS.Bucket
+		artifact.StateData["cos_region"] = config.Capture.COS.Region
+		captureName := config.Capture.Name
+		if name, ok := state.GetOk("capture_name"); ok {
+			captureName = name.(string)
+		}
+		artifact.StateData["cos_object"] = captureName + CaptureCOSObjectSuffix
 	}
 	return artifact, nil
 }
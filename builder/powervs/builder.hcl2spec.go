@@ -19,12 +19,23 @@ type FlatConfig struct {
 	PackerOnError             *string             `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
 	PackerUserVars            map[string]string   `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
 	PackerSensitiveVars       []string            `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
-	APIKey                    *string             `mapstructure:"api_key" required:"true" cty:"api_key" hcl:"api_key"`
+	AuthMethod                *string             `mapstructure:"auth_method" required:"false" cty:"auth_method" hcl:"auth_method"`
+	APIKey                    *string             `mapstructure:"api_key" required:"false" cty:"api_key" hcl:"api_key"`
+	CredentialsFile           *string             `mapstructure:"credentials_file" required:"false" cty:"credentials_file" hcl:"credentials_file"`
+	TrustedProfileID          *string             `mapstructure:"trusted_profile_id" required:"false" cty:"trusted_profile_id" hcl:"trusted_profile_id"`
+	TrustedProfileName        *string             `mapstructure:"trusted_profile_name" required:"false" cty:"trusted_profile_name" hcl:"trusted_profile_name"`
+	CRTokenFile               *string             `mapstructure:"cr_token_file" required:"false" cty:"cr_token_file" hcl:"cr_token_file"`
 	Region                    *string             `mapstructure:"region" required:"false" cty:"region" hcl:"region"`
-	Zone                      *string             `mapstructure:"zone" required:"true" cty:"zone" hcl:"zone"`
+	Zone                      *string             `mapstructure:"zone" required:"false" cty:"zone" hcl:"zone"`
 	AccountID                 *string             `mapstructure:"account_id" required:"false" cty:"account_id" hcl:"account_id"`
 	Debug                     *bool               `mapstructure:"debug" required:"false" cty:"debug" hcl:"debug"`
-	ServiceInstanceID         *string             `mapstructure:"service_instance_id" required:"true" cty:"service_instance_id" hcl:"service_instance_id"`
+	ServiceInstanceID         *string             `mapstructure:"service_instance_id" required:"false" cty:"service_instance_id" hcl:"service_instance_id"`
+	WorkspaceName             *string             `mapstructure:"workspace_name" required:"false" cty:"workspace_name" hcl:"workspace_name"`
+	Endpoint                  *string             `mapstructure:"endpoint" required:"false" cty:"endpoint" hcl:"endpoint"`
+	IAMURL                    *string             `mapstructure:"iam_url" required:"false" cty:"iam_url" hcl:"iam_url"`
+	PowerVSEndpoint           *string             `mapstructure:"powervs_endpoint" required:"false" cty:"powervs_endpoint" hcl:"powervs_endpoint"`
+	UsePrivateEndpoints       *bool               `mapstructure:"use_private_endpoints" required:"false" cty:"use_private_endpoints" hcl:"use_private_endpoints"`
+	MaxRetries                *int                `mapstructure:"max_retries" required:"false" cty:"max_retries" hcl:"max_retries"`
 	InstanceName              *string             `mapstructure:"instance_name" required:"true" cty:"instance_name" hcl:"instance_name"`
 	KeyPairName               *string             `mapstructure:"key_pair_name" required:"true" cty:"key_pair_name" hcl:"key_pair_name"`
 	SubnetIDs                 []string            `mapstructure:"subnet_ids" required:"false" cty:"subnet_ids" hcl:"subnet_ids"`
@@ -33,6 +44,24 @@ type FlatConfig struct {
 	Source                    *common.FlatSource  `mapstructure:"source" required:"true" cty:"source" hcl:"source"`
 	Capture                   *common.FlatCapture `mapstructure:"capture" required:"true" cty:"capture" hcl:"capture"`
 	CleanupTimeout            *string             `mapstructure:"cleanup_timeout" required:"false" cty:"cleanup_timeout" hcl:"cleanup_timeout"`
+	CleanupJournal            *string             `mapstructure:"cleanup_journal" required:"false" cty:"cleanup_journal" hcl:"cleanup_journal"`
+	EventLog                  *string             `mapstructure:"event_log" required:"false" cty:"event_log" hcl:"event_log"`
+	ShutdownCommand           *string             `mapstructure:"shutdown_command" required:"false" cty:"shutdown_command" hcl:"shutdown_command"`
+	ShutdownBehavior          *string             `mapstructure:"shutdown_behavior" required:"false" cty:"shutdown_behavior" hcl:"shutdown_behavior"`
+	ShutdownTimeout           *string             `mapstructure:"shutdown_timeout" required:"false" cty:"shutdown_timeout" hcl:"shutdown_timeout"`
+	PlacementGroup            *string             `mapstructure:"placement_group" required:"false" cty:"placement_group" hcl:"placement_group"`
+	PinPolicy                 *string             `mapstructure:"pin_policy" required:"false" cty:"pin_policy" hcl:"pin_policy"`
+	AffinityPolicy            *string             `mapstructure:"affinity_policy" required:"false" cty:"affinity_policy" hcl:"affinity_policy"`
+	AffinityInstance          *string             `mapstructure:"affinity_instance" required:"false" cty:"affinity_instance" hcl:"affinity_instance"`
+	HostID                    *string             `mapstructure:"host_id" required:"false" cty:"host_id" hcl:"host_id"`
+	DeploymentType            *string             `mapstructure:"deployment_type" required:"false" cty:"deployment_type" hcl:"deployment_type"`
+	LicenseRepositoryCapacity *int64              `mapstructure:"license_repository_capacity" required:"false" cty:"license_repository_capacity" hcl:"license_repository_capacity"`
+	RunTags                   map[string]string   `mapstructure:"run_tags" required:"false" cty:"run_tags" hcl:"run_tags"`
+	ImageTags                 map[string]string   `mapstructure:"image_tags" required:"false" cty:"image_tags" hcl:"image_tags"`
+	Generalize                *bool               `mapstructure:"generalize" required:"false" cty:"generalize" hcl:"generalize"`
+	GeneralizeSteps           []string            `mapstructure:"generalize_steps" required:"false" cty:"generalize_steps" hcl:"generalize_steps"`
+	SkipIfUnchanged           *bool               `mapstructure:"skip_if_unchanged" required:"false" cty:"skip_if_unchanged" hcl:"skip_if_unchanged"`
+	ContentHash               *string             `mapstructure:"content_hash" required:"false" cty:"content_hash" hcl:"content_hash"`
 	Type                      *string             `mapstructure:"communicator" cty:"communicator" hcl:"communicator"`
 	PauseBeforeConnect        *string             `mapstructure:"pause_before_connecting" cty:"pause_before_connecting" hcl:"pause_before_connecting"`
 	SSHHost                   *string             `mapstructure:"ssh_host" cty:"ssh_host" hcl:"ssh_host"`
@@ -82,6 +111,7 @@ type FlatConfig struct {
 	WinRMUseSSL               *bool               `mapstructure:"winrm_use_ssl" cty:"winrm_use_ssl" hcl:"winrm_use_ssl"`
 	WinRMInsecure             *bool               `mapstructure:"winrm_insecure" cty:"winrm_insecure" hcl:"winrm_insecure"`
 	WinRMUseNTLM              *bool               `mapstructure:"winrm_use_ntlm" cty:"winrm_use_ntlm" hcl:"winrm_use_ntlm"`
+	Targets                   []FlatTarget        `mapstructure:"targets" required:"false" cty:"targets" hcl:"targets"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -104,12 +134,23 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"packer_on_error":              &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
 		"packer_user_variables":        &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
 		"packer_sensitive_variables":   &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"auth_method":                  &hcldec.AttrSpec{Name: "auth_method", Type: cty.String, Required: false},
 		"api_key":                      &hcldec.AttrSpec{Name: "api_key", Type: cty.String, Required: false},
+		"credentials_file":             &hcldec.AttrSpec{Name: "credentials_file", Type: cty.String, Required: false},
+		"trusted_profile_id":           &hcldec.AttrSpec{Name: "trusted_profile_id", Type: cty.String, Required: false},
+		"trusted_profile_name":         &hcldec.AttrSpec{Name: "trusted_profile_name", Type: cty.String, Required: false},
+		"cr_token_file":                &hcldec.AttrSpec{Name: "cr_token_file", Type: cty.String, Required: false},
 		"region":                       &hcldec.AttrSpec{Name: "region", Type: cty.String, Required: false},
 		"zone":                         &hcldec.AttrSpec{Name: "zone", Type: cty.String, Required: false},
 		"account_id":                   &hcldec.AttrSpec{Name: "account_id", Type: cty.String, Required: false},
 		"debug":                        &hcldec.AttrSpec{Name: "debug", Type: cty.Bool, Required: false},
 		"service_instance_id":          &hcldec.AttrSpec{Name: "service_instance_id", Type: cty.String, Required: false},
+		"workspace_name":               &hcldec.AttrSpec{Name: "workspace_name", Type: cty.String, Required: false},
+		"endpoint":                     &hcldec.AttrSpec{Name: "endpoint", Type: cty.String, Required: false},
+		"iam_url":                      &hcldec.AttrSpec{Name: "iam_url", Type: cty.String, Required: false},
+		"powervs_endpoint":             &hcldec.AttrSpec{Name: "powervs_endpoint", Type: cty.String, Required: false},
+		"use_private_endpoints":        &hcldec.AttrSpec{Name: "use_private_endpoints", Type: cty.Bool, Required: false},
+		"max_retries":                  &hcldec.AttrSpec{Name: "max_retries", Type: cty.Number, Required: false},
 		"instance_name":                &hcldec.AttrSpec{Name: "instance_name", Type: cty.String, Required: false},
 		"key_pair_name":                &hcldec.AttrSpec{Name: "key_pair_name", Type: cty.String, Required: false},
 		"subnet_ids":                   &hcldec.AttrSpec{Name: "subnet_ids", Type: cty.List(cty.String), Required: false},
@@ -118,6 +159,24 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"source":                       &hcldec.BlockSpec{TypeName: "source", Nested: hcldec.ObjectSpec((*common.FlatSource)(nil).HCL2Spec())},
 		"capture":                      &hcldec.BlockSpec{TypeName: "capture", Nested: hcldec.ObjectSpec((*common.FlatCapture)(nil).HCL2Spec())},
 		"cleanup_timeout":              &hcldec.AttrSpec{Name: "cleanup_timeout", Type: cty.String, Required: false},
+		"cleanup_journal":              &hcldec.AttrSpec{Name: "cleanup_journal", Type: cty.String, Required: false},
+		"event_log":                    &hcldec.AttrSpec{Name: "event_log", Type: cty.String, Required: false},
+		"shutdown_command":             &hcldec.AttrSpec{Name: "shutdown_command", Type: cty.String, Required: false},
+		"shutdown_behavior":            &hcldec.AttrSpec{Name: "shutdown_behavior", Type: cty.String, Required: false},
+		"shutdown_timeout":             &hcldec.AttrSpec{Name: "shutdown_timeout", Type: cty.String, Required: false},
+		"placement_group":              &hcldec.AttrSpec{Name: "placement_group", Type: cty.String, Required: false},
+		"pin_policy":                   &hcldec.AttrSpec{Name: "pin_policy", Type: cty.String, Required: false},
+		"affinity_policy":              &hcldec.AttrSpec{Name: "affinity_policy", Type: cty.String, Required: false},
+		"affinity_instance":            &hcldec.AttrSpec{Name: "affinity_instance", Type: cty.String, Required: false},
+		"host_id":                      &hcldec.AttrSpec{Name: "host_id", Type: cty.String, Required: false},
+		"deployment_type":              &hcldec.AttrSpec{Name: "deployment_type", Type: cty.String, Required: false},
+		"license_repository_capacity":  &hcldec.AttrSpec{Name: "license_repository_capacity", Type: cty.Number, Required: false},
+		"run_tags":                     &hcldec.AttrSpec{Name: "run_tags", Type: cty.Map(cty.String), Required: false},
+		"image_tags":                   &hcldec.AttrSpec{Name: "image_tags", Type: cty.Map(cty.String), Required: false},
+		"generalize":                   &hcldec.AttrSpec{Name: "generalize", Type: cty.Bool, Required: false},
+		"generalize_steps":             &hcldec.AttrSpec{Name: "generalize_steps", Type: cty.List(cty.String), Required: false},
+		"skip_if_unchanged":            &hcldec.AttrSpec{Name: "skip_if_unchanged", Type: cty.Bool, Required: false},
+		"content_hash":                 &hcldec.AttrSpec{Name: "content_hash", Type: cty.String, Required: false},
 		"communicator":                 &hcldec.AttrSpec{Name: "communicator", Type: cty.String, Required: false},
 		"pause_before_connecting":      &hcldec.AttrSpec{Name: "pause_before_connecting", Type: cty.String, Required: false},
 		"ssh_host":                     &hcldec.AttrSpec{Name: "ssh_host", Type: cty.String, Required: false},
@@ -167,6 +226,38 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"winrm_use_ssl":                &hcldec.AttrSpec{Name: "winrm_use_ssl", Type: cty.Bool, Required: false},
 		"winrm_insecure":               &hcldec.AttrSpec{Name: "winrm_insecure", Type: cty.Bool, Required: false},
 		"winrm_use_ntlm":               &hcldec.AttrSpec{Name: "winrm_use_ntlm", Type: cty.Bool, Required: false},
+		"targets":                      &hcldec.BlockListSpec{TypeName: "targets", Nested: hcldec.ObjectSpec((*FlatTarget)(nil).HCL2Spec())},
+	}
+	return s
+}
+
+// FlatTarget is an auto-generated flat version of Target.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatTarget struct {
+	ServiceInstanceID *string  `mapstructure:"service_instance_id" required:"false" cty:"service_instance_id" hcl:"service_instance_id"`
+	WorkspaceName     *string  `mapstructure:"workspace_name" required:"false" cty:"workspace_name" hcl:"workspace_name"`
+	Zone              *string  `mapstructure:"zone" required:"false" cty:"zone" hcl:"zone"`
+	Region            *string  `mapstructure:"region" required:"false" cty:"region" hcl:"region"`
+	SubnetIDs         []string `mapstructure:"subnet_ids" required:"false" cty:"subnet_ids" hcl:"subnet_ids"`
+}
+
+// FlatMapstructure returns a new FlatTarget.
+// FlatTarget is an auto-generated flat version of Target.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Target) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatTarget)
+}
+
+// HCL2Spec returns the hcl spec of a Target.
+// This spec is used by HCL to read the fields of Target.
+// The decoded values from this spec will then be applied to a FlatTarget.
+func (*FlatTarget) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"service_instance_id": &hcldec.AttrSpec{Name: "service_instance_id", Type: cty.String, Required: false},
+		"workspace_name":      &hcldec.AttrSpec{Name: "workspace_name", Type: cty.String, Required: false},
+		"zone":                &hcldec.AttrSpec{Name: "zone", Type: cty.String, Required: false},
+		"region":              &hcldec.AttrSpec{Name: "region", Type: cty.String, Required: false},
+		"subnet_ids":          &hcldec.AttrSpec{Name: "subnet_ids", Type: cty.List(cty.String), Required: false},
 	}
 	return s
 }
@@ -0,0 +1,384 @@
+package powervs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	powervscommon "github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+// testEndpointBuilder prepares a builder running against a fake PowerVS API server. The options
+// are added to the configuration.
+func testEndpointBuilder(t *testing.T, server *fake.Server, options map[string]interface{}) (*Builder, string) {
+	journal := filepath.Join(t.TempDir(), "journal.json")
+	config := map[string]interface{}{
+		"api_key":             "api-key",
+		"zone":                "dal10",
+		"region":              "us-south",
+		"service_instance_id": "workspace",
+		"endpoint":            server.URL,
+		"instance_name":       "packer-test",
+		"key_pair_name":       "key",
+		"communicator":        "none",
+		"cleanup_journal":     journal,
+		"source":              map[string]interface{}{"stock_image": map[string]interface{}{"name": "CentOS-Stream-9"}},
+		"capture":             map[string]interface{}{"name": "captured", "destination": CaptureDestinationImageCatalog},
+		"run_tags":            map[string]string{"packer": "test"},
+		"image_tags":          map[string]string{"image": "test"},
+	}
+	for key, value := range options {
+		config[key] = value
+	}
+	var b Builder
+	generatedVars, _, err := b.Prepare(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(generatedVars, generatedDataKeys) {
+		t.Fatalf("generated vars = %v, want %v", generatedVars, generatedDataKeys)
+	}
+	return &b, journal
+}
+
+func TestBuilder_Run_Endpoint(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddStockImage("CentOS-Stream-9", "rhel")
+	backend.JobPolls = 2
+	backend.InstancePolls = 2
+	server := fake.NewServer(backend)
+	defer server.Close()
+	b, journal := testEndpointBuilder(t, server, nil)
+
+	artifact, err := b.Run(context.Background(), packersdk.TestUi(t), &packersdk.MockHook{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if artifact == nil {
+		t.Fatal("no artifact")
+	}
+
+	// Only the captured image is left.
+	ids := backend.ImageIDs()
+	if len(ids) != 1 {
+		t.Fatalf("images = %v, want the captured image", ids)
+	}
+	image, _ := backend.Image(ids[0])
+	if *image.Name != "captured" {
+		t.Errorf("image = %s, want captured", *image.Name)
+	}
+	if tags := backend.Tags(string(image.Crn)); len(tags) != 1 || tags[0] != "image:test" {
+		t.Errorf("image tags = %v, want the image tags", tags)
+	}
+	if artifact.Id() != *image.ImageID || artifact.State("image_name") != "captured" || artifact.State("zone") != "dal10" {
+		t.Errorf("artifact = %s %v, want the captured image", artifact.Id(), artifact.State("image_name"))
+	}
+	generated := artifact.State("generated_data").(map[string]interface{})
+	for _, key := range []string{"InstanceID", "SourceImageID", "NetworkID", "Zone"} {
+		if value, _ := generated[key].(string); value == "" {
+			t.Errorf("generated data %s not set: %v", key, generated)
+		}
+	}
+	if generated["Zone"] != "dal10" {
+		t.Errorf("Zone = %v, want dal10", generated["Zone"])
+	}
+	if ids := backend.InstanceIDs(); len(ids) != 0 {
+		t.Errorf("instances left: %v", ids)
+	}
+	if ids := backend.NetworkIDs(); len(ids) != 0 {
+		t.Errorf("networks left: %v", ids)
+	}
+	if _, err := os.Stat(journal); !os.IsNotExist(err) {
+		t.Errorf("journal not removed: %v", err)
+	}
+}
+
+func TestBuilder_Run_EndpointRetries(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddStockImage("CentOS-Stream-9", "rhel")
+	backend.JobPolls = 2
+	server := fake.NewServer(backend)
+	defer server.Close()
+	server.FailTimes("InstanceClient.Create", http.StatusServiceUnavailable, 2)
+	server.Throttle("NetworkClient.Create", 1, 0)
+	server.FailTimes("JobClient.Get", http.StatusInternalServerError, 3)
+	server.FailTimes("InstanceClient.CaptureInstanceToImageCatalogV2", http.StatusBadGateway, 1)
+	b, _ := testEndpointBuilder(t, server, nil)
+
+	if _, err := b.Run(context.Background(), packersdk.TestUi(t), &packersdk.MockHook{}); err != nil {
+		t.Fatal(err)
+	}
+	if ids := backend.ImageIDs(); len(ids) != 1 {
+		t.Errorf("images = %v, want the captured image", ids)
+	}
+}
+
+func TestBuilder_Run_EndpointFailure(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddStockImage("CentOS-Stream-9", "rhel")
+	server := fake.NewServer(backend)
+	defer server.Close()
+	server.Fail("InstanceClient.Create", http.StatusInternalServerError)
+	b, journal := testEndpointBuilder(t, server, nil)
+
+	if _, err := b.Run(context.Background(), packersdk.TestUi(t), &packersdk.MockHook{}); err == nil {
+		t.Fatal("Run() succeeded, want the instance creation error")
+	}
+
+	// The source image and the network are deleted by the cleanup of the steps.
+	if ids := backend.ImageIDs(); len(ids) != 0 {
+		t.Errorf("images left: %v", ids)
+	}
+	if ids := backend.NetworkIDs(); len(ids) != 0 {
+		t.Errorf("networks left: %v", ids)
+	}
+	if _, err := os.Stat(journal); !os.IsNotExist(err) {
+		t.Errorf("journal not removed: %v", err)
+	}
+}
+
+func TestBuilder_Run_SkipIfUnchanged(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddStockImage("CentOS-Stream-9", "rhel")
+	server := fake.NewServer(backend)
+	defer server.Close()
+	options := map[string]interface{}{"skip_if_unchanged": true, "content_hash": "hash-1"}
+
+	b, _ := testEndpointBuilder(t, server, options)
+	first, err := b.Run(context.Background(), packersdk.TestUi(t), &packersdk.MockHook{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.State("unchanged") != false {
+		t.Errorf("first build unchanged = %v, want false", first.State("unchanged"))
+	}
+	image, _ := backend.Image(first.Id())
+	fingerprint := first.State("fingerprint").(string)
+	if tags := backend.Tags(string(image.Crn)); !slices.Contains(tags, powervscommon.FingerprintTag(fingerprint)) {
+		t.Errorf("image tags = %v, want the fingerprint", tags)
+	}
+
+	// The same inputs give the captured image back without building.
+	b, _ = testEndpointBuilder(t, server, options)
+	second, err := b.Run(context.Background(), packersdk.TestUi(t), &packersdk.MockHook{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Id() != first.Id() || second.State("unchanged") != true {
+		t.Errorf("second build = %s (unchanged %v), want the image %s", second.Id(), second.State("unchanged"), first.Id())
+	}
+	creates := 0
+	for _, call := range backend.Calls() {
+		if call == "InstanceClient.Create" {
+			creates++
+		}
+	}
+	if creates != 1 {
+		t.Errorf("instances created = %d, want 1", creates)
+	}
+
+	// A new content hash builds again.
+	options["content_hash"] = "hash-2"
+	b, _ = testEndpointBuilder(t, server, options)
+	third, err := b.Run(context.Background(), packersdk.TestUi(t), &packersdk.MockHook{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Id() == first.Id() || third.State("fingerprint") == fingerprint {
+		t.Errorf("third build = %s, want a new image", third.Id())
+	}
+}
+
+func TestBuilder_Prepare_SkipIfUnchanged(t *testing.T) {
+	server := fake.NewServer(fake.NewBackend())
+	defer server.Close()
+	var b Builder
+	_, _, err := b.Prepare(map[string]interface{}{
+		"api_key":             "api-key",
+		"zone":                "dal10",
+		"service_instance_id": "workspace",
+		"endpoint":            server.URL,
+		"instance_name":       "packer-test",
+		"key_pair_name":       "key",
+		"communicator":        "none",
+		"source":              map[string]interface{}{"stock_image": map[string]interface{}{"name": "CentOS-Stream-9"}},
+		"capture":             map[string]interface{}{"name": "captured", "destination": CaptureDestinationCloudStorage},
+		"skip_if_unchanged":   true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "skip_if_unchanged") {
+		t.Errorf("Prepare() error = %v, want the capture destination to be rejected", err)
+	}
+}
+
+func TestBuilder_Prepare_CaptureOptions(t *testing.T) {
+	server := fake.NewServer(fake.NewBackend())
+	defer server.Close()
+	for _, tc := range []struct {
+		capture map[string]interface{}
+		want    string
+	}{
+		{map[string]interface{}{"name": "captured", "destination": CaptureDestinationCloudStorage, "force_deregister": true}, "force_deregister"},
+		{map[string]interface{}{"name": "captured", "destination": CaptureDestinationCloudStorage, "keep_last_n": 3}, "keep_last_n"},
+		{map[string]interface{}{"name": "captured", "destination": CaptureDestinationImageCatalog, "keep_last_n": -1}, "keep_last_n"},
+		{map[string]interface{}{"name": "captured", "destination": CaptureDestinationImageCatalog, "name_suffix": "date"}, "name_suffix"},
+	} {
+		var b Builder
+		_, _, err := b.Prepare(map[string]interface{}{
+			"api_key":             "api-key",
+			"zone":                "dal10",
+			"service_instance_id": "workspace",
+			"endpoint":            server.URL,
+			"instance_name":       "packer-test",
+			"key_pair_name":       "key",
+			"communicator":        "none",
+			"source":              map[string]interface{}{"stock_image": map[string]interface{}{"name": "CentOS-Stream-9"}},
+			"capture":             tc.capture,
+		})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Prepare(%v) error = %v, want %s to be rejected", tc.capture, err, tc.want)
+		}
+	}
+}
+
+// readEvents reads the events of an event log.
+func readEvents(t *testing.T, path string) []powervscommon.Event {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []powervscommon.Event
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event powervscommon.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestBuilder_Run_EventLog(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddStockImage("CentOS-Stream-9", "rhel")
+	backend.JobPolls = 2
+	server := fake.NewServer(backend)
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	b, _ := testEndpointBuilder(t, server, map[string]interface{}{"event_log": path})
+
+	if _, err := b.Run(context.Background(), packersdk.TestUi(t), &packersdk.MockHook{}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := readEvents(t, path)
+	var types []string
+	for _, e := range events {
+		if e.Zone != "dal10" || e.ServiceInstanceID != "workspace" {
+			t.Errorf("event %s is not for the workspace: %+v", e.Type, e)
+		}
+		if e.DurationMS < 0 {
+			t.Errorf("event %s has a negative duration", e.Type)
+		}
+		types = append(types, e.Type)
+	}
+	if first, last := types[0], types[len(types)-1]; first != powervscommon.EventBuildStarted || last != powervscommon.EventBuildFinished {
+		t.Errorf("events = %v, want build_started ... build_finished", types)
+	}
+
+	count := func(match func(e powervscommon.Event) bool) int {
+		n := 0
+		for _, e := range events {
+			if match(e) {
+				n++
+			}
+		}
+		return n
+	}
+	if n := count(func(e powervscommon.Event) bool {
+		return e.Type == powervscommon.EventStepFinished && e.Step == "StepCreateInstance" && !e.Halted
+	}); n != 1 {
+		t.Errorf("StepCreateInstance finished %d times, want 1", n)
+	}
+	for _, resourceType := range []string{powervscommon.ResourceTypeImage, powervscommon.ResourceTypeNetwork, powervscommon.ResourceTypeInstance} {
+		created := count(func(e powervscommon.Event) bool {
+			return e.Type == powervscommon.EventResourceCreated && e.ResourceType == resourceType
+		})
+		deleted := count(func(e powervscommon.Event) bool {
+			return e.Type == powervscommon.EventResourceDeleted && e.ResourceType == resourceType
+		})
+		if created == 0 || deleted == 0 {
+			t.Errorf("%s created %d times and deleted %d times, want both", resourceType, created, deleted)
+		}
+	}
+	if n := count(func(e powervscommon.Event) bool {
+		return e.Type == powervscommon.EventJobProgress && e.Step == "StepCaptureInstance" && e.Progress != nil && *e.Progress == 100
+	}); n != 1 {
+		t.Errorf("capture job completed %d times, want 1", n)
+	}
+}
+
+func TestBuilder_Run_EventLogError(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddStockImage("CentOS-Stream-9", "rhel")
+	server := fake.NewServer(backend)
+	defer server.Close()
+	server.Fail("InstanceClient.Create", http.StatusBadRequest)
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	b, _ := testEndpointBuilder(t, server, map[string]interface{}{"event_log": path})
+
+	if _, err := b.Run(context.Background(), packersdk.TestUi(t), &packersdk.MockHook{}); err == nil {
+		t.Fatal("Run() succeeded, want the instance creation error")
+	}
+
+	var errorEvent *powervscommon.Event
+	for _, e := range readEvents(t, path) {
+		if e.Type == powervscommon.EventError {
+			errorEvent = &e
+		}
+	}
+	if errorEvent == nil {
+		t.Fatal("no error event")
+	}
+	if errorEvent.Step != "StepCreateInstance" || !strings.HasPrefix(errorEvent.RequestID, "request-") {
+		t.Errorf("error event = %+v, want the failed request of StepCreateInstance", errorEvent)
+	}
+}
+
+func TestInstanceIP(t *testing.T) {
+	state := new(multistep.BasicStateBag)
+	host := instanceIP(func(multistep.StateBag) (string, error) { return "192.168.0.10", nil })
+
+	if ip, err := host(state); err != nil || ip != "192.168.0.10" {
+		t.Fatalf("host() = %q, %v", ip, err)
+	}
+	if generated := state.Get("generated_data").(map[string]interface{}); generated["InstanceIP"] != "192.168.0.10" {
+		t.Errorf("InstanceIP = %v, want the address of the communicator", generated["InstanceIP"])
+	}
+}
+
+func TestBuilder_Prepare_DefaultJournal(t *testing.T) {
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+	server := fake.NewServer(fake.NewBackend())
+	defer server.Close()
+
+	// Two builds of the same instance name do not share their journal.
+	var paths []string
+	for _, build := range []string{"powervs.centos", "powervs.rhel"} {
+		b, _ := testEndpointBuilder(t, server, map[string]interface{}{"cleanup_journal": "", "packer_build_name": build})
+		paths = append(paths, b.config.CleanupJournal)
+	}
+	want := fmt.Sprintf("powervs.centos-packer-test-%d.journal.json", os.Getpid())
+	if filepath.Base(paths[0]) != want || paths[0] == paths[1] {
+		t.Errorf("journals = %v, want %s and another one", paths, want)
+	}
+}
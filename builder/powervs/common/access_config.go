@@ -4,57 +4,207 @@ package common
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
 
 	"github.com/IBM-Cloud/power-go-client/clients/instance"
 	ps "github.com/IBM-Cloud/power-go-client/ibmpisession"
 	"github.com/IBM/go-sdk-core/v5/core"
-	"github.com/IBM/platform-services-go-sdk/iamidentityv1"
+	"github.com/IBM/platform-services-go-sdk/globalsearchv2"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
+	httptransport "github.com/go-openapi/runtime/client"
 )
 
 type AccessConfig struct {
-	// The api key used to communicate with IBM Cloud.
-	APIKey string `mapstructure:"api_key" required:"true"`
+	// How to authenticate with IBM Cloud, one of `api-key`, `trusted-profile` or `vpc-instance`.
+	// Default `api-key`.
+	//
+	// - `api-key`: `api_key`, or else the API key of `credentials_file`, `IBMCLOUD_API_KEY` or `IC_API_KEY`.
+	// - `trusted-profile`: the compute resource token of `cr_token_file` exchanged for the trusted
+	//   profile `trusted_profile_id` or `trusted_profile_name`, e.g. on IBM Cloud Kubernetes or Code Engine.
+	// - `vpc-instance`: the instance identity token of the VPC virtual server the build runs on,
+	//   exchanged for its trusted profile or `trusted_profile_id`.
+	AuthMethod string `mapstructure:"auth_method" required:"false"`
 
-	// Region of a Power VS.
+	// The api key used to communicate with IBM Cloud. Defaults to the `IBMCLOUD_API_KEY` or
+	// `IC_API_KEY` environment variable with the `api-key` auth_method.
+	APIKey string `mapstructure:"api_key" required:"false"`
+
+	// Path of a JSON file holding an API key in its `apikey` field, as written by
+	// `ibmcloud iam api-key-create NAME --file FILE`. Used when `api_key` is not set.
+	CredentialsFile string `mapstructure:"credentials_file" required:"false"`
+
+	// ID of the trusted profile to authenticate as with the `trusted-profile` and `vpc-instance`
+	// auth methods.
+	TrustedProfileID string `mapstructure:"trusted_profile_id" required:"false"`
+
+	// Name of the trusted profile to authenticate as with the `trusted-profile` auth_method.
+	TrustedProfileName string `mapstructure:"trusted_profile_name" required:"false"`
+
+	// Path of the compute resource token file with the `trusted-profile` auth_method. Defaults to the
+	// token files mounted by IBM Cloud Kubernetes and Code Engine.
+	CRTokenFile string `mapstructure:"cr_token_file" required:"false"`
+
+	// Region of a Power VS. Derived from the zone when not set.
 	Region string `mapstructure:"region" required:"false"`
 
-	// Zone of a Power VS.
-	Zone string `mapstructure:"zone" required:"true"`
+	// Zone of a Power VS. Required unless `workspace_name` is set, in which case it defaults to the
+	// zone of the workspace and must match it when set.
+	Zone string `mapstructure:"zone" required:"false"`
 
-	// Account ID of a IBM Cloud account.
+	// Account ID of a IBM Cloud account. Defaults to the account of the IAM token.
 	AccountID string `mapstructure:"account_id" required:"false"`
 
 	// Enable debug logging, Default `false`.
 	Debug bool `mapstructure:"debug" required:"false"`
 
-	// Power VS ServiceInstanceID
-	ServiceInstanceID string `mapstructure:"service_instance_id" required:"true"`
+	// Power VS ServiceInstanceID. Required unless `workspace_name` is set. When the build starts, the
+	// workspace is looked up with the Resource Controller API to check that it is in `zone`, if the API key
+	// can list it.
+	ServiceInstanceID string `mapstructure:"service_instance_id" required:"false"`
+
+	// Name of the PowerVS workspace, looked up with the Resource Controller API to find its
+	// service_instance_id and zone. Can not be used with `service_instance_id`.
+	WorkspaceName string `mapstructure:"workspace_name" required:"false"`
+
+	// Base URL of a server implementing the PowerVS, IAM and Global Tagging APIs, e.g.
+	// `http://127.0.0.1:8080`. When set, every API call of the plugin goes to this server instead of
+	// IBM Cloud. Meant for testing against a local stand-in of the APIs.
+	Endpoint string `mapstructure:"endpoint" required:"false"`
+
+	// URL of the IAM service, used to get tokens and to look up the account of the API key,
+	// e.g. `https://private.iam.cloud.ibm.com`. Defaults to the public or private IAM endpoint
+	// depending on `use_private_endpoints`.
+	IAMURL string `mapstructure:"iam_url" required:"false"`
 
-	session *ps.IBMPISession
+	// URL of the PowerVS API, e.g. `https://private.us-south.power-iaas.cloud.ibm.com`. Defaults to
+	// the public or private endpoint of the region depending on `use_private_endpoints`.
+	PowerVSEndpoint string `mapstructure:"powervs_endpoint" required:"false"`
+
+	// Use the private endpoints of IAM, PowerVS, Global Tagging and Global Search, for builds running on
+	// a network without access to the public IBM Cloud endpoints. Default `false`.
+	UsePrivateEndpoints bool `mapstructure:"use_private_endpoints" required:"false"`
+
+	// Number of times an API call failing with a transient error, e.g. a 429 or 503 response, is
+	// retried before the build fails. Default `5`, `-1` disables the retries.
+	MaxRetries int `mapstructure:"max_retries" required:"false"`
+
+	auth     core.Authenticator
+	session  *ps.IBMPISession
+	requests *requestIDTransport
 }
 
-func getAccount(apikey string) (accountID string, err error) {
-	authenticator := &core.IamAuthenticator{
-		ApiKey: apikey,
+const (
+	privateIAMURL                = "https://private.iam.cloud.ibm.com"
+	privateTaggingURL            = "https://tags.private.global-search-tagging.cloud.ibm.com"
+	privateSearchURL             = "https://api.private.global-search-tagging.cloud.ibm.com"
+	privateResourceControllerURL = "https://resource-controller.private.cloud.ibm.com"
+)
+
+func (c *AccessConfig) Prepare() []error {
+	errs := c.prepareAuth()
+	switch {
+	case c.WorkspaceName != "" && c.ServiceInstanceID != "":
+		errs = append(errs, errors.New("only one of service_instance_id or workspace_name can be set"))
+	case c.WorkspaceName == "" && c.ServiceInstanceID == "":
+		errs = append(errs, errors.New("service_instance_id or workspace_name is required"))
+	case c.WorkspaceName == "" && c.Zone == "":
+		errs = append(errs, errors.New("zone is required with service_instance_id"))
 	}
-	iamv1, err := iamidentityv1.NewIamIdentityV1(&iamidentityv1.IamIdentityV1Options{Authenticator: authenticator})
-	if err != nil {
-		return
+	for _, option := range []struct{ name, value string }{
+		{"endpoint", c.Endpoint},
+		{"iam_url", c.IAMURL},
+		{"powervs_endpoint", c.PowerVSEndpoint},
+	} {
+		if option.value == "" {
+			continue
+		}
+		if u, err := url.Parse(option.value); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid %s: %q (use an absolute http or https URL)", option.name, option.value))
+		}
 	}
+	return errs
+}
 
-	apiKeyDetailsOpt := iamidentityv1.GetAPIKeysDetailsOptions{IamAPIKey: &apikey}
-	apiKey, _, err := iamv1.GetAPIKeysDetails(&apiKeyDetailsOpt)
-	if err != nil {
-		return
+// iamURL returns the URL of the IAM service, empty for the default public endpoint.
+func (c *AccessConfig) iamURL() string {
+	switch {
+	case c.IAMURL != "":
+		return c.IAMURL
+	case c.Endpoint != "":
+		return c.Endpoint
+	case c.UsePrivateEndpoints:
+		return privateIAMURL
 	}
-	if apiKey == nil {
-		err = fmt.Errorf("could retrieve account id")
-		return
+	return ""
+}
+
+// powerVSURL returns the URL of the PowerVS API, empty for the default public endpoint of the region.
+func (c *AccessConfig) powerVSURL() string {
+	switch {
+	case c.PowerVSEndpoint != "":
+		return c.PowerVSEndpoint
+	case c.Endpoint != "":
+		return c.Endpoint
+	case c.UsePrivateEndpoints:
+		return fmt.Sprintf("https://private.%s.power-iaas.cloud.ibm.com", c.region())
 	}
+	return ""
+}
 
-	accountID = *apiKey.AccountID
-	return
+// taggingURL returns the URL of the Global Tagging service, empty for the default public endpoint.
+func (c *AccessConfig) taggingURL() string {
+	switch {
+	case c.Endpoint != "":
+		return c.Endpoint
+	case c.UsePrivateEndpoints:
+		return privateTaggingURL
+	}
+	return ""
+}
+
+// Reset forgets the authenticator and the PowerVS session created from the configuration, so that a copy
+// of the configuration for another workspace creates its own.
+func (c *AccessConfig) Reset() {
+	c.auth = nil
+	c.session = nil
+	c.requests = nil
+}
+
+// searchURL returns the URL of the Global Search service, empty for the default public endpoint.
+func (c *AccessConfig) searchURL() string {
+	switch {
+	case c.Endpoint != "":
+		return c.Endpoint
+	case c.UsePrivateEndpoints:
+		return privateSearchURL
+	}
+	return ""
+}
+
+// resourceControllerURL returns the URL of the Resource Controller service, empty for the default public endpoint.
+func (c *AccessConfig) resourceControllerURL() string {
+	switch {
+	case c.Endpoint != "":
+		return c.Endpoint
+	case c.UsePrivateEndpoints:
+		return privateResourceControllerURL
+	}
+	return ""
+}
+
+// region returns the region, derived from the zone the same way the PowerVS client does when it is not set.
+func (c *AccessConfig) region() string {
+	if c.Region != "" {
+		return c.Region
+	}
+	if strings.Contains(c.Zone, "-") {
+		return regexp.MustCompile("-[0-9]+$").ReplaceAllString(c.Zone, "")
+	}
+	return regexp.MustCompile("[0-9]+$").ReplaceAllString(c.Zone, "")
 }
 
 func (c *AccessConfig) Session() (_ *ps.IBMPISession, err error) {
@@ -62,30 +212,34 @@ func (c *AccessConfig) Session() (_ *ps.IBMPISession, err error) {
 		return c.session, nil
 	}
 
-	accountID := ""
-	if c.AccountID != "" {
-		accountID = c.AccountID
-	} else {
-		accountID, err = getAccount(c.APIKey)
+	authenticator, err := c.authenticator()
+	if err != nil {
+		return nil, err
+	}
+	accountID := c.AccountID
+	if accountID == "" {
+		accountID, err = tokenAccount(authenticator)
 		if err != nil {
-			return
+			return nil, fmt.Errorf("failed to get the account ID from the IAM token, set account_id: %w", err)
 		}
 	}
 
-	authenticator := &core.IamAuthenticator{
-		ApiKey: c.APIKey,
-	}
 	options := &ps.IBMPIOptions{
 		Authenticator: authenticator,
 		UserAccount:   accountID,
 		Region:        c.Region,
 		Zone:          c.Zone,
 		Debug:         c.Debug,
+		URL:           c.powerVSURL(),
 	}
 	session, err := ps.NewIBMPISession(options)
 	if err != nil {
 		return nil, err
 	}
+	if rt, ok := session.Power.Transport.(*httptransport.Runtime); ok {
+		c.requests = &requestIDTransport{RoundTripper: rt.Transport}
+		rt.Transport = c.requests
+	}
 	c.session = session
 	return session, nil
 }
@@ -129,3 +283,40 @@ func (c *AccessConfig) DHCPClient(ctx context.Context, id string) (*instance.IBM
 	}
 	return instance.NewIBMPIDhcpClient(ctx, session, id), nil
 }
+
+func (c *AccessConfig) TaggingClient() (*globaltaggingv1.GlobalTaggingV1, error) {
+	authenticator, err := c.authenticator()
+	if err != nil {
+		return nil, err
+	}
+	tagging, err := globaltaggingv1.NewGlobalTaggingV1(&globaltaggingv1.GlobalTaggingV1Options{
+		Authenticator: authenticator,
+		URL:           c.taggingURL(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if n := c.maxRetries(); n > 0 {
+		tagging.Service.EnableRetries(n, RetryMaxDelay)
+	}
+	return tagging, nil
+}
+
+// SearchClient returns a Global Search client, to find resources by tag.
+func (c *AccessConfig) SearchClient() (*globalsearchv2.GlobalSearchV2, error) {
+	authenticator, err := c.authenticator()
+	if err != nil {
+		return nil, err
+	}
+	search, err := globalsearchv2.NewGlobalSearchV2(&globalsearchv2.GlobalSearchV2Options{
+		Authenticator: authenticator,
+		URL:           c.searchURL(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if n := c.maxRetries(); n > 0 {
+		search.Service.EnableRetries(n, RetryMaxDelay)
+	}
+	return search, nil
+}
@@ -0,0 +1,332 @@
+package common_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+func TestAccessConfig_Prepare(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  common.AccessConfig
+		wantErr int
+	}{
+		{name: "defaults"},
+		{name: "private", config: common.AccessConfig{UsePrivateEndpoints: true}},
+		{name: "valid urls", config: common.AccessConfig{
+			IAMURL:          "https://private.iam.cloud.ibm.com",
+			PowerVSEndpoint: "https://private.us-south.power-iaas.cloud.ibm.com",
+			Endpoint:        "http://127.0.0.1:8080",
+		}},
+		{name: "host only", config: common.AccessConfig{PowerVSEndpoint: "us-south.power-iaas.cloud.ibm.com"}, wantErr: 1},
+		{name: "bad scheme", config: common.AccessConfig{IAMURL: "ftp://iam.cloud.ibm.com", Endpoint: "://"}, wantErr: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.APIKey = "api-key"
+			tt.config.ServiceInstanceID = "workspace"
+			tt.config.Zone = "dal10"
+			if errs := tt.config.Prepare(); len(errs) != tt.wantErr {
+				t.Errorf("Prepare() = %v, want %d errors", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccessConfig_PrepareAuth(t *testing.T) {
+	credentials := filepath.Join(t.TempDir(), "apikey.json")
+	if err := os.WriteFile(credentials, []byte(`{"name":"packer","apikey":"file-key"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		config     common.AccessConfig
+		env        string
+		wantAPIKey string
+		wantErr    int
+	}{
+		{name: "api key", config: common.AccessConfig{APIKey: "key"}, env: "env-key", wantAPIKey: "key"},
+		{name: "env", env: "env-key", wantAPIKey: "env-key"},
+		{name: "credentials file", config: common.AccessConfig{CredentialsFile: credentials}, env: "env-key", wantAPIKey: "file-key"},
+		{name: "missing credentials file", config: common.AccessConfig{CredentialsFile: credentials + ".missing"}, wantErr: 1},
+		{name: "api key and credentials file", config: common.AccessConfig{APIKey: "key", CredentialsFile: credentials}, wantErr: 1},
+		{name: "no api key", wantErr: 1},
+		{name: "trusted profile with api key", config: common.AccessConfig{APIKey: "key", TrustedProfileID: "profile"}, wantErr: 1},
+		{name: "trusted profile", config: common.AccessConfig{AuthMethod: common.AuthMethodTrustedProfile, TrustedProfileName: "profile"}},
+		{name: "trusted profile missing", config: common.AccessConfig{AuthMethod: common.AuthMethodTrustedProfile}, wantErr: 1},
+		{name: "trusted profile id and name", config: common.AccessConfig{
+			AuthMethod: common.AuthMethodTrustedProfile, TrustedProfileID: "id", TrustedProfileName: "name",
+		}, wantErr: 1},
+		{name: "trusted profile and api key", config: common.AccessConfig{
+			AuthMethod: common.AuthMethodTrustedProfile, TrustedProfileID: "id", APIKey: "key",
+		}, wantErr: 1},
+		{name: "vpc instance", config: common.AccessConfig{AuthMethod: common.AuthMethodVPCInstance}},
+		{name: "vpc instance profile name", config: common.AccessConfig{
+			AuthMethod: common.AuthMethodVPCInstance, TrustedProfileName: "name", CRTokenFile: "token",
+		}, wantErr: 2},
+		{name: "unknown", config: common.AccessConfig{AuthMethod: "password"}, wantErr: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("IBMCLOUD_API_KEY", tt.env)
+			t.Setenv("IC_API_KEY", "")
+			tt.config.ServiceInstanceID = "workspace"
+			tt.config.Zone = "dal10"
+			errs := tt.config.Prepare()
+			if len(errs) != tt.wantErr {
+				t.Fatalf("Prepare() = %v, want %d errors", errs, tt.wantErr)
+			}
+			if tt.wantErr == 0 && tt.config.APIKey != tt.wantAPIKey {
+				t.Errorf("api_key = %q, want %q", tt.config.APIKey, tt.wantAPIKey)
+			}
+		})
+	}
+}
+
+func TestAccessConfig_Endpoints(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      common.AccessConfig
+		wantIAM     string
+		wantPowerVS string
+		wantTagging string
+	}{
+		{
+			name:        "public",
+			config:      common.AccessConfig{Zone: "dal10"},
+			wantTagging: "https://tags.global-search-tagging.cloud.ibm.com",
+		},
+		{
+			name:        "private",
+			config:      common.AccessConfig{Zone: "dal10", Region: "us-south", UsePrivateEndpoints: true},
+			wantIAM:     "https://private.iam.cloud.ibm.com",
+			wantPowerVS: "https://private.us-south.power-iaas.cloud.ibm.com",
+			wantTagging: "https://tags.private.global-search-tagging.cloud.ibm.com",
+		},
+		{
+			name:        "private region from zone",
+			config:      common.AccessConfig{Zone: "eu-de-1", UsePrivateEndpoints: true},
+			wantIAM:     "https://private.iam.cloud.ibm.com",
+			wantPowerVS: "https://private.eu-de.power-iaas.cloud.ibm.com",
+			wantTagging: "https://tags.private.global-search-tagging.cloud.ibm.com",
+		},
+		{
+			name: "custom",
+			config: common.AccessConfig{
+				Zone:                "dal10",
+				UsePrivateEndpoints: true,
+				IAMURL:              "https://iam.example.com",
+				PowerVSEndpoint:     "https://powervs.example.com",
+			},
+			wantIAM:     "https://iam.example.com",
+			wantPowerVS: "https://powervs.example.com",
+			wantTagging: "https://tags.private.global-search-tagging.cloud.ibm.com",
+		},
+		{
+			name:        "endpoint",
+			config:      common.AccessConfig{Zone: "dal10", Endpoint: "http://127.0.0.1:8080", IAMURL: "https://iam.example.com"},
+			wantIAM:     "https://iam.example.com",
+			wantPowerVS: "http://127.0.0.1:8080",
+			wantTagging: "http://127.0.0.1:8080",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.APIKey = "api-key"
+			tt.config.AccountID = "account"
+			session, err := tt.config.Session()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := session.Options.Authenticator.(*core.IamAuthenticator).URL; got != tt.wantIAM {
+				t.Errorf("IAM URL = %q, want %q", got, tt.wantIAM)
+			}
+			if got := session.Options.URL; got != tt.wantPowerVS {
+				t.Errorf("PowerVS URL = %q, want %q", got, tt.wantPowerVS)
+			}
+			tagging, err := tt.config.TaggingClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tagging.Service.GetServiceURL(); got != tt.wantTagging {
+				t.Errorf("Global Tagging URL = %q, want %q", got, tt.wantTagging)
+			}
+		})
+	}
+}
+
+func TestAccessConfig_Session(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddImage("image", "rhel")
+	server := fake.NewServer(backend)
+	defer server.Close()
+
+	// The account is read from the IAM token got through iam_url.
+	config := &common.AccessConfig{
+		APIKey:            "api-key",
+		Zone:              "dal10",
+		ServiceInstanceID: "workspace",
+		IAMURL:            server.URL,
+		PowerVSEndpoint:   server.URL,
+	}
+	session, err := config.Session()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Options.UserAccount != fake.AccountID {
+		t.Errorf("account = %q, want %q", session.Options.UserAccount, fake.AccountID)
+	}
+
+	client, err := config.ImageClient(context.Background(), config.ServiceInstanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := client.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images.Images) != 1 {
+		t.Errorf("images = %d, want 1", len(images.Images))
+	}
+}
+
+func TestAccessConfig_SessionAuthMethods(t *testing.T) {
+	server := fake.NewServer(fake.NewBackend())
+	defer server.Close()
+	crToken := filepath.Join(t.TempDir(), "cr-token")
+	if err := os.WriteFile(crToken, []byte("compute-resource-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config common.AccessConfig
+	}{
+		{name: "trusted profile", config: common.AccessConfig{
+			AuthMethod:       common.AuthMethodTrustedProfile,
+			TrustedProfileID: "profile",
+			CRTokenFile:      crToken,
+		}},
+		{name: "vpc instance", config: common.AccessConfig{AuthMethod: common.AuthMethodVPCInstance}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Zone = "dal10"
+			tt.config.ServiceInstanceID = "workspace"
+			tt.config.Endpoint = server.URL
+			if errs := tt.config.Prepare(); len(errs) != 0 {
+				t.Fatal(errs)
+			}
+			session, err := tt.config.Session()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.Options.UserAccount != fake.AccountID {
+				t.Errorf("account = %q, want %q", session.Options.UserAccount, fake.AccountID)
+			}
+			client, err := tt.config.ImageClient(context.Background(), "workspace")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.GetAll(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestAccessConfig_PrepareWorkspace(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  common.AccessConfig
+		wantErr bool
+	}{
+		{name: "service instance id", config: common.AccessConfig{ServiceInstanceID: "workspace", Zone: "dal10"}},
+		{name: "workspace name", config: common.AccessConfig{WorkspaceName: "packer"}},
+		{name: "both", config: common.AccessConfig{ServiceInstanceID: "workspace", WorkspaceName: "packer"}, wantErr: true},
+		{name: "none", config: common.AccessConfig{Zone: "dal10"}, wantErr: true},
+		{name: "service instance id without zone", config: common.AccessConfig{ServiceInstanceID: "workspace"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.APIKey = "api-key"
+			if errs := tt.config.Prepare(); (len(errs) != 0) != tt.wantErr {
+				t.Errorf("Prepare() = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccessConfig_ResolveWorkspace(t *testing.T) {
+	backend := fake.NewBackend()
+	guid := backend.AddWorkspace("packer", "dal12")
+	backend.AddWorkspace("other", "lon04")
+	backend.AddWorkspace("twice", "lon04")
+	backend.AddWorkspace("twice", "syd05")
+	server := fake.NewServer(backend)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		config     common.AccessConfig
+		wantZone   string
+		wantRegion string
+		wantErr    bool
+	}{
+		{name: "derived", config: common.AccessConfig{WorkspaceName: "packer"}, wantZone: "dal12", wantRegion: "dal"},
+		{name: "matching zone", config: common.AccessConfig{WorkspaceName: "packer", Zone: "dal12", Region: "us-south"}, wantZone: "dal12", wantRegion: "us-south"},
+		{name: "other zone", config: common.AccessConfig{WorkspaceName: "packer", Zone: "dal10"}, wantErr: true},
+		{name: "not found", config: common.AccessConfig{WorkspaceName: "missing"}, wantErr: true},
+		{name: "ambiguous", config: common.AccessConfig{WorkspaceName: "twice"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.APIKey = "api-key"
+			tt.config.Endpoint = server.URL
+			err := tt.config.ResolveWorkspace(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveWorkspace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.config.ServiceInstanceID != guid || tt.config.Zone != tt.wantZone || tt.config.Region != tt.wantRegion {
+				t.Errorf("workspace = %s in %s/%s, want %s in %s/%s", tt.config.ServiceInstanceID, tt.config.Region, tt.config.Zone,
+					guid, tt.wantRegion, tt.wantZone)
+			}
+		})
+	}
+}
+
+func TestAccessConfig_CheckWorkspaceZone(t *testing.T) {
+	backend := fake.NewBackend()
+	guid := backend.AddWorkspace("packer", "dal12")
+	server := fake.NewServer(backend)
+	defer server.Close()
+
+	config := common.AccessConfig{APIKey: "api-key", Endpoint: server.URL, ServiceInstanceID: guid, Zone: "dal10"}
+	// Only workspace names are looked up while preparing.
+	if err := config.ResolveWorkspace(context.Background()); err != nil || len(backend.Calls()) != 0 {
+		t.Fatalf("ResolveWorkspace() error = %v, calls = %v", err, backend.Calls())
+	}
+
+	if err := config.CheckWorkspaceZone(context.Background()); err == nil || !strings.Contains(err.Error(), "dal12") {
+		t.Errorf("CheckWorkspaceZone() error = %v, want the zone of the workspace", err)
+	}
+	config.Zone = "dal12"
+	if err := config.CheckWorkspaceZone(context.Background()); err != nil {
+		t.Errorf("CheckWorkspaceZone() error = %v", err)
+	}
+	// A workspace the API key can not list is not checked.
+	config.ServiceInstanceID = "hidden"
+	if err := config.CheckWorkspaceZone(context.Background()); err != nil {
+		t.Errorf("CheckWorkspaceZone() error = %v, want none for a workspace not listed", err)
+	}
+}
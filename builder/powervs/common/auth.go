@@ -0,0 +1,179 @@
+package common
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+)
+
+const (
+	AuthMethodAPIKey         = "api-key"
+	AuthMethodTrustedProfile = "trusted-profile"
+	AuthMethodVPCInstance    = "vpc-instance"
+)
+
+// APIKeyEnvVars are the environment variables the API key is read from when api_key is not set, in order.
+var APIKeyEnvVars = []string{"IBMCLOUD_API_KEY", "IC_API_KEY"}
+
+// prepareAuth validates the options of the auth method and resolves the API key.
+func (c *AccessConfig) prepareAuth() []error {
+	var errs []error
+	if c.AuthMethod == "" {
+		c.AuthMethod = AuthMethodAPIKey
+	}
+
+	switch c.AuthMethod {
+	case AuthMethodAPIKey:
+		switch {
+		case c.APIKey != "" && c.CredentialsFile != "":
+			errs = append(errs, errors.New("only one of api_key or credentials_file can be set"))
+		case c.CredentialsFile != "":
+			key, err := readCredentialsFile(c.CredentialsFile)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			c.APIKey = key
+		case c.APIKey == "":
+			for _, name := range APIKeyEnvVars {
+				if c.APIKey = os.Getenv(name); c.APIKey != "" {
+					break
+				}
+			}
+			if c.APIKey == "" {
+				errs = append(errs, fmt.Errorf("api_key is required with auth_method %s (or set credentials_file, %s)",
+					AuthMethodAPIKey, strings.Join(APIKeyEnvVars, " or ")))
+			}
+		}
+		for _, option := range []struct {
+			name string
+			set  bool
+		}{
+			{"trusted_profile_id", c.TrustedProfileID != ""},
+			{"trusted_profile_name", c.TrustedProfileName != ""},
+			{"cr_token_file", c.CRTokenFile != ""},
+		} {
+			if option.set {
+				errs = append(errs, fmt.Errorf("%s can not be used with auth_method %s", option.name, AuthMethodAPIKey))
+			}
+		}
+	case AuthMethodTrustedProfile:
+		if (c.TrustedProfileID == "") == (c.TrustedProfileName == "") {
+			errs = append(errs, fmt.Errorf("exactly one of trusted_profile_id or trusted_profile_name is required with auth_method %s", AuthMethodTrustedProfile))
+		}
+		errs = append(errs, c.noAPIKey()...)
+	case AuthMethodVPCInstance:
+		if c.TrustedProfileName != "" {
+			errs = append(errs, fmt.Errorf("trusted_profile_name can not be used with auth_method %s, use trusted_profile_id", AuthMethodVPCInstance))
+		}
+		if c.CRTokenFile != "" {
+			errs = append(errs, fmt.Errorf("cr_token_file can not be used with auth_method %s", AuthMethodVPCInstance))
+		}
+		errs = append(errs, c.noAPIKey()...)
+	default:
+		errs = append(errs, fmt.Errorf("invalid auth_method: %s (options: '%s', '%s', '%s')", c.AuthMethod,
+			AuthMethodAPIKey, AuthMethodTrustedProfile, AuthMethodVPCInstance))
+	}
+	return errs
+}
+
+// noAPIKey reports the API key options set with an auth method not using them.
+func (c *AccessConfig) noAPIKey() []error {
+	var errs []error
+	if c.APIKey != "" {
+		errs = append(errs, fmt.Errorf("api_key can only be used with auth_method %s", AuthMethodAPIKey))
+	}
+	if c.CredentialsFile != "" {
+		errs = append(errs, fmt.Errorf("credentials_file can only be used with auth_method %s", AuthMethodAPIKey))
+	}
+	return errs
+}
+
+// readCredentialsFile reads the API key of a file written by `ibmcloud iam api-key-create NAME --file FILE`.
+func readCredentialsFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials_file: %w", err)
+	}
+	var file struct {
+		APIKey string `json:"apikey"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return "", fmt.Errorf("failed to parse credentials_file %s: %w", path, err)
+	}
+	if file.APIKey == "" {
+		return "", fmt.Errorf("credentials_file %s has no apikey", path)
+	}
+	return file.APIKey, nil
+}
+
+// authenticator returns the authenticator of the auth method. It is shared by all the clients, so
+// that they reuse the same IAM token.
+func (c *AccessConfig) authenticator() (core.Authenticator, error) {
+	if c.auth != nil {
+		return c.auth, nil
+	}
+
+	var auth core.Authenticator
+	switch c.AuthMethod {
+	case AuthMethodTrustedProfile:
+		auth = &core.ContainerAuthenticator{
+			CRTokenFilename: c.CRTokenFile,
+			IAMProfileID:    c.TrustedProfileID,
+			IAMProfileName:  c.TrustedProfileName,
+			URL:             c.iamURL(),
+		}
+	case AuthMethodVPCInstance:
+		// The VPC instance metadata service exchanges the instance identity token for an IAM token.
+		auth = &core.VpcInstanceAuthenticator{
+			IAMProfileID: c.TrustedProfileID,
+			URL:          c.Endpoint,
+		}
+	default:
+		auth = &core.IamAuthenticator{
+			ApiKey: c.APIKey,
+			URL:    c.iamURL(),
+		}
+	}
+	if err := auth.Validate(); err != nil {
+		return nil, err
+	}
+	c.auth = auth
+	return auth, nil
+}
+
+// tokenAccount returns the account ID of the IAM token of the authenticator.
+func tokenAccount(auth core.Authenticator) (string, error) {
+	req := &http.Request{Header: make(http.Header)}
+	if err := auth.Authenticate(req); err != nil {
+		return "", err
+	}
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+
+	// An IAM token is a JWT, its claims are the second segment.
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return "", errors.New("the IAM token is not a JWT")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segments[1], "="))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode the IAM token: %w", err)
+	}
+	var claims struct {
+		Account struct {
+			BSS string `json:"bss"`
+		} `json:"account"`
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return "", fmt.Errorf("failed to parse the IAM token: %w", err)
+	}
+	if claims.Account.BSS == "" {
+		return "", errors.New("the IAM token has no account")
+	}
+	return claims.Account.BSS, nil
+}
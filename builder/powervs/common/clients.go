@@ -0,0 +1,78 @@
+package common
+
+import (
+	"context"
+
+	"github.com/IBM-Cloud/power-go-client/clients/instance"
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globalsearchv2"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
+)
+
+// The interfaces below are the subsets of the PowerVS and IBM Cloud clients used by the builder and the
+// cleanup command. Builder.Run stores the clients in the state bag and the steps fetch them through these
+// interfaces, so that they can be faked in tests.
+
+// ImageClient is the subset of *instance.IBMPIImageClient used by the builder.
+type ImageClient interface {
+	Get(id string) (*models.Image, error)
+	GetAll() (*models.Images, error)
+	GetAllStockImages(includeSAP bool, includeVTL bool) (*models.Images, error)
+	Create(body *models.CreateImage) (*models.Image, error)
+	CreateCosImage(body *models.CreateCosImageImportJob) (*models.JobReference, error)
+	ExportImage(id string, body *models.ExportImage) (*models.JobReference, error)
+	Delete(id string) error
+}
+
+// InstanceClient is the subset of *instance.IBMPIInstanceClient used by the builder.
+type InstanceClient interface {
+	Get(id string) (*models.PVMInstance, error)
+	GetAll() (*models.PVMInstances, error)
+	Create(body *models.PVMInstanceCreate) (*models.PVMInstanceList, error)
+	Delete(id string) error
+	Action(id string, body *models.PVMInstanceAction) error
+	CaptureInstanceToImageCatalogV2(id string, body *models.PVMInstanceCapture) (*models.JobReference, error)
+}
+
+// NetworkClient is the subset of *instance.IBMPINetworkClient used by the builder.
+type NetworkClient interface {
+	Get(id string) (*models.Network, error)
+	GetAll() (*models.Networks, error)
+	Create(body *models.NetworkCreate) (*models.Network, error)
+	Delete(id string) error
+}
+
+// JobClient is the subset of *instance.IBMPIJobClient used by the builder.
+type JobClient interface {
+	Get(id string) (*models.Job, error)
+}
+
+// DHCPClient is the subset of *instance.IBMPIDhcpClient used by the builder.
+type DHCPClient interface {
+	Get(id string) (*models.DHCPServerDetail, error)
+	GetAll() (models.DHCPServers, error)
+	Create(body *models.DHCPServerCreate) (*models.DHCPServer, error)
+	Delete(id string) error
+}
+
+// TaggingClient is the subset of *globaltaggingv1.GlobalTaggingV1 used by the builder.
+type TaggingClient interface {
+	AttachTagWithContext(ctx context.Context, options *globaltaggingv1.AttachTagOptions) (*globaltaggingv1.TagResults, *core.DetailedResponse, error)
+	ListTagsWithContext(ctx context.Context, options *globaltaggingv1.ListTagsOptions) (*globaltaggingv1.TagList, *core.DetailedResponse, error)
+}
+
+// SearchClient is the subset of *globalsearchv2.GlobalSearchV2 used by the builder.
+type SearchClient interface {
+	SearchWithContext(ctx context.Context, options *globalsearchv2.SearchOptions) (*globalsearchv2.ScanResult, *core.DetailedResponse, error)
+}
+
+var (
+	_ ImageClient    = (*instance.IBMPIImageClient)(nil)
+	_ InstanceClient = (*instance.IBMPIInstanceClient)(nil)
+	_ NetworkClient  = (*instance.IBMPINetworkClient)(nil)
+	_ JobClient      = (*instance.IBMPIJobClient)(nil)
+	_ DHCPClient     = (*instance.IBMPIDhcpClient)(nil)
+	_ TaggingClient  = (*globaltaggingv1.GlobalTaggingV1)(nil)
+	_ SearchClient   = (*globalsearchv2.GlobalSearchV2)(nil)
+)
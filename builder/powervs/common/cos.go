@@ -0,0 +1,64 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// COSClient is the subset of the S3 API of Cloud Object Storage used by the plugin. PowerVS reads and
+// writes COS with HMAC keys, the plugin does the same through the S3 API.
+type COSClient interface {
+	ListObjectsV2PagesWithContext(ctx context.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error
+	DeleteObjectWithContext(ctx context.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error)
+	GetObjectWithContext(ctx context.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error)
+	HeadObjectWithContext(ctx context.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error)
+}
+
+var _ COSClient = (*s3.S3)(nil)
+
+// COSEndpoint returns the URL of the S3 API of Cloud Object Storage in a region, e.g.
+// `https://s3.us-south.cloud-object-storage.appdomain.cloud`.
+func COSEndpoint(region string, private bool) string {
+	if private {
+		return fmt.Sprintf("https://s3.private.%s.cloud-object-storage.appdomain.cloud", region)
+	}
+	return fmt.Sprintf("https://s3.%s.cloud-object-storage.appdomain.cloud", region)
+}
+
+// NewCOSClient creates a client of the S3 API of Cloud Object Storage at endpoint, authenticated with
+// the HMAC keys of cos.
+func NewCOSClient(cos *CaptureCOS, endpoint string) (*s3.S3, error) {
+	return newCOSClient(credentials.NewStaticCredentials(cos.AccessKey, cos.SecretKey, ""), cos.Region, endpoint)
+}
+
+// NewSourceCOSClient creates a client of the S3 API of Cloud Object Storage at endpoint to read the
+// source object of cos, anonymous when the bucket is public.
+func NewSourceCOSClient(cos *COS, endpoint string) (*s3.S3, error) {
+	creds := credentials.AnonymousCredentials
+	if cos.AccessKey != "" {
+		creds = credentials.NewStaticCredentials(cos.AccessKey, cos.SecretKey, "")
+	}
+	return newCOSClient(creds, cos.Region, endpoint)
+}
+
+func newCOSClient(creds *credentials.Credentials, region, endpoint string) (*s3.S3, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{
+			Credentials: creds,
+			Endpoint:    aws.String(endpoint),
+			// COS ignores the signing region, it only has to be set.
+			Region:           aws.String(region),
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the Cloud Object Storage client: %w", err)
+	}
+	return s3.New(sess), nil
+}
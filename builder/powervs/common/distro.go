@@ -0,0 +1,59 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Distro families of the Linux guests, which share their package manager and configuration layout.
+const (
+	DistroRHEL   = "rhel"
+	DistroSLES   = "sles"
+	DistroUbuntu = "ubuntu"
+)
+
+// distroFamilies maps os-release IDs to their distro family.
+var distroFamilies = map[string]string{
+	"rhel":      DistroRHEL,
+	"centos":    DistroRHEL,
+	"fedora":    DistroRHEL,
+	"rocky":     DistroRHEL,
+	"almalinux": DistroRHEL,
+	"sles":      DistroSLES,
+	"sles_sap":  DistroSLES,
+	"suse":      DistroSLES,
+	"opensuse":  DistroSLES,
+	"ubuntu":    DistroUbuntu,
+	"debian":    DistroUbuntu,
+}
+
+// DetectDistro returns the distro family from the content of /etc/os-release, falling back to
+// ID_LIKE when the ID itself is not known.
+func DetectDistro(osRelease string) (string, error) {
+	var id, idLike string
+	scanner := bufio.NewScanner(strings.NewReader(osRelease))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			id = value
+		case "ID_LIKE":
+			idLike = value
+		}
+	}
+
+	if family, ok := distroFamilies[id]; ok {
+		return family, nil
+	}
+	for _, like := range strings.Fields(idLike) {
+		if family, ok := distroFamilies[like]; ok {
+			return family, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported distro: %q", id)
+}
@@ -0,0 +1,33 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+func TestDetectDistro(t *testing.T) {
+	tests := []struct {
+		name      string
+		osRelease string
+		want      string
+		wantErr   bool
+	}{
+		{name: "rhel", osRelease: "NAME=\"Red Hat Enterprise Linux\"\nID=\"rhel\"\n", want: common.DistroRHEL},
+		{name: "sles", osRelease: "ID=\"sles\"\nID_LIKE=\"suse\"\n", want: common.DistroSLES},
+		{name: "ubuntu", osRelease: "ID=ubuntu\nID_LIKE=debian\n", want: common.DistroUbuntu},
+		{name: "unknown id with known family", osRelease: "ID=ol\nID_LIKE=\"fedora\"\n", want: common.DistroRHEL},
+		{name: "unknown", osRelease: "ID=alpine\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := common.DetectDistro(tt.osRelease)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("common.DetectDistro() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("common.DetectDistro() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
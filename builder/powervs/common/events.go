@@ -0,0 +1,202 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventBuildStarted    = "build_started"
+	EventBuildFinished   = "build_finished"
+	EventStepStarted     = "step_started"
+	EventStepFinished    = "step_finished"
+	EventCleanupStarted  = "cleanup_started"
+	EventCleanupFinished = "cleanup_finished"
+	EventResourceCreated = "resource_created"
+	EventResourceDeleted = "resource_deleted"
+	EventJobProgress     = "job_progress"
+	EventError           = "error"
+)
+
+// Event is a line of the event log.
+type Event struct {
+	Time              time.Time `json:"time"`
+	Type              string    `json:"type"`
+	Build             string    `json:"build,omitempty"`
+	Zone              string    `json:"zone,omitempty"`
+	ServiceInstanceID string    `json:"service_instance_id,omitempty"`
+	Step              string    `json:"step,omitempty"`
+	// DurationMS is the duration of the step for step_finished and cleanup_finished, of the build for
+	// build_finished, of the job so far for job_progress, and the time since the step started for
+	// the other events.
+	DurationMS   int64    `json:"duration_ms"`
+	ResourceType string   `json:"resource_type,omitempty"`
+	ResourceID   string   `json:"resource_id,omitempty"`
+	ResourceName string   `json:"resource_name,omitempty"`
+	JobID        string   `json:"job_id,omitempty"`
+	JobState     string   `json:"job_state,omitempty"`
+	Progress     *float64 `json:"progress,omitempty"`
+	Message      string   `json:"message,omitempty"`
+	Halted       bool     `json:"halted,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	RequestID    string   `json:"request_id,omitempty"`
+}
+
+// EventLog appends the events of a build to a file as newline-delimited JSON, for dashboards to follow
+// the progress of builds. Several builds can share the file. A nil EventLog discards the events.
+type EventLog struct {
+	build             string
+	zone              string
+	serviceInstanceID string
+
+	mu        sync.Mutex
+	file      *os.File
+	started   time.Time
+	step      string
+	stepStart time.Time
+	jobs      map[string]time.Time
+}
+
+// OpenEventLog opens the event log at path for the build in the workspace of the AccessConfig. It
+// returns a nil EventLog when path is empty.
+func OpenEventLog(path, build string, c *AccessConfig) (*EventLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create event_log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event_log: %w", err)
+	}
+	now := time.Now()
+	return &EventLog{
+		build:             build,
+		zone:              c.Zone,
+		serviceInstanceID: c.ServiceInstanceID,
+		file:              file,
+		started:           now,
+		stepStart:         now,
+		jobs:              map[string]time.Time{},
+	}, nil
+}
+
+// StepStarted records the start of a step, or of its cleanup when cleanup is set.
+func (l *EventLog) StepStarted(step string, cleanup bool) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.step, l.stepStart = step, time.Now()
+	l.mu.Unlock()
+	eventType := EventStepStarted
+	if cleanup {
+		eventType = EventCleanupStarted
+	}
+	l.Emit(Event{Type: eventType})
+}
+
+// StepFinished records the end of a step, or of its cleanup when cleanup is set, with its duration.
+// halted tells that the step halted the build.
+func (l *EventLog) StepFinished(cleanup bool, halted bool) {
+	if l == nil {
+		return
+	}
+	eventType := EventStepFinished
+	if cleanup {
+		eventType = EventCleanupFinished
+	}
+	l.Emit(Event{Type: eventType, Halted: halted})
+}
+
+// ResourceCreated records a resource created by the build.
+func (l *EventLog) ResourceCreated(resourceType, id, name string) {
+	l.Emit(Event{Type: EventResourceCreated, ResourceType: resourceType, ResourceID: id, ResourceName: name})
+}
+
+// ResourceDeleted records a resource deleted by the build.
+func (l *EventLog) ResourceDeleted(resourceType, id string) {
+	l.Emit(Event{Type: EventResourceDeleted, ResourceType: resourceType, ResourceID: id})
+}
+
+// JobProgress records the state of a PowerVS job. progress is the percentage reported by the API,
+// e.g. "45" or "45%".
+func (l *EventLog) JobProgress(id, state, progress, message string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	start, ok := l.jobs[id]
+	if !ok {
+		start = time.Now()
+		l.jobs[id] = start
+	}
+	l.mu.Unlock()
+
+	event := Event{
+		Type:       EventJobProgress,
+		JobID:      id,
+		JobState:   state,
+		Message:    message,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if p, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(progress), "%"), 64); err == nil {
+		event.Progress = &p
+	}
+	l.Emit(event)
+}
+
+// Error records an error, with the ID of the API request that failed when there is one.
+func (l *EventLog) Error(err error) {
+	l.Emit(Event{Type: EventError, Error: err.Error(), RequestID: RequestID(err)})
+}
+
+// Emit writes an event. The time, build, workspace, step and duration of the event are filled in, see
+// Event.DurationMS. Failures to write are logged: the event log never fails a build.
+func (l *EventLog) Emit(e Event) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Time = time.Now().UTC()
+	e.Build = l.build
+	e.Zone = l.zone
+	e.ServiceInstanceID = l.serviceInstanceID
+	switch e.Type {
+	case EventBuildStarted, EventBuildFinished:
+		e.DurationMS = time.Since(l.started).Milliseconds()
+	case EventJobProgress:
+		e.Step = l.step
+	default:
+		e.Step = l.step
+		e.DurationMS = time.Since(l.stepStart).Milliseconds()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("[WARN] failed to encode event %s: %v", e.Type, err)
+		return
+	}
+	// A single write per line keeps the lines of builds sharing the file whole.
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		log.Printf("[WARN] failed to write event %s to %s: %v", e.Type, l.file.Name(), err)
+	}
+}
+
+// Close closes the event log file.
+func (l *EventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
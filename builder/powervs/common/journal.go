@@ -0,0 +1,170 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	ResourceTypeInstance   = "instance"
+	ResourceTypeDHCPServer = "dhcp-server"
+	ResourceTypeNetwork    = "network"
+	ResourceTypeImage      = "image"
+	// ResourceTypeImageImport is a COS image import job, recorded with the name of the image it
+	// imports until the image is known.
+	ResourceTypeImageImport = "image-import"
+)
+
+// ResourceTypesDeleteOrder is the order resources have to be deleted in: instances hold on to networks,
+// and DHCP servers delete their own network.
+var ResourceTypesDeleteOrder = []string{
+	ResourceTypeInstance,
+	ResourceTypeDHCPServer,
+	ResourceTypeNetwork,
+	ResourceTypeImage,
+	ResourceTypeImageImport,
+}
+
+// JournalEntry is a resource created by a build.
+type JournalEntry struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Journal records the resources a build creates in a local JSON file as soon as they are created, so they
+// can still be deleted with `packer-plugin-powervs cleanup --journal` when the plugin dies before its cleanup ran.
+// Entries are removed as the steps delete their resources.
+type Journal struct {
+	Region            string         `json:"region,omitempty"`
+	Zone              string         `json:"zone"`
+	ServiceInstanceID string         `json:"service_instance_id"`
+	Resources         []JournalEntry `json:"resources"`
+
+	path string
+	// owned is set once the file holds this journal, Finish never removes a file it does not own.
+	owned bool
+	mu    sync.Mutex
+}
+
+// NewJournal creates an empty journal for the workspace of the AccessConfig. The file is written on the first Add.
+func NewJournal(path string, c *AccessConfig) *Journal {
+	return &Journal{
+		Region:            c.Region,
+		Zone:              c.Zone,
+		ServiceInstanceID: c.ServiceInstanceID,
+		path:              path,
+	}
+}
+
+// OpenJournal creates a journal for the workspace of the AccessConfig, keeping the resources recorded at
+// path by an earlier build that did not clean up. The journal of another workspace is an error, its
+// resources would be lost.
+func OpenJournal(path string, c *AccessConfig) (*Journal, error) {
+	j := NewJournal(path, c)
+	earlier, err := ReadJournal(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(earlier.Resources) != 0 && (earlier.Zone != j.Zone || earlier.ServiceInstanceID != j.ServiceInstanceID) {
+		return nil, fmt.Errorf("the journal %s holds resources of the workspace %s/%s, delete them with "+
+			"packer-plugin-powervs cleanup --journal %s --force or set another cleanup_journal",
+			path, earlier.Zone, earlier.ServiceInstanceID, path)
+	}
+	j.Resources = earlier.Resources
+	j.owned = true
+	return j, nil
+}
+
+// ReadJournal reads the journal file at path.
+func ReadJournal(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{path: path, owned: true}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("failed to parse journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// Path returns the path of the journal file.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Add records a created resource and writes the journal.
+func (j *Journal) Add(resourceType, id, name string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.index(resourceType, id) != -1 {
+		return nil
+	}
+	j.Resources = append(j.Resources, JournalEntry{Type: resourceType, ID: id, Name: name, CreatedAt: time.Now().UTC()})
+	return j.write()
+}
+
+// Remove forgets a deleted resource and writes the journal.
+func (j *Journal) Remove(resourceType, id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	i := j.index(resourceType, id)
+	if i == -1 {
+		return nil
+	}
+	j.Resources = slices.Delete(j.Resources, i, i+1)
+	return j.write()
+}
+
+// Finish removes the journal file when every resource has been deleted and returns the number of
+// resources left otherwise.
+func (j *Journal) Finish() (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.Resources) != 0 {
+		return len(j.Resources), nil
+	}
+	if !j.owned {
+		return 0, nil
+	}
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func (j *Journal) index(resourceType, id string) int {
+	return slices.IndexFunc(j.Resources, func(e JournalEntry) bool {
+		return e.Type == resourceType && e.ID == id
+	})
+}
+
+// write replaces the journal file through a rename, so a crash never leaves a truncated journal behind.
+func (j *Journal) write() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	j.owned = true
+	return nil
+}
@@ -0,0 +1,63 @@
+package common_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+func TestOpenJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	access := &common.AccessConfig{Zone: "dal10", ServiceInstanceID: "workspace"}
+
+	// An interrupted build leaves its network behind.
+	interrupted := common.NewJournal(path, access)
+	if err := interrupted.Add(common.ResourceTypeNetwork, "network-1", "packer-network"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next build cleans up everything it created, and keeps the network in the journal.
+	journal, err := common.OpenJournal(path, access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Add(common.ResourceTypeInstance, "instance-1", "packer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Remove(common.ResourceTypeInstance, "instance-1"); err != nil {
+		t.Fatal(err)
+	}
+	if left, err := journal.Finish(); err != nil || left != 1 {
+		t.Fatalf("Finish() = %d, %v, want the network left", left, err)
+	}
+	read, err := common.ReadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Resources) != 1 || read.Resources[0].ID != "network-1" {
+		t.Errorf("journal = %+v, want the network of the interrupted build", read.Resources)
+	}
+
+	// The journal of another workspace is not taken over.
+	if _, err := common.OpenJournal(path, &common.AccessConfig{Zone: "wdc06", ServiceInstanceID: "other"}); err == nil {
+		t.Error("OpenJournal() of another workspace succeeded")
+	}
+}
+
+func TestJournal_FinishUnowned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	if err := os.WriteFile(path, []byte("not a journal"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A journal that never wrote its file leaves it alone.
+	journal := common.NewJournal(path, &common.AccessConfig{})
+	if left, err := journal.Finish(); err != nil || left != 0 {
+		t.Fatalf("Finish() = %d, %v", left, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file removed: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/go-openapi/runtime"
+)
+
+// requestIDHeaders are the response headers the IBM Cloud APIs return the ID of a request in, in
+// order of preference.
+var requestIDHeaders = []string{"X-Request-Id", "X-Correlation-Id"}
+
+// RequestError is a failed API call with the ID the API gave to its request, to quote to IBM Cloud support.
+type RequestError struct {
+	Err       error
+	RequestID string
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%v (request ID: %s)", e.Err, e.RequestID)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// RequestID returns the ID of the API request err failed with, empty when it is not known.
+func RequestID(err error) string {
+	var requestErr *RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.RequestID
+	}
+	return ""
+}
+
+// maxFailedResponses is the number of failed responses requestIDTransport remembers the request ID of.
+const maxFailedResponses = 32
+
+// requestIDTransport remembers the request IDs of the failed responses of the PowerVS session, keyed by
+// their error payload. The PowerVS client drops the headers of the responses it has an error type for,
+// so the ID can not be read from the error, but the error quotes the payload of the response: the ID of
+// a failed call is the one of the response whose payload its error quotes. Concurrent calls sharing the
+// session, e.g. the builds of several targets, each find the ID of their own response.
+type requestIDTransport struct {
+	http.RoundTripper
+
+	mu     sync.Mutex
+	failed []failedResponse
+}
+
+// failedResponse is the request ID of a failed response and its payload, as the PowerVS client quotes it.
+type failedResponse struct {
+	payload string
+	id      string
+}
+
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.RoundTripper.RoundTrip(req)
+	if err != nil || res.StatusCode < http.StatusBadRequest {
+		return res, err
+	}
+	var id string
+	for _, header := range requestIDHeaders {
+		if id = res.Header.Get(header); id != "" {
+			break
+		}
+	}
+	if id == "" {
+		return res, err
+	}
+	body, readErr := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if readErr != nil {
+		return res, err
+	}
+	// The PowerVS client quotes the payload it decoded, encoded again.
+	var payload models.Error
+	if json.Unmarshal(body, &payload) != nil || payload == (models.Error{}) {
+		return res, err
+	}
+	quoted, _ := json.Marshal(&payload)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.failed) == maxFailedResponses {
+		t.failed = t.failed[1:]
+	}
+	t.failed = append(t.failed, failedResponse{payload: string(quoted), id: id})
+	return res, err
+}
+
+// find returns and forgets the request ID of the most recent failed response quoted by err, empty when
+// err quotes none.
+func (t *requestIDTransport) find(err error) string {
+	if t == nil || err == nil {
+		return ""
+	}
+	// The errors of the status codes the client has no error type for keep the response.
+	var apiErr *runtime.APIError
+	if errors.As(err, &apiErr) {
+		if res, ok := apiErr.Response.(runtime.ClientResponse); ok {
+			for _, header := range requestIDHeaders {
+				if id := res.GetHeader(header); id != "" {
+					return id
+				}
+			}
+		}
+	}
+	message := err.Error()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := len(t.failed) - 1; i >= 0; i-- {
+		if strings.Contains(message, t.failed[i].payload) {
+			id := t.failed[i].id
+			t.failed = slices.Delete(t.failed, i, i+1)
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,312 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/go-openapi/runtime"
+)
+
+// DefaultMaxRetries is the number of times a failed API call is retried when max_retries is not set.
+const DefaultMaxRetries = 5
+
+var (
+	// RetryBaseDelay is the time before the first retry of a failed API call, doubled for every other
+	// retry up to RetryMaxDelay. A Retry-After header of the response takes precedence.
+	RetryBaseDelay = 2 * time.Second
+	RetryMaxDelay  = time.Minute
+)
+
+// callKind tells which errors a call can be retried on.
+type callKind int
+
+const (
+	// callRead is a call without side effects, retried on any transient error.
+	callRead callKind = iota
+	// callWrite is a call with side effects, only retried when the API rejected it without acting on
+	// it, so that a retry can not create a resource twice.
+	callWrite
+)
+
+// APIErrorCode returns the HTTP status of a failed PowerVS API call, 0 when err is not an API error.
+func APIErrorCode(err error) int {
+	// The response readers of the PowerVS client return a typed error for the statuses documented by
+	// the API, and a *runtime.APIError for the others.
+	var typed interface{ Code() int }
+	if errors.As(err, &typed) {
+		return typed.Code()
+	}
+	var apiErr *runtime.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
+// retryable tells whether a call of the kind failing with err can be retried.
+func retryable(kind callKind, err error) bool {
+	switch APIErrorCode(err) {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable:
+		// The request did not reach the service or was throttled before being processed.
+		return true
+	case http.StatusInternalServerError, http.StatusGatewayTimeout:
+		// The request may have been processed.
+		return kind == callRead
+	case 0:
+		var netErr net.Error
+		return kind == callRead && (errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF))
+	}
+	return false
+}
+
+// retryAfter returns the delay asked by the Retry-After header of the response of a failed call.
+func retryAfter(err error) (time.Duration, bool) {
+	var apiErr *runtime.APIError
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	response, ok := apiErr.Response.(runtime.ClientResponse)
+	if !ok {
+		return 0, false
+	}
+	return parseRetryAfter(response.GetHeader("Retry-After"))
+}
+
+// parseRetryAfter parses a Retry-After header, a number of seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// Retrier retries the PowerVS API calls failing with transient errors: throttling (429), unavailable
+// services (502, 503) and, for the calls without side effects, server errors (500, 504) and network
+// errors. It waits for the Retry-After of the response, or else backs off exponentially.
+type Retrier struct {
+	ctx        context.Context
+	maxRetries int
+	requests   *requestIDTransport
+}
+
+// Retrier returns the Retrier of the max_retries option. The context stops the waits between retries.
+func (c *AccessConfig) Retrier(ctx context.Context) *Retrier {
+	return &Retrier{ctx: ctx, maxRetries: c.maxRetries(), requests: c.requests}
+}
+
+// maxRetries returns the number of retries of a failed API call, 0 when retries are disabled.
+func (c *AccessConfig) maxRetries() int {
+	switch {
+	case c.MaxRetries == 0:
+		return DefaultMaxRetries
+	case c.MaxRetries < 0:
+		return 0
+	}
+	return c.MaxRetries
+}
+
+// do calls fn until it succeeds, fails with an error that can not be retried or the retries are
+// exhausted. The last error is returned as a *RequestError when the API gave an ID to its request.
+func (r *Retrier) do(name string, kind callKind, fn func() error) error {
+	delay := RetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		id := r.requests.find(err)
+		if attempt >= r.maxRetries || !retryable(kind, err) {
+			if id != "" {
+				err = &RequestError{Err: err, RequestID: id}
+			}
+			if attempt > 0 {
+				return fmt.Errorf("%s failed after %d attempts: %w", name, attempt+1, err)
+			}
+			return err
+		}
+
+		wait, ok := retryAfter(err)
+		if !ok {
+			wait = delay
+			delay = min(2*delay, RetryMaxDelay)
+		}
+		log.Printf("[WARN] %s failed, retrying in %s (%d/%d): %v", name, wait, attempt+1, r.maxRetries, err)
+		select {
+		case <-time.After(wait):
+		case <-r.ctx.Done():
+			return fmt.Errorf("%s: %w (last error: %v)", name, r.ctx.Err(), err)
+		}
+	}
+}
+
+// retry calls fn through r.do and returns its result.
+func retry[T any](r *Retrier, name string, kind callKind, fn func() (T, error)) (T, error) {
+	var result T
+	err := r.do(name, kind, func() (err error) {
+		result, err = fn()
+		return err
+	})
+	return result, err
+}
+
+// ImageClient returns a client retrying the calls of client.
+func (r *Retrier) ImageClient(client ImageClient) ImageClient {
+	return retryImageClient{r, client}
+}
+
+// InstanceClient returns a client retrying the calls of client.
+func (r *Retrier) InstanceClient(client InstanceClient) InstanceClient {
+	return retryInstanceClient{r, client}
+}
+
+// NetworkClient returns a client retrying the calls of client.
+func (r *Retrier) NetworkClient(client NetworkClient) NetworkClient {
+	return retryNetworkClient{r, client}
+}
+
+// JobClient returns a client retrying the calls of client.
+func (r *Retrier) JobClient(client JobClient) JobClient {
+	return retryJobClient{r, client}
+}
+
+// DHCPClient returns a client retrying the calls of client.
+func (r *Retrier) DHCPClient(client DHCPClient) DHCPClient {
+	return retryDHCPClient{r, client}
+}
+
+type retryImageClient struct {
+	r      *Retrier
+	client ImageClient
+}
+
+func (c retryImageClient) Get(id string) (*models.Image, error) {
+	return retry(c.r, "ImageClient.Get", callRead, func() (*models.Image, error) { return c.client.Get(id) })
+}
+
+func (c retryImageClient) GetAll() (*models.Images, error) {
+	return retry(c.r, "ImageClient.GetAll", callRead, c.client.GetAll)
+}
+
+func (c retryImageClient) GetAllStockImages(includeSAP bool, includeVTL bool) (*models.Images, error) {
+	return retry(c.r, "ImageClient.GetAllStockImages", callRead, func() (*models.Images, error) {
+		return c.client.GetAllStockImages(includeSAP, includeVTL)
+	})
+}
+
+func (c retryImageClient) Create(body *models.CreateImage) (*models.Image, error) {
+	return retry(c.r, "ImageClient.Create", callWrite, func() (*models.Image, error) { return c.client.Create(body) })
+}
+
+func (c retryImageClient) CreateCosImage(body *models.CreateCosImageImportJob) (*models.JobReference, error) {
+	return retry(c.r, "ImageClient.CreateCosImage", callWrite, func() (*models.JobReference, error) {
+		return c.client.CreateCosImage(body)
+	})
+}
+
+func (c retryImageClient) ExportImage(id string, body *models.ExportImage) (*models.JobReference, error) {
+	return retry(c.r, "ImageClient.ExportImage", callWrite, func() (*models.JobReference, error) {
+		return c.client.ExportImage(id, body)
+	})
+}
+
+func (c retryImageClient) Delete(id string) error {
+	return c.r.do("ImageClient.Delete", callWrite, func() error { return c.client.Delete(id) })
+}
+
+type retryInstanceClient struct {
+	r      *Retrier
+	client InstanceClient
+}
+
+func (c retryInstanceClient) Get(id string) (*models.PVMInstance, error) {
+	return retry(c.r, "InstanceClient.Get", callRead, func() (*models.PVMInstance, error) { return c.client.Get(id) })
+}
+
+func (c retryInstanceClient) GetAll() (*models.PVMInstances, error) {
+	return retry(c.r, "InstanceClient.GetAll", callRead, c.client.GetAll)
+}
+
+func (c retryInstanceClient) Create(body *models.PVMInstanceCreate) (*models.PVMInstanceList, error) {
+	return retry(c.r, "InstanceClient.Create", callWrite, func() (*models.PVMInstanceList, error) {
+		return c.client.Create(body)
+	})
+}
+
+func (c retryInstanceClient) Delete(id string) error {
+	return c.r.do("InstanceClient.Delete", callWrite, func() error { return c.client.Delete(id) })
+}
+
+func (c retryInstanceClient) Action(id string, body *models.PVMInstanceAction) error {
+	return c.r.do("InstanceClient.Action", callWrite, func() error { return c.client.Action(id, body) })
+}
+
+func (c retryInstanceClient) CaptureInstanceToImageCatalogV2(id string, body *models.PVMInstanceCapture) (*models.JobReference, error) {
+	return retry(c.r, "InstanceClient.CaptureInstanceToImageCatalogV2", callWrite, func() (*models.JobReference, error) {
+		return c.client.CaptureInstanceToImageCatalogV2(id, body)
+	})
+}
+
+type retryNetworkClient struct {
+	r      *Retrier
+	client NetworkClient
+}
+
+func (c retryNetworkClient) Get(id string) (*models.Network, error) {
+	return retry(c.r, "NetworkClient.Get", callRead, func() (*models.Network, error) { return c.client.Get(id) })
+}
+
+func (c retryNetworkClient) GetAll() (*models.Networks, error) {
+	return retry(c.r, "NetworkClient.GetAll", callRead, c.client.GetAll)
+}
+
+func (c retryNetworkClient) Create(body *models.NetworkCreate) (*models.Network, error) {
+	return retry(c.r, "NetworkClient.Create", callWrite, func() (*models.Network, error) { return c.client.Create(body) })
+}
+
+func (c retryNetworkClient) Delete(id string) error {
+	return c.r.do("NetworkClient.Delete", callWrite, func() error { return c.client.Delete(id) })
+}
+
+type retryJobClient struct {
+	r      *Retrier
+	client JobClient
+}
+
+func (c retryJobClient) Get(id string) (*models.Job, error) {
+	return retry(c.r, "JobClient.Get", callRead, func() (*models.Job, error) { return c.client.Get(id) })
+}
+
+type retryDHCPClient struct {
+	r      *Retrier
+	client DHCPClient
+}
+
+func (c retryDHCPClient) Get(id string) (*models.DHCPServerDetail, error) {
+	return retry(c.r, "DHCPClient.Get", callRead, func() (*models.DHCPServerDetail, error) { return c.client.Get(id) })
+}
+
+func (c retryDHCPClient) GetAll() (models.DHCPServers, error) {
+	return retry(c.r, "DHCPClient.GetAll", callRead, c.client.GetAll)
+}
+
+func (c retryDHCPClient) Create(body *models.DHCPServerCreate) (*models.DHCPServer, error) {
+	return retry(c.r, "DHCPClient.Create", callWrite, func() (*models.DHCPServer, error) { return c.client.Create(body) })
+}
+
+func (c retryDHCPClient) Delete(id string) error {
+	return c.r.do("DHCPClient.Delete", callWrite, func() error { return c.client.Delete(id) })
+}
@@ -0,0 +1,155 @@
+package common_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+// testImageClient returns an image client of the stand-in retrying its calls up to maxRetries times.
+func testImageClient(t *testing.T, server *fake.Server, maxRetries int) common.ImageClient {
+	config := &common.AccessConfig{
+		APIKey:            "api-key",
+		Zone:              "dal10",
+		ServiceInstanceID: "workspace",
+		Endpoint:          server.URL,
+		MaxRetries:        maxRetries,
+	}
+	client, err := config.ImageClient(context.Background(), config.ServiceInstanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config.Retrier(context.Background()).ImageClient(client)
+}
+
+func TestRetrier(t *testing.T) {
+	old := common.RetryBaseDelay
+	common.RetryBaseDelay = time.Millisecond
+	t.Cleanup(func() { common.RetryBaseDelay = old })
+
+	getAll := func(client common.ImageClient, _ string) error {
+		_, err := client.GetAll()
+		return err
+	}
+	create := func(client common.ImageClient, stockImageID string) error {
+		_, err := client.Create(&models.CreateImage{ImageName: "image", ImageID: stockImageID})
+		return err
+	}
+	tests := []struct {
+		name       string
+		route      string
+		status     int
+		count      int
+		maxRetries int
+		call       func(client common.ImageClient, stockImageID string) error
+		wantCode   int
+	}{
+		{name: "read on 500", route: "ImageClient.GetAll", status: http.StatusInternalServerError, count: 2, call: getAll},
+		{name: "read on 504", route: "ImageClient.GetAll", status: http.StatusGatewayTimeout, count: 1, call: getAll},
+		{name: "create on 503", route: "ImageClient.Create", status: http.StatusServiceUnavailable, count: 2, call: create},
+		{name: "create on 429", route: "ImageClient.Create", status: http.StatusTooManyRequests, count: 2, call: create},
+		{name: "no create retry on 500", route: "ImageClient.Create", status: http.StatusInternalServerError, count: 1, call: create, wantCode: http.StatusInternalServerError},
+		{name: "no retry on 400", route: "ImageClient.GetAll", status: http.StatusBadRequest, count: 1, call: getAll, wantCode: http.StatusBadRequest},
+		{name: "exhausted", route: "ImageClient.GetAll", status: http.StatusServiceUnavailable, count: 3, maxRetries: 2, call: getAll, wantCode: http.StatusServiceUnavailable},
+		{name: "disabled", route: "ImageClient.GetAll", status: http.StatusServiceUnavailable, count: 1, maxRetries: -1, call: getAll, wantCode: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := fake.NewBackend()
+			stockImageID := backend.AddStockImage("stock", "rhel")
+			server := fake.NewServer(backend)
+			defer server.Close()
+			client := testImageClient(t, server, tt.maxRetries)
+			server.FailTimes(tt.route, tt.status, tt.count)
+
+			err := tt.call(client, stockImageID)
+			if code := common.APIErrorCode(err); code != tt.wantCode {
+				t.Errorf("error = %v (status %d), want status %d", err, code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRetrier_RetryAfter(t *testing.T) {
+	old := common.RetryBaseDelay
+	common.RetryBaseDelay = time.Millisecond
+	t.Cleanup(func() { common.RetryBaseDelay = old })
+
+	backend := fake.NewBackend()
+	stockImageID := backend.AddStockImage("stock", "rhel")
+	server := fake.NewServer(backend)
+	defer server.Close()
+	client := testImageClient(t, server, 0)
+	// Get a token before timing the calls.
+	if _, err := client.GetAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	server.Throttle("ImageClient.Create", 1, time.Second)
+	start := time.Now()
+	if _, err := client.Create(&models.CreateImage{ImageName: "image", ImageID: stockImageID}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want the Retry-After of 1s", elapsed)
+	}
+	if ids := backend.ImageIDs(); len(ids) != 1 {
+		t.Errorf("images = %v, want one created image", ids)
+	}
+}
+
+func TestRetrier_Canceled(t *testing.T) {
+	server := fake.NewServer(fake.NewBackend())
+	defer server.Close()
+	config := &common.AccessConfig{APIKey: "api-key", Zone: "dal10", ServiceInstanceID: "workspace", Endpoint: server.URL}
+	client, err := config.ImageClient(context.Background(), config.ServiceInstanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	retrying := config.Retrier(ctx).ImageClient(client)
+
+	// The wait for the Retry-After is interrupted by the cancellation.
+	server.Throttle("ImageClient.GetAll", 1, time.Hour)
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := retrying.GetAll(); err == nil {
+		t.Fatal("GetAll() succeeded, want the cancellation")
+	}
+}
+
+func TestRetrier_RequestID(t *testing.T) {
+	backend := fake.NewBackend()
+	server := fake.NewServer(backend)
+	defer server.Close()
+	client := testImageClient(t, server, -1)
+	// Get a token before timing the calls.
+	if _, err := client.GetAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first call fails after the second one, each error has the ID of its own request.
+	server.Delay("ImageClient.GetAll", 50*time.Millisecond)
+	server.Fail("ImageClient.GetAll", http.StatusBadRequest)
+	first := make(chan error)
+	go func() {
+		_, err := client.GetAll()
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_, secondErr := client.Get("missing")
+	firstErr := <-first
+
+	firstID, secondID := common.RequestID(firstErr), common.RequestID(secondErr)
+	if firstID == "" || secondID == "" || firstID == secondID {
+		t.Fatalf("request IDs = %q and %q, want one per request", firstID, secondID)
+	}
+	// The fake numbers the requests in the order they arrive.
+	if firstID > secondID {
+		t.Errorf("request IDs = %q and %q, want the ID of the first request first", firstID, secondID)
+	}
+}
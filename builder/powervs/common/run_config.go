@@ -4,13 +4,56 @@
 package common
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 )
 
+const (
+	// ShutdownBehaviorSoftStop powers the instance off from inside the OS with the shutdown_command.
+	ShutdownBehaviorSoftStop = "soft-stop"
+	// ShutdownBehaviorImmediateShutdown sends the PowerVS immediate-shutdown action.
+	ShutdownBehaviorImmediateShutdown = "immediate-shutdown"
+	// ShutdownBehaviorStop sends the PowerVS stop action.
+	ShutdownBehaviorStop = "stop"
+	// ShutdownBehaviorNone leaves the instance running for capture.
+	ShutdownBehaviorNone = "none"
+
+	// GeneralizeCloudInit resets the cloud-init state and logs.
+	GeneralizeCloudInit = "cloud-init"
+	// GeneralizeMachineID empties the machine-id so it is regenerated on first boot.
+	GeneralizeMachineID = "machine-id"
+	// GeneralizeSSHHostKeys removes the SSH host keys so they are regenerated on first boot.
+	GeneralizeSSHHostKeys = "ssh-host-keys"
+	// GeneralizeRMCNodeID resets the RSCT node ID used by RMC.
+	GeneralizeRMCNodeID = "rmc-node-id"
+)
+
+const (
+	PinPolicyNone = "none"
+	PinPolicySoft = "soft"
+	PinPolicyHard = "hard"
+
+	AffinityPolicyAffinity     = "affinity"
+	AffinityPolicyAntiAffinity = "anti-affinity"
+
+	// MaxTagLength is the longest `key:value` tag accepted by the Global Tagging API.
+	MaxTagLength = 128
+)
+
+// GeneralizeStepsDefault is the ordered list of generalize tasks run when generalize_steps is not set.
+var GeneralizeStepsDefault = []string{
+	GeneralizeCloudInit,
+	GeneralizeMachineID,
+	GeneralizeSSHHostKeys,
+	GeneralizeRMCNodeID,
+}
+
 type Source struct {
 	Name       string      `mapstructure:"name" required:"false"`
 	COS        *COS        `mapstructure:"cos" required:"false"`
@@ -21,6 +64,10 @@ type COS struct {
 	Bucket string `mapstructure:"bucket" required:"true"`
 	Object string `mapstructure:"object" required:"true"`
 	Region string `mapstructure:"region" required:"true"`
+	// HMAC access key of a private bucket. The bucket is read as a public bucket when it is not set.
+	AccessKey string `mapstructure:"access_key" required:"false"`
+	// HMAC secret key of a private bucket, required with access_key.
+	SecretKey string `mapstructure:"secret_key" required:"false"`
 }
 
 type StockImage struct {
@@ -33,8 +80,28 @@ type Capture struct {
 	// if image-catalog is specified then cos field content will be ignored
 	Destination string      `mapstructure:"destination" required:"false"`
 	COS         *CaptureCOS `mapstructure:"cos" required:"false"`
+
+	// NameSuffix versions the captured image: the suffix is appended to the name with a dash.
+	// Options: ('timestamp', 'build-number'). 'timestamp' is the UTC time of the capture, e.g.
+	// `20261019061315`, 'build-number' is one more than the highest number of the catalog images named
+	// `<name>-<number>`. The default is no suffix.
+	NameSuffix string `mapstructure:"name_suffix" required:"false"`
+	// ForceDeregister deletes the other catalog images with the name of the captured image once the
+	// capture succeeded. Requires a destination including the image catalog. Default: false
+	ForceDeregister bool `mapstructure:"force_deregister" required:"false"`
+	// KeepLastN deletes the oldest catalog images of the series once the capture succeeded, so that only
+	// the N most recent ones are left, including the captured image. The series is the images named
+	// after the capture name, followed by the suffix of `name_suffix` if any: `<name>-<number>` or
+	// `<name>-<timestamp>`. Requires a destination including the image catalog. The default is 0, to
+	// keep them all.
+	KeepLastN int `mapstructure:"keep_last_n" required:"false"`
 }
 
+const (
+	NameSuffixTimestamp   = "timestamp"
+	NameSuffixBuildNumber = "build-number"
+)
+
 type CaptureCOS struct {
 	Bucket    string `mapstructure:"bucket" required:"true"`
 	Region    string `mapstructure:"region" required:"true"`
@@ -57,6 +124,85 @@ type RunConfig struct {
 	// Default: 10 minutes
 	CleanupTimeout string `mapstructure:"cleanup_timeout" required:"false"`
 
+	// CleanupJournal is the path of the JSON file the build records the resources it creates in, as soon as
+	// they are created. Resources are removed from it as they are deleted, and the file is removed at the end
+	// of a build that cleaned up everything. When the plugin is killed or cleanup fails, run
+	// `packer-plugin-powervs cleanup --journal <path> --force` to delete what is left.
+	// Default: `powervs/<build name>-<instance_name>-<plugin PID>.journal.json` in the Packer cache directory,
+	// one journal per build.
+	CleanupJournal string `mapstructure:"cleanup_journal" required:"false"`
+
+	// EventLog is the path of a file the build appends newline-delimited JSON events to: steps started
+	// and finished, resources created and deleted, progress of the PowerVS jobs and errors with the ID
+	// of the failed API request. Every event carries the build name, the zone and a duration in
+	// milliseconds. Builds can share the file.
+	EventLog string `mapstructure:"event_log" required:"false"`
+
+	// ShutdownCommand is run on the instance through the communicator to power it off
+	// from inside the OS before capture, giving the filesystems a chance to sync.
+	// Setting it implies `shutdown_behavior = "soft-stop"` unless a behavior is given.
+	// The default depends on the OS of the source image: `shutdown -h now` for Linux, `shutdown -F` for AIX
+	// and `PWRDWNSYS` for IBM i. The Linux and AIX defaults run with sudo when the SSH user is not root.
+	// The build fails when the command exits with an error before the instance is off.
+	ShutdownCommand string `mapstructure:"shutdown_command" required:"false"`
+	// ShutdownBehavior determines how the instance is powered off before capture.
+	// Options: ('soft-stop', 'immediate-shutdown', 'stop', 'none'). The default depends on the OS of the
+	// source image: 'stop' for Linux and 'soft-stop' for AIX and IBM i.
+	// 'soft-stop' runs the shutdown_command in the guest and waits for the instance to power off,
+	// 'immediate-shutdown' and 'stop' send the matching PowerVS instance action,
+	// 'none' captures the instance without powering it off.
+	ShutdownBehavior string `mapstructure:"shutdown_behavior" required:"false"`
+	// ShutdownTimeout specifies the maximum time to wait for the instance to reach the SHUTOFF state.
+	// Format: duration string (e.g., "10m", "15m30s")
+	// Default: 6 minutes
+	ShutdownTimeout string `mapstructure:"shutdown_timeout" required:"false"`
+
+	// PlacementGroup is the ID of the placement group the instance is added to, e.g. one with an
+	// anti-affinity policy to spread parallel builds across hosts.
+	PlacementGroup string `mapstructure:"placement_group" required:"false"`
+	// PinPolicy of the instance. Options: ('none', 'soft', 'hard'). The default is chosen by PowerVS.
+	PinPolicy string `mapstructure:"pin_policy" required:"false"`
+	// AffinityPolicy for the storage of the instance relative to affinity_instance.
+	// Options: ('affinity', 'anti-affinity'). Requires affinity_instance.
+	AffinityPolicy string `mapstructure:"affinity_policy" required:"false"`
+	// AffinityInstance is the name or ID of the instance the affinity_policy applies to.
+	AffinityInstance string `mapstructure:"affinity_instance" required:"false"`
+	// HostID is the ID of the dedicated host the instance is deployed on.
+	HostID string `mapstructure:"host_id" required:"false"`
+
+	// DeploymentType of the instance, e.g. 'EPIC' or 'VMNoStorage'. Defaults to 'VTL' when the source
+	// image is IBM i, otherwise the default is chosen by PowerVS.
+	DeploymentType string `mapstructure:"deployment_type" required:"false"`
+	// LicenseRepositoryCapacity is the IBM i license repository capacity of the instance, in TiB.
+	// Only used when the source image is IBM i. Defaults to 1 when the deployment type is 'VTL'.
+	LicenseRepositoryCapacity int64 `mapstructure:"license_repository_capacity" required:"false"`
+
+	// RunTags are attached to every resource the build creates: networks, imported images and the instance.
+	// Each entry becomes a `key:value` user tag through the IBM Cloud Global Tagging API.
+	// Values support `{{ build_name }}` and `{{ timestamp }}` interpolation.
+	RunTags map[string]string `mapstructure:"run_tags" required:"false"`
+	// ImageTags are attached to the captured image when it is captured to the image catalog.
+	// Values support `{{ build_name }}` and `{{ timestamp }}` interpolation.
+	ImageTags map[string]string `mapstructure:"image_tags" required:"false"`
+
+	// Generalize removes the identity of the build instance from the guest before capture,
+	// so every instance deployed from the image gets its own. Supported on RHEL, SLES and Ubuntu.
+	// Default: false
+	Generalize bool `mapstructure:"generalize" required:"false"`
+	// GeneralizeSteps lists the cleanup tasks run when generalize is enabled.
+	// Options: ('cloud-init', 'machine-id', 'ssh-host-keys', 'rmc-node-id'). The default is all of them.
+	GeneralizeSteps []string `mapstructure:"generalize_steps" required:"false"`
+
+	// SkipIfUnchanged looks for an image of the image catalog built from the same source image,
+	// user_data and content_hash before building, and returns it as the artifact instead of building
+	// again when there is one. The fingerprint of these inputs is attached to the captured image as a
+	// `packer-fingerprint` user tag. Requires a capture destination including the image catalog.
+	// Default: false
+	SkipIfUnchanged bool `mapstructure:"skip_if_unchanged" required:"false"`
+	// ContentHash is added to the fingerprint of skip_if_unchanged, so that changes to the provisioning
+	// inputs trigger a build, e.g. `filesha256("scripts/setup.sh")`.
+	ContentHash string `mapstructure:"content_hash" required:"false"`
+
 	// Communicator settings
 	Comm communicator.Config `mapstructure:",squash"`
 }
@@ -75,5 +221,90 @@ func (c *RunConfig) Prepare(ctx *interpolate.Context) []error {
 		errs = append(errs, fmt.Errorf("invalid cleanup_timeout format: %s (use format like '10m', '15m30s')", c.CleanupTimeout))
 	}
 
+	// An empty shutdown_behavior is resolved from the OS of the source image at build time.
+	if c.ShutdownBehavior == "" && c.ShutdownCommand != "" {
+		c.ShutdownBehavior = ShutdownBehaviorSoftStop
+	}
+
+	switch c.ShutdownBehavior {
+	case "", ShutdownBehaviorSoftStop:
+	case ShutdownBehaviorImmediateShutdown, ShutdownBehaviorStop, ShutdownBehaviorNone:
+		if c.ShutdownCommand != "" {
+			errs = append(errs, fmt.Errorf("shutdown_command can only be used with shutdown_behavior %q", ShutdownBehaviorSoftStop))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid shutdown_behavior: %s (options: '%s', '%s', '%s', '%s')", c.ShutdownBehavior,
+			ShutdownBehaviorSoftStop, ShutdownBehaviorImmediateShutdown, ShutdownBehaviorStop, ShutdownBehaviorNone))
+	}
+
+	if c.ShutdownTimeout == "" {
+		c.ShutdownTimeout = "6m"
+	}
+
+	if _, err := time.ParseDuration(c.ShutdownTimeout); err != nil {
+		errs = append(errs, fmt.Errorf("invalid shutdown_timeout format: %s (use format like '10m', '15m30s')", c.ShutdownTimeout))
+	}
+
+	if c.LicenseRepositoryCapacity < 0 {
+		errs = append(errs, fmt.Errorf("invalid license_repository_capacity: %d (must not be negative)", c.LicenseRepositoryCapacity))
+	}
+
+	switch c.PinPolicy {
+	case "", PinPolicyNone, PinPolicySoft, PinPolicyHard:
+	default:
+		errs = append(errs, fmt.Errorf("invalid pin_policy: %s (options: '%s', '%s', '%s')", c.PinPolicy, PinPolicyNone, PinPolicySoft, PinPolicyHard))
+	}
+
+	switch c.AffinityPolicy {
+	case "":
+		if c.AffinityInstance != "" {
+			errs = append(errs, errors.New("affinity_instance requires affinity_policy to be set"))
+		}
+	case AffinityPolicyAffinity, AffinityPolicyAntiAffinity:
+		if c.AffinityInstance == "" {
+			errs = append(errs, errors.New("affinity_policy requires affinity_instance to be set"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid affinity_policy: %s (options: '%s', '%s')", c.AffinityPolicy, AffinityPolicyAffinity, AffinityPolicyAntiAffinity))
+	}
+
+	for name, tags := range map[string]map[string]string{"run_tags": c.RunTags, "image_tags": c.ImageTags} {
+		for _, tag := range TagList(tags) {
+			if strings.HasPrefix(tag, ":") || len(tag) > MaxTagLength {
+				errs = append(errs, fmt.Errorf("invalid %s entry: %q (keys must not be empty and tags must be at most %d characters)", name, tag, MaxTagLength))
+			}
+		}
+	}
+
+	if c.Generalize {
+		if len(c.GeneralizeSteps) == 0 {
+			c.GeneralizeSteps = GeneralizeStepsDefault
+		}
+		for _, step := range c.GeneralizeSteps {
+			if !slices.Contains(GeneralizeStepsDefault, step) {
+				errs = append(errs, fmt.Errorf("invalid generalize_steps entry: %s (options: %s)", step, strings.Join(GeneralizeStepsDefault, ", ")))
+			}
+		}
+	} else if len(c.GeneralizeSteps) != 0 {
+		errs = append(errs, errors.New("generalize_steps requires generalize to be enabled"))
+	}
+
+	if c.Source.COS != nil && (c.Source.COS.AccessKey == "") != (c.Source.COS.SecretKey == "") {
+		errs = append(errs, errors.New("source cos access_key and secret_key must be set together"))
+	}
+
+	switch c.Capture.NameSuffix {
+	case "", NameSuffixTimestamp, NameSuffixBuildNumber:
+	default:
+		errs = append(errs, fmt.Errorf("invalid name_suffix: %s (options: '%s', '%s')", c.Capture.NameSuffix, NameSuffixTimestamp, NameSuffixBuildNumber))
+	}
+	if c.Capture.KeepLastN < 0 {
+		errs = append(errs, fmt.Errorf("invalid keep_last_n: %d (must not be negative)", c.Capture.KeepLastN))
+	}
+
+	if c.ContentHash != "" && !c.SkipIfUnchanged {
+		errs = append(errs, errors.New("content_hash requires skip_if_unchanged to be enabled"))
+	}
+
 	return errs
 }
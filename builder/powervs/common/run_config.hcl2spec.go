@@ -10,9 +10,11 @@ import (
 // FlatCOS is an auto-generated flat version of COS.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatCOS struct {
-	Bucket *string `mapstructure:"bucket" required:"true" cty:"bucket" hcl:"bucket"`
-	Object *string `mapstructure:"object" required:"true" cty:"object" hcl:"object"`
-	Region *string `mapstructure:"region" required:"true" cty:"region" hcl:"region"`
+	Bucket    *string `mapstructure:"bucket" required:"true" cty:"bucket" hcl:"bucket"`
+	Object    *string `mapstructure:"object" required:"true" cty:"object" hcl:"object"`
+	Region    *string `mapstructure:"region" required:"true" cty:"region" hcl:"region"`
+	AccessKey *string `mapstructure:"access_key" required:"false" cty:"access_key" hcl:"access_key"`
+	SecretKey *string `mapstructure:"secret_key" required:"false" cty:"secret_key" hcl:"secret_key"`
 }
 
 // FlatMapstructure returns a new FlatCOS.
@@ -27,9 +29,11 @@ func (*COS) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
 // The decoded values from this spec will then be applied to a FlatCOS.
 func (*FlatCOS) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"bucket": &hcldec.AttrSpec{Name: "bucket", Type: cty.String, Required: false},
-		"object": &hcldec.AttrSpec{Name: "object", Type: cty.String, Required: false},
-		"region": &hcldec.AttrSpec{Name: "region", Type: cty.String, Required: false},
+		"bucket":     &hcldec.AttrSpec{Name: "bucket", Type: cty.String, Required: false},
+		"object":     &hcldec.AttrSpec{Name: "object", Type: cty.String, Required: false},
+		"region":     &hcldec.AttrSpec{Name: "region", Type: cty.String, Required: false},
+		"access_key": &hcldec.AttrSpec{Name: "access_key", Type: cty.String, Required: false},
+		"secret_key": &hcldec.AttrSpec{Name: "secret_key", Type: cty.String, Required: false},
 	}
 	return s
 }
@@ -37,9 +41,12 @@ func (*FlatCOS) HCL2Spec() map[string]hcldec.Spec {
 // FlatCapture is an auto-generated flat version of Capture.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatCapture struct {
-	Name        *string         `mapstructure:"name" required:"true" cty:"name" hcl:"name"`
-	Destination *string         `mapstructure:"destination" required:"false" cty:"destination" hcl:"destination"`
-	COS         *FlatCaptureCOS `mapstructure:"cos" required:"false" cty:"cos" hcl:"cos"`
+	Name            *string         `mapstructure:"name" required:"true" cty:"name" hcl:"name"`
+	Destination     *string         `mapstructure:"destination" required:"false" cty:"destination" hcl:"destination"`
+	COS             *FlatCaptureCOS `mapstructure:"cos" required:"false" cty:"cos" hcl:"cos"`
+	NameSuffix      *string         `mapstructure:"name_suffix" required:"false" cty:"name_suffix" hcl:"name_suffix"`
+	ForceDeregister *bool           `mapstructure:"force_deregister" required:"false" cty:"force_deregister" hcl:"force_deregister"`
+	KeepLastN       *int            `mapstructure:"keep_last_n" required:"false" cty:"keep_last_n" hcl:"keep_last_n"`
 }
 
 // FlatMapstructure returns a new FlatCapture.
@@ -54,9 +61,12 @@ func (*Capture) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec
 // The decoded values from this spec will then be applied to a FlatCapture.
 func (*FlatCapture) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"name":        &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
-		"destination": &hcldec.AttrSpec{Name: "destination", Type: cty.String, Required: false},
-		"cos":         &hcldec.BlockSpec{TypeName: "cos", Nested: hcldec.ObjectSpec((*FlatCaptureCOS)(nil).HCL2Spec())},
+		"name":             &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"destination":      &hcldec.AttrSpec{Name: "destination", Type: cty.String, Required: false},
+		"cos":              &hcldec.BlockSpec{TypeName: "cos", Nested: hcldec.ObjectSpec((*FlatCaptureCOS)(nil).HCL2Spec())},
+		"name_suffix":      &hcldec.AttrSpec{Name: "name_suffix", Type: cty.String, Required: false},
+		"force_deregister": &hcldec.AttrSpec{Name: "force_deregister", Type: cty.Bool, Required: false},
+		"keep_last_n":      &hcldec.AttrSpec{Name: "keep_last_n", Type: cty.Number, Required: false},
 	}
 	return s
 }
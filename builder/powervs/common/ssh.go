@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/IBM-Cloud/power-go-client/clients/instance"
 	"github.com/IBM-Cloud/power-go-client/power/models"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -22,7 +21,7 @@ func SSHHost() func(multistep.StateBag) (string, error) {
 	return func(state multistep.StateBag) (string, error) {
 		ui := state.Get("ui").(packersdk.Ui)
 		ui.Say("Fetching IP for machine")
-		instanceClient := state.Get("instanceClient").(*instance.IBMPIInstanceClient)
+		instanceClient := state.Get("instanceClient").(InstanceClient)
 		host := ""
 		const tries = 25
 		subnet := state.Get("network").(*models.Network)
@@ -54,7 +53,7 @@ func SSHHost() func(multistep.StateBag) (string, error) {
 				time.Sleep(sshHostSleepDuration)
 				continue
 			}
-			dhcpClient := state.Get("dhcpClient").(*instance.IBMPIDhcpClient)
+			dhcpClient := state.Get("dhcpClient").(DHCPClient)
 			ui.Say("Getting Instance IP from DHCP server")
 
 			net := state.Get("network").(*models.Network)
@@ -0,0 +1,38 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// FingerprintTagKey is the key of the user tag recording the fingerprint of the build on the captured
+// image, see RunConfig.SkipIfUnchanged.
+const FingerprintTagKey = "packer-fingerprint"
+
+// TagList converts a tag map into sorted `key:value` user tags as expected by the Global Tagging API.
+func TagList(tags map[string]string) []string {
+	list := make([]string, 0, len(tags))
+	for k, v := range tags {
+		list = append(list, fmt.Sprintf("%s:%s", k, v))
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Fingerprint returns the fingerprint of the inputs of a build: the ID of its source image, its rendered
+// user data and the content hash of the template.
+func Fingerprint(sourceImageID, userData, contentHash string) string {
+	h := sha256.New()
+	for _, input := range []string{sourceImageID, userData, contentHash} {
+		// The lengths keep the inputs apart.
+		fmt.Fprintf(h, "%d:%s\n", len(input), input)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FingerprintTag returns the user tag recording a fingerprint.
+func FingerprintTag(fingerprint string) string {
+	return FingerprintTagKey + ":" + fingerprint
+}
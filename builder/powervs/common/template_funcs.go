@@ -34,6 +34,11 @@ func templateCleanInstanceName(s string) string {
 	return string(newb[:])
 }
 
+// CleanResourceName applies the rules of the clean_resource_name template function to a name.
+func CleanResourceName(s string) string {
+	return templateCleanInstanceName(s)
+}
+
 var TemplateFuncs = template.FuncMap{
 	"clean_resource_name": templateCleanInstanceName,
 }
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/resourcecontrollerv2"
+)
+
+// PowerVSResourceID is the global catalog ID of the PowerVS service, the resource ID of workspaces.
+const PowerVSResourceID = "abd259f0-9990-11e8-acc8-b9f54a8f1661"
+
+// ResolveWorkspace looks up the workspace_name with the Resource Controller API and sets the
+// service_instance_id and zone, and the region when it is not set, from the workspace. It fails if
+// a zone is set that is not the zone of the workspace.
+func (c *AccessConfig) ResolveWorkspace(ctx context.Context) error {
+	if c.WorkspaceName == "" {
+		return nil
+	}
+	list, err := c.listWorkspaces(ctx, &resourcecontrollerv2.ListResourceInstancesOptions{Name: core.StringPtr(c.WorkspaceName)})
+	if err != nil {
+		return fmt.Errorf("failed to look up workspace %s: %w", c.WorkspaceName, err)
+	}
+	switch len(list.Resources) {
+	case 0:
+		return fmt.Errorf("workspace %s not found", c.WorkspaceName)
+	case 1:
+	default:
+		var crns []string
+		for _, r := range list.Resources {
+			crns = append(crns, *r.CRN)
+		}
+		return fmt.Errorf("found %d workspaces named %s, use service_instance_id to pick one of %s",
+			len(crns), c.WorkspaceName, strings.Join(crns, ", "))
+	}
+
+	// The location of a PowerVS workspace is its zone.
+	workspace := list.Resources[0]
+	zone := *workspace.RegionID
+	if c.Zone != "" && c.Zone != zone {
+		return fmt.Errorf("zone %s does not match the zone %s of workspace %s", c.Zone, zone, c.WorkspaceName)
+	}
+	c.ServiceInstanceID = *workspace.GUID
+	c.Zone = zone
+	c.Region = c.region()
+	return nil
+}
+
+// CheckWorkspaceZone looks up the service_instance_id with the Resource Controller API and fails if the
+// workspace is not in the zone. The check is best-effort: when the workspace can not be listed, e.g.
+// without the permission to, the build goes on and PowerVS reports the mismatch.
+func (c *AccessConfig) CheckWorkspaceZone(ctx context.Context) error {
+	if c.ServiceInstanceID == "" || c.Zone == "" {
+		return nil
+	}
+	list, err := c.listWorkspaces(ctx, &resourcecontrollerv2.ListResourceInstancesOptions{GUID: core.StringPtr(c.ServiceInstanceID)})
+	if err != nil || len(list.Resources) != 1 {
+		log.Printf("[WARN] zone of workspace %s not checked, lookup failed: %v", c.ServiceInstanceID, err)
+		return nil
+	}
+	if zone := *list.Resources[0].RegionID; zone != c.Zone {
+		return fmt.Errorf("zone %s does not match the zone %s of workspace %s", c.Zone, zone, c.ServiceInstanceID)
+	}
+	return nil
+}
+
+// listWorkspaces lists the active PowerVS workspaces matching options.
+func (c *AccessConfig) listWorkspaces(ctx context.Context, options *resourcecontrollerv2.ListResourceInstancesOptions) (*resourcecontrollerv2.ResourceInstancesList, error) {
+	authenticator, err := c.authenticator()
+	if err != nil {
+		return nil, err
+	}
+	rc, err := resourcecontrollerv2.NewResourceControllerV2(&resourcecontrollerv2.ResourceControllerV2Options{
+		Authenticator: authenticator,
+		URL:           c.resourceControllerURL(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if n := c.maxRetries(); n > 0 {
+		rc.Service.EnableRetries(n, RetryMaxDelay)
+	}
+	options.ResourceID = core.StringPtr(PowerVSResourceID)
+	options.State = core.StringPtr(resourcecontrollerv2.ListResourceInstancesOptionsStateActiveConst)
+	list, _, err := rc.ListResourceInstancesWithContext(ctx, options)
+	return list, err
+}
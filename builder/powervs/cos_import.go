@@ -0,0 +1,71 @@
+package powervs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/IBM/go-sdk-core/v5/core"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// CosImageImportJob returns the body of the import of the object of a Cloud Object Storage bucket as
+// the catalog image name. The bucket is read with the HMAC keys of cos when they are set, it is public
+// otherwise.
+func CosImageImportJob(name string, cos *common.COS, storageType string) *models.CreateCosImageImportJob {
+	body := &models.CreateCosImageImportJob{
+		ImageName:     core.StringPtr(name),
+		BucketName:    core.StringPtr(cos.Bucket),
+		BucketAccess:  core.StringPtr(BucketAccessPublic),
+		Region:        core.StringPtr(cos.Region),
+		ImageFilename: core.StringPtr(cos.Object),
+		StorageType:   storageType,
+	}
+	if cos.AccessKey != "" {
+		body.BucketAccess = core.StringPtr(BucketAccessPrivate)
+		body.AccessKey = cos.AccessKey
+		body.SecretKey = cos.SecretKey
+	}
+	return body
+}
+
+// JobStatus returns the state, progress and message of a job. A queued job has no progress yet.
+func JobStatus(job *models.Job) string {
+	progress := "-"
+	if job.Status.Progress != nil {
+		progress = *job.Status.Progress
+	}
+	return fmt.Sprintf("Job state: %s, progress: %s, message: %s", *job.Status.State, progress, job.Status.Message)
+}
+
+// WaitCOSImageImport waits for the job importing the image name from Cloud Object Storage, checking it
+// every pollInterval, and returns the image. progress is called with every state of the job.
+func WaitCOSImageImport(ui packersdk.Ui, imageClient common.ImageClient, jobClient common.JobClient, jobID, name string, pollInterval time.Duration, progress func(*models.Job)) (*models.ImageReference, error) {
+	begin := time.Now()
+loop:
+	for {
+		job, err := jobClient.Get(jobID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to Get Import Job: %w", err)
+		}
+		ui.Say(JobStatus(job))
+		if progress != nil {
+			progress(job)
+		}
+		switch *job.Status.State {
+		case "failed":
+			return nil, fmt.Errorf("image import job failed: %s", job.Status.Message)
+		case "completed":
+			break loop
+		default:
+			if time.Since(begin) >= polling.jobTimeout {
+				return nil, errors.New("timed out while waiting for image to be imported")
+			}
+			ui.Say(fmt.Sprintf("Sleeping for %s", pollInterval))
+			time.Sleep(pollInterval)
+		}
+	}
+	return findImageByName(imageClient, name)
+}
@@ -0,0 +1,67 @@
+package powervs
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// eventLog returns the event log of the build, nil when the build keeps none.
+func eventLog(state multistep.StateBag) *common.EventLog {
+	events, _ := state.Get("eventLog").(*common.EventLog)
+	return events
+}
+
+// jobProgress records the state of a polled PowerVS job in the event log.
+func jobProgress(state multistep.StateBag, id string, job *models.Job) {
+	var progress string
+	if job.Status.Progress != nil {
+		progress = *job.Status.Progress
+	}
+	eventLog(state).JobProgress(id, *job.Status.State, progress, job.Status.Message)
+}
+
+// eventStep records the start and the end of a step and of its cleanup in the event log, and the
+// error of a step halting the build.
+type eventStep struct {
+	multistep.Step
+	name string
+}
+
+// withEvents wraps the steps so that they are recorded in the event log.
+func withEvents(steps []multistep.Step) []multistep.Step {
+	wrapped := make([]multistep.Step, len(steps))
+	for i, step := range steps {
+		t := reflect.TypeOf(step)
+		if serialized, ok := step.(*stepSerialized); ok {
+			t = reflect.TypeOf(serialized.Step)
+		}
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		wrapped[i] = &eventStep{Step: step, name: t.Name()}
+	}
+	return wrapped
+}
+
+func (s *eventStep) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	events := eventLog(state)
+	events.StepStarted(s.name, false)
+	action := s.Step.Run(ctx, state)
+	halted := action == multistep.ActionHalt
+	if err, ok := state.GetOk("error"); ok && halted {
+		events.Error(err.(error))
+	}
+	events.StepFinished(false, halted)
+	return action
+}
+
+func (s *eventStep) Cleanup(state multistep.StateBag) {
+	events := eventLog(state)
+	events.StepStarted(s.name, true)
+	s.Step.Cleanup(state)
+	events.StepFinished(true, false)
+}
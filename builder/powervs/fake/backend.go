@@ -0,0 +1,443 @@
+// Package fake provides an in-memory PowerVS workspace implementing the client interfaces of the
+// builder, so the steps can be exercised without an IBM Cloud account.
+package fake
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/go-openapi/strfmt"
+)
+
+const (
+	JobStateRunning   = "running"
+	JobStateCompleted = "completed"
+	JobStateFailed    = "failed"
+
+	ImageStateQueued = "queued"
+	ImageStateActive = "active"
+	ImageStateFailed = "failed"
+
+	InstanceStatusBuild   = "BUILD"
+	InstanceStatusActive  = "ACTIVE"
+	InstanceStatusShutoff = "SHUTOFF"
+	InstanceStatusError   = "ERROR"
+
+	CaptureDestinationCloudStorage = "cloud-storage"
+)
+
+// Backend is an in-memory PowerVS workspace. Resources go through the same states as in PowerVS:
+// jobs run before they complete, imported images are queued before they are active, instances build
+// before they are active and deleted resources linger before they are gone. The number of Get calls
+// each transition takes is configurable, so that tests can exercise the polling and timeout paths.
+type Backend struct {
+	// JobPolls is the number of Get calls a job stays running for.
+	JobPolls int
+	// ImagePolls is the number of Get calls an image copied from a stock image stays queued for.
+	ImagePolls int
+	// InstancePolls is the number of Get calls a new instance stays in BUILD for.
+	InstancePolls int
+	// ShutdownPolls is the number of Get calls an instance takes to reach ShutdownResult after a stop action.
+	ShutdownPolls int
+	// DHCPPolls is the number of Get calls a DHCP server takes to create its network.
+	DHCPPolls int
+	// DeletePolls is the number of Get calls a deleted instance or image is still returned for.
+	DeletePolls int
+
+	// JobResult is the final state of jobs, "completed" by default.
+	JobResult string
+	// ImageResult is the final state of images copied from a stock image, "active" by default.
+	ImageResult string
+	// ShutdownResult is the status instances reach after a stop action, "SHUTOFF" by default.
+	ShutdownResult string
+
+	mu     sync.Mutex
+	nextID int
+	errs   map[string]error
+	calls  []string
+
+	stockImages map[string]*models.Image
+	images      map[string]*image
+	instances   map[string]*instance
+	networks    map[string]*models.Network
+	dhcpServers map[string]*dhcpServer
+	jobs        map[string]*job
+	tags        map[string][]string
+	workspaces  []workspace
+}
+
+// workspace is a PowerVS workspace listed by the Resource Controller.
+type workspace struct {
+	guid string
+	name string
+	zone string
+}
+
+// pending is a state change applied once a resource has been polled enough times.
+type pending struct {
+	polls int
+	apply func()
+}
+
+// poll counts a Get call and applies the state change when it is due.
+func (p *pending) poll() {
+	if p.apply == nil {
+		return
+	}
+	if p.polls > 0 {
+		p.polls--
+		return
+	}
+	apply := p.apply
+	p.apply = nil
+	apply()
+}
+
+type image struct {
+	pending
+	m      *models.Image
+	export *models.ExportImage
+}
+
+type instance struct {
+	pending
+	m       *models.PVMInstance
+	request *models.PVMInstanceCreate
+	actions []string
+	capture *models.PVMInstanceCapture
+}
+
+type dhcpServer struct {
+	pending
+	m *models.DHCPServerDetail
+}
+
+type job struct {
+	pending
+	m *models.Job
+}
+
+// NewBackend creates an empty workspace where every transition is immediate.
+func NewBackend() *Backend {
+	return &Backend{
+		JobResult:      JobStateCompleted,
+		ImageResult:    ImageStateActive,
+		ShutdownResult: InstanceStatusShutoff,
+
+		errs:        map[string]error{},
+		stockImages: map[string]*models.Image{},
+		images:      map[string]*image{},
+		instances:   map[string]*instance{},
+		networks:    map[string]*models.Network{},
+		dhcpServers: map[string]*dhcpServer{},
+		jobs:        map[string]*job{},
+		tags:        map[string][]string{},
+		// The workspace of the tests, found by its service_instance_id.
+		workspaces: []workspace{{guid: "workspace", name: "workspace", zone: "dal10"}},
+	}
+}
+
+// FailOn makes the client operation fail with err, e.g. FailOn("InstanceClient.Create", err).
+// A nil err clears the failure.
+func (b *Backend) FailOn(operation string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.errs, operation)
+		return
+	}
+	b.errs[operation] = err
+}
+
+// Calls returns the client operations called so far, in order.
+func (b *Backend) Calls() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.calls)
+}
+
+// call records an operation and returns the error it has to fail with. It must be called with b.mu held.
+func (b *Backend) call(operation string) error {
+	b.calls = append(b.calls, operation)
+	return b.errs[operation]
+}
+
+func (b *Backend) newID(kind string) string {
+	b.nextID++
+	return fmt.Sprintf("%s-%d", kind, b.nextID)
+}
+
+func crn(kind, id string) models.CRN {
+	return models.CRN(fmt.Sprintf("crn:v1:bluemix:public:power-iaas:fake:a/account:workspace:%s:%s", kind, id))
+}
+
+// ErrNotFound is wrapped by the errors of the operations on a resource that does not exist.
+var ErrNotFound = errors.New("not found")
+
+func notFound(kind, id string) error {
+	return fmt.Errorf("%s %s %w", kind, id, ErrNotFound)
+}
+
+func now() *strfmt.DateTime {
+	t := strfmt.DateTime(time.Now().UTC())
+	return &t
+}
+
+// AddStockImage adds a stock image with the given operating system and returns its ID.
+func (b *Backend) AddStockImage(name, os string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.newID("stock-image")
+	b.stockImages[id] = &models.Image{
+		ImageID:        core.StringPtr(id),
+		Name:           core.StringPtr(name),
+		State:          ImageStateActive,
+		StorageType:    core.StringPtr("tier1"),
+		Specifications: &models.ImageSpecifications{OperatingSystem: os},
+		CreationDate:   now(),
+	}
+	return id
+}
+
+// AddImage adds an active image to the image catalog and returns its ID.
+func (b *Backend) AddImage(name, os string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.addImage(name, os, ImageStateActive)
+}
+
+func (b *Backend) addImage(name, os, state string) string {
+	id := b.newID("image")
+	b.images[id] = &image{m: &models.Image{
+		ImageID:        core.StringPtr(id),
+		Name:           core.StringPtr(name),
+		Crn:            crn("image", id),
+		State:          state,
+		StorageType:    core.StringPtr("tier1"),
+		Specifications: &models.ImageSpecifications{OperatingSystem: os},
+		CreationDate:   now(),
+	}}
+	return id
+}
+
+// AddNetwork adds a network of the given type, e.g. "vlan" or "pub-vlan", and returns its ID.
+func (b *Backend) AddNetwork(name, networkType string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.addNetwork(name, networkType)
+}
+
+func (b *Backend) addNetwork(name, networkType string) string {
+	id := b.newID("network")
+	b.networks[id] = &models.Network{
+		NetworkID: core.StringPtr(id),
+		Name:      core.StringPtr(name),
+		Type:      core.StringPtr(networkType),
+		Crn:       crn("network", id),
+		Cidr:      core.StringPtr(fmt.Sprintf("192.168.%d.0/24", b.nextID%256)),
+	}
+	return id
+}
+
+// AddInstance adds an instance with the given status and returns its ID.
+func (b *Backend) AddInstance(name, status string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.newID("instance")
+	b.instances[id] = &instance{m: &models.PVMInstance{
+		PvmInstanceID: core.StringPtr(id),
+		ServerName:    core.StringPtr(name),
+		Status:        core.StringPtr(status),
+		Crn:           crn("pvm-instance", id),
+		CreationDate:  *now(),
+	}}
+	return id
+}
+
+// AddWorkspace adds a PowerVS workspace to the Resource Controller and returns its GUID. The backend
+// stands for every workspace, the workspaces only serve the lookups by name and by GUID.
+func (b *Backend) AddWorkspace(name, zone string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	guid := b.newID("workspace")
+	b.workspaces = append(b.workspaces, workspace{guid: guid, name: name, zone: zone})
+	return guid
+}
+
+// AddServiceInstance adds the PowerVS workspace with the service_instance_id guid to the Resource
+// Controller.
+func (b *Backend) AddServiceInstance(guid, zone string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.workspaces = append(b.workspaces, workspace{guid: guid, name: guid, zone: zone})
+}
+
+// SetInstanceStatus changes the status of an instance, e.g. to simulate a shutdown from inside the guest.
+func (b *Backend) SetInstanceStatus(id, status string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if in, ok := b.instances[id]; ok {
+		in.m.Status = core.StringPtr(status)
+	}
+}
+
+// SetImageCreationDate changes the creation date of an image of the image catalog.
+func (b *Backend) SetImageCreationDate(id string, created time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if img, ok := b.images[id]; ok {
+		date := strfmt.DateTime(created.UTC())
+		img.m.CreationDate = &date
+	}
+}
+
+// Image returns an image of the image catalog.
+func (b *Backend) Image(id string) (*models.Image, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	img, ok := b.images[id]
+	if !ok {
+		return nil, false
+	}
+	m := *img.m
+	return &m, true
+}
+
+// ImageIDs returns the IDs of the images in the image catalog.
+func (b *Backend) ImageIDs() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sortedKeys(b.images)
+}
+
+// Instance returns an instance.
+func (b *Backend) Instance(id string) (*models.PVMInstance, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	in, ok := b.instances[id]
+	if !ok {
+		return nil, false
+	}
+	m := *in.m
+	return &m, true
+}
+
+// InstanceIDs returns the IDs of the instances.
+func (b *Backend) InstanceIDs() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sortedKeys(b.instances)
+}
+
+// InstanceRequest returns the request an instance was created with.
+func (b *Backend) InstanceRequest(id string) *models.PVMInstanceCreate {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if in, ok := b.instances[id]; ok {
+		return in.request
+	}
+	return nil
+}
+
+// InstanceActions returns the actions sent to an instance, in order.
+func (b *Backend) InstanceActions(id string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if in, ok := b.instances[id]; ok {
+		return slices.Clone(in.actions)
+	}
+	return nil
+}
+
+// InstanceCapture returns the last capture request of an instance.
+func (b *Backend) InstanceCapture(id string) *models.PVMInstanceCapture {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if in, ok := b.instances[id]; ok {
+		return in.capture
+	}
+	return nil
+}
+
+// ImageExport returns the last export request of an image of the image catalog.
+func (b *Backend) ImageExport(id string) *models.ExportImage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if img, ok := b.images[id]; ok {
+		return img.export
+	}
+	return nil
+}
+
+// NetworkIDs returns the IDs of the networks.
+func (b *Backend) NetworkIDs() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sortedKeys(b.networks)
+}
+
+// DHCPServerIDs returns the IDs of the DHCP servers.
+func (b *Backend) DHCPServerIDs() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sortedKeys(b.dhcpServers)
+}
+
+// Tags returns the user tags attached to a CRN.
+func (b *Backend) Tags(crn string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.tags[crn])
+}
+
+// newJob starts a job that ends in JobResult after JobPolls Get calls, calling onComplete when it completes.
+func (b *Backend) newJob(onComplete func()) *models.JobReference {
+	id := b.newID("job")
+	j := &job{m: &models.Job{
+		ID: core.StringPtr(id),
+		// PowerVS sets the progress of a job once it has started.
+		Status: &models.Status{State: core.StringPtr(JobStateRunning)},
+	}}
+	j.pending = pending{polls: b.JobPolls, apply: func() {
+		j.m.Status.State = core.StringPtr(b.JobResult)
+		j.m.Status.Progress = core.StringPtr("100%")
+		if b.JobResult == JobStateCompleted && onComplete != nil {
+			onComplete()
+		} else if b.JobResult != JobStateCompleted {
+			j.m.Status.Message = "job failed"
+		}
+	}}
+	b.jobs[id] = j
+	return &models.JobReference{ID: core.StringPtr(id)}
+}
+
+// leases returns the DHCP leases of the instances attached to a network.
+func (b *Backend) leases(networkID string) []*models.DHCPServerLeases {
+	var leases []*models.DHCPServerLeases
+	for _, id := range sortedKeys(b.instances) {
+		for _, net := range b.instances[id].m.Networks {
+			if net.NetworkID == networkID {
+				leases = append(leases, &models.DHCPServerLeases{
+					InstanceIP:         core.StringPtr(net.IPAddress),
+					InstanceMacAddress: core.StringPtr(net.MacAddress),
+				})
+			}
+		}
+	}
+	return leases
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,473 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globalsearchv2"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// ImageClient returns an image client for the workspace.
+func (b *Backend) ImageClient() common.ImageClient { return imageClient{b} }
+
+// InstanceClient returns an instance client for the workspace.
+func (b *Backend) InstanceClient() common.InstanceClient { return instanceClient{b} }
+
+// NetworkClient returns a network client for the workspace.
+func (b *Backend) NetworkClient() common.NetworkClient { return networkClient{b} }
+
+// JobClient returns a job client for the workspace.
+func (b *Backend) JobClient() common.JobClient { return jobClient{b} }
+
+// DHCPClient returns a DHCP client for the workspace.
+func (b *Backend) DHCPClient() common.DHCPClient { return dhcpClient{b} }
+
+// TaggingClient returns a Global Tagging client recording the tags attached to the workspace resources.
+func (b *Backend) TaggingClient() common.TaggingClient { return taggingClient{b} }
+
+// SearchClient returns a Global Search client finding the resources by the tags of the tagging client.
+func (b *Backend) SearchClient() common.SearchClient { return searchClient{b} }
+
+type imageClient struct{ b *Backend }
+
+func (c imageClient) Get(id string) (*models.Image, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("ImageClient.Get"); err != nil {
+		return nil, err
+	}
+	img, ok := c.b.images[id]
+	if !ok {
+		return nil, notFound("image", id)
+	}
+	img.poll()
+	if _, ok := c.b.images[id]; !ok {
+		return nil, notFound("image", id)
+	}
+	m := *img.m
+	return &m, nil
+}
+
+func (c imageClient) GetAll() (*models.Images, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("ImageClient.GetAll"); err != nil {
+		return nil, err
+	}
+	images := &models.Images{Images: []*models.ImageReference{}}
+	for _, id := range sortedKeys(c.b.images) {
+		images.Images = append(images.Images, imageReference(c.b.images[id].m))
+	}
+	return images, nil
+}
+
+func (c imageClient) GetAllStockImages(_ bool, _ bool) (*models.Images, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("ImageClient.GetAllStockImages"); err != nil {
+		return nil, err
+	}
+	images := &models.Images{Images: []*models.ImageReference{}}
+	for _, id := range sortedKeys(c.b.stockImages) {
+		images.Images = append(images.Images, imageReference(c.b.stockImages[id]))
+	}
+	return images, nil
+}
+
+func (c imageClient) Create(body *models.CreateImage) (*models.Image, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("ImageClient.Create"); err != nil {
+		return nil, err
+	}
+	stock, ok := c.b.stockImages[body.ImageID]
+	if !ok {
+		return nil, notFound("stock image", body.ImageID)
+	}
+	id := c.b.addImage(*stock.Name, stock.Specifications.OperatingSystem, ImageStateQueued)
+	img := c.b.images[id]
+	img.pending = pending{polls: c.b.ImagePolls, apply: func() {
+		img.m.State = c.b.ImageResult
+	}}
+	m := *img.m
+	return &m, nil
+}
+
+func (c imageClient) CreateCosImage(body *models.CreateCosImageImportJob) (*models.JobReference, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("ImageClient.CreateCosImage"); err != nil {
+		return nil, err
+	}
+	name := *body.ImageName
+	return c.b.newJob(func() {
+		c.b.addImage(name, body.OsType, ImageStateActive)
+	}), nil
+}
+
+func (c imageClient) ExportImage(id string, body *models.ExportImage) (*models.JobReference, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("ImageClient.ExportImage"); err != nil {
+		return nil, err
+	}
+	img, ok := c.b.images[id]
+	if !ok {
+		return nil, notFound("image", id)
+	}
+	img.export = body
+	return c.b.newJob(func() {}), nil
+}
+
+func (c imageClient) Delete(id string) error {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("ImageClient.Delete"); err != nil {
+		return err
+	}
+	img, ok := c.b.images[id]
+	if !ok {
+		return notFound("image", id)
+	}
+	img.pending = pending{polls: c.b.DeletePolls, apply: func() {
+		delete(c.b.images, id)
+	}}
+	return nil
+}
+
+func imageReference(m *models.Image) *models.ImageReference {
+	state := m.State
+	return &models.ImageReference{
+		ImageID:        m.ImageID,
+		Name:           m.Name,
+		Crn:            m.Crn,
+		State:          &state,
+		StorageType:    m.StorageType,
+		Specifications: m.Specifications,
+		CreationDate:   m.CreationDate,
+	}
+}
+
+type instanceClient struct{ b *Backend }
+
+func (c instanceClient) Get(id string) (*models.PVMInstance, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("InstanceClient.Get"); err != nil {
+		return nil, err
+	}
+	in, ok := c.b.instances[id]
+	if !ok {
+		return nil, notFound("instance", id)
+	}
+	in.poll()
+	if _, ok := c.b.instances[id]; !ok {
+		return nil, notFound("instance", id)
+	}
+	m := *in.m
+	return &m, nil
+}
+
+func (c instanceClient) GetAll() (*models.PVMInstances, error) {
+	return c.b.instanceList()
+}
+
+func (c instanceClient) Create(body *models.PVMInstanceCreate) (*models.PVMInstanceList, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("InstanceClient.Create"); err != nil {
+		return nil, err
+	}
+	id := c.b.newID("instance")
+	in := &instance{request: body, m: &models.PVMInstance{
+		PvmInstanceID: core.StringPtr(id),
+		ServerName:    body.ServerName,
+		ImageID:       body.ImageID,
+		Status:        core.StringPtr(InstanceStatusBuild),
+		Crn:           crn("pvm-instance", id),
+		CreationDate:  *now(),
+	}}
+	for i, n := range body.Networks {
+		net, ok := c.b.networks[*n.NetworkID]
+		if !ok {
+			return nil, notFound("network", *n.NetworkID)
+		}
+		address := fmt.Sprintf("192.168.%d.%d", c.b.nextID%256, i+10)
+		pvmNetwork := &models.PVMInstanceNetwork{
+			NetworkID:  *n.NetworkID,
+			IPAddress:  address,
+			MacAddress: fmt.Sprintf("fa:16:3e:00:%02x:%02x", c.b.nextID%256, i),
+		}
+		if *net.Type == "pub-vlan" {
+			pvmNetwork.ExternalIP = fmt.Sprintf("203.0.113.%d", c.b.nextID%256)
+		}
+		in.m.Networks = append(in.m.Networks, pvmNetwork)
+	}
+	in.pending = pending{polls: c.b.InstancePolls, apply: func() {
+		in.m.Status = core.StringPtr(InstanceStatusActive)
+	}}
+	c.b.instances[id] = in
+	return &models.PVMInstanceList{{PvmInstanceID: core.StringPtr(id), ServerName: body.ServerName}}, nil
+}
+
+func (c instanceClient) Delete(id string) error {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("InstanceClient.Delete"); err != nil {
+		return err
+	}
+	in, ok := c.b.instances[id]
+	if !ok {
+		return notFound("instance", id)
+	}
+	in.pending = pending{polls: c.b.DeletePolls, apply: func() {
+		delete(c.b.instances, id)
+	}}
+	return nil
+}
+
+func (c instanceClient) Action(id string, body *models.PVMInstanceAction) error {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("InstanceClient.Action"); err != nil {
+		return err
+	}
+	in, ok := c.b.instances[id]
+	if !ok {
+		return notFound("instance", id)
+	}
+	in.actions = append(in.actions, *body.Action)
+	switch *body.Action {
+	case "stop", "immediate-shutdown":
+		in.pending = pending{polls: c.b.ShutdownPolls, apply: func() {
+			in.m.Status = core.StringPtr(c.b.ShutdownResult)
+		}}
+	case "start", "soft-reboot", "hard-reboot":
+		in.m.Status = core.StringPtr(InstanceStatusActive)
+	}
+	return nil
+}
+
+func (c instanceClient) CaptureInstanceToImageCatalogV2(id string, body *models.PVMInstanceCapture) (*models.JobReference, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("InstanceClient.CaptureInstanceToImageCatalogV2"); err != nil {
+		return nil, err
+	}
+	in, ok := c.b.instances[id]
+	if !ok {
+		return nil, notFound("instance", id)
+	}
+	in.capture = body
+	name := *body.CaptureName
+	toCatalog := *body.CaptureDestination != CaptureDestinationCloudStorage
+	os := ""
+	if img, ok := c.b.images[*in.m.ImageID]; ok && img.m.Specifications != nil {
+		os = img.m.Specifications.OperatingSystem
+	}
+	return c.b.newJob(func() {
+		if toCatalog {
+			c.b.addImage(name, os, ImageStateActive)
+		}
+	}), nil
+}
+
+type networkClient struct{ b *Backend }
+
+func (c networkClient) Get(id string) (*models.Network, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("NetworkClient.Get"); err != nil {
+		return nil, err
+	}
+	net, ok := c.b.networks[id]
+	if !ok {
+		return nil, notFound("network", id)
+	}
+	m := *net
+	return &m, nil
+}
+
+func (c networkClient) GetAll() (*models.Networks, error) {
+	return c.b.networkList()
+}
+
+func (c networkClient) Create(body *models.NetworkCreate) (*models.Network, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("NetworkClient.Create"); err != nil {
+		return nil, err
+	}
+	name := body.Name
+	if name == "" {
+		name = fmt.Sprintf("packer-network-%d", c.b.nextID+1)
+	}
+	id := c.b.addNetwork(name, *body.Type)
+	c.b.networks[id].DNSServers = body.DNSServers
+	m := *c.b.networks[id]
+	return &m, nil
+}
+
+func (c networkClient) Delete(id string) error {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("NetworkClient.Delete"); err != nil {
+		return err
+	}
+	if _, ok := c.b.networks[id]; !ok {
+		return notFound("network", id)
+	}
+	for _, in := range c.b.instances {
+		for _, net := range in.m.Networks {
+			if net.NetworkID == id {
+				return fmt.Errorf("network %s is attached to instance %s", id, *in.m.PvmInstanceID)
+			}
+		}
+	}
+	delete(c.b.networks, id)
+	return nil
+}
+
+type jobClient struct{ b *Backend }
+
+func (c jobClient) Get(id string) (*models.Job, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("JobClient.Get"); err != nil {
+		return nil, err
+	}
+	j, ok := c.b.jobs[id]
+	if !ok {
+		return nil, notFound("job", id)
+	}
+	j.poll()
+	m := *j.m
+	status := *j.m.Status
+	m.Status = &status
+	return &m, nil
+}
+
+type dhcpClient struct{ b *Backend }
+
+func (c dhcpClient) Get(id string) (*models.DHCPServerDetail, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("DHCPClient.Get"); err != nil {
+		return nil, err
+	}
+	server, ok := c.b.dhcpServers[id]
+	if !ok {
+		return nil, notFound("DHCP server", id)
+	}
+	server.poll()
+	m := *server.m
+	if m.Network != nil {
+		m.Leases = c.b.leases(*m.Network.ID)
+	}
+	return &m, nil
+}
+
+func (c dhcpClient) GetAll() (models.DHCPServers, error) {
+	return c.b.dhcpServerList()
+}
+
+func (c dhcpClient) Create(_ *models.DHCPServerCreate) (*models.DHCPServer, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("DHCPClient.Create"); err != nil {
+		return nil, err
+	}
+	id := c.b.newID("dhcp-server")
+	server := &dhcpServer{m: &models.DHCPServerDetail{
+		ID:     core.StringPtr(id),
+		Status: core.StringPtr(InstanceStatusBuild),
+	}}
+	server.pending = pending{polls: c.b.DHCPPolls, apply: func() {
+		name := fmt.Sprintf("DHCPSERVER%s_Private", id)
+		networkID := c.b.addNetwork(name, "vlan")
+		server.m.Network = &models.DHCPServerNetwork{ID: core.StringPtr(networkID), Name: core.StringPtr(name)}
+		server.m.Status = core.StringPtr(InstanceStatusActive)
+	}}
+	c.b.dhcpServers[id] = server
+	return &models.DHCPServer{ID: server.m.ID, Status: server.m.Status}, nil
+}
+
+func (c dhcpClient) Delete(id string) error {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("DHCPClient.Delete"); err != nil {
+		return err
+	}
+	server, ok := c.b.dhcpServers[id]
+	if !ok {
+		return notFound("DHCP server", id)
+	}
+	if server.m.Network != nil {
+		delete(c.b.networks, *server.m.Network.ID)
+	}
+	delete(c.b.dhcpServers, id)
+	return nil
+}
+
+type taggingClient struct{ b *Backend }
+
+func (c taggingClient) AttachTagWithContext(_ context.Context, options *globaltaggingv1.AttachTagOptions) (*globaltaggingv1.TagResults, *core.DetailedResponse, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("TaggingClient.AttachTag"); err != nil {
+		return nil, nil, err
+	}
+	results := &globaltaggingv1.TagResults{}
+	for _, r := range options.Resources {
+		c.b.tags[*r.ResourceID] = append(c.b.tags[*r.ResourceID], options.TagNames...)
+		results.Results = append(results.Results, globaltaggingv1.TagResultsItem{
+			ResourceID: r.ResourceID,
+			IsError:    core.BoolPtr(false),
+		})
+	}
+	return results, &core.DetailedResponse{StatusCode: 200}, nil
+}
+
+func (c taggingClient) ListTagsWithContext(_ context.Context, options *globaltaggingv1.ListTagsOptions) (*globaltaggingv1.TagList, *core.DetailedResponse, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("TaggingClient.ListTags"); err != nil {
+		return nil, nil, err
+	}
+	list := &globaltaggingv1.TagList{Items: []globaltaggingv1.Tag{}}
+	if options.AttachedTo != nil {
+		for _, tag := range c.b.tags[*options.AttachedTo] {
+			list.Items = append(list.Items, globaltaggingv1.Tag{Name: core.StringPtr(tag)})
+		}
+	}
+	list.TotalCount = core.Int64Ptr(int64(len(list.Items)))
+	return list, &core.DetailedResponse{StatusCode: 200}, nil
+}
+
+type searchClient struct{ b *Backend }
+
+// SearchWithContext supports only the queries of one tag, tags:"<tag>".
+func (c searchClient) SearchWithContext(_ context.Context, options *globalsearchv2.SearchOptions) (*globalsearchv2.ScanResult, *core.DetailedResponse, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if err := c.b.call("SearchClient.Search"); err != nil {
+		return nil, nil, err
+	}
+	tag, ok := strings.CutPrefix(core.StringNilMapper(options.Query), `tags:"`)
+	if tag, ok = strings.CutSuffix(tag, `"`); !ok {
+		return nil, nil, fmt.Errorf("unsupported query %q", core.StringNilMapper(options.Query))
+	}
+	result := &globalsearchv2.ScanResult{Items: []globalsearchv2.ResultItem{}}
+	for crn, tags := range c.b.tags {
+		if slices.Contains(tags, tag) {
+			result.Items = append(result.Items, globalsearchv2.ResultItem{CRN: core.StringPtr(crn)})
+		}
+	}
+	return result, &core.DetailedResponse{StatusCode: 200}, nil
+}
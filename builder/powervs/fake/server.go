@@ -0,0 +1,552 @@
+package fake
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globalsearchv2"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// AccountID is the IBM Cloud account the API keys accepted by Server belong to.
+const AccountID = "account"
+
+// Server serves the subset of the PowerVS, IAM, Global Tagging and Global Search REST APIs used by the plugin on top of
+// a Backend, so that Builder.Run can be exercised end to end without an IBM Cloud account. Point the
+// `endpoint` of the builder at Server.URL to use it.
+//
+// Every route is named after the Backend operation it calls, e.g. "InstanceClient.Create", plus
+// "IAM.GetToken" for the IAM token exchange of API keys and compute resource tokens, and
+// "VPC.CreateAccessToken" and "VPC.CreateIAMToken" for the VPC instance metadata service.
+// Delay, Fail and Throttle script the behaviour of a route; Backend.FailOn failures are returned as
+// 400 errors.
+type Server struct {
+	*httptest.Server
+	Backend *Backend
+
+	mu         sync.Mutex
+	delays     map[string]time.Duration
+	failures   map[string]*failure
+	requests   int
+	workspaces map[string]*Backend
+}
+
+type failure struct {
+	status int
+	// count is the number of requests left to fail, a negative count fails them all.
+	count int
+	// retryAfter is the Retry-After header of the responses, in seconds, when set.
+	retryAfter string
+}
+
+// NewServer starts a server for the backend. It is closed with Close.
+func NewServer(backend *Backend) *Server {
+	s := &Server{
+		Backend:    backend,
+		delays:     map[string]time.Duration{},
+		failures:   map[string]*failure{},
+		workspaces: map[string]*Backend{},
+	}
+	s.Server = httptest.NewServer(s.handler())
+	return s
+}
+
+// AddWorkspace serves the PowerVS API of the workspace serviceInstanceID from backend, the other
+// workspaces are served from Server.Backend.
+func (s *Server) AddWorkspace(serviceInstanceID string, backend *Backend) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workspaces[serviceInstanceID] = backend
+}
+
+// backend returns the backend of the workspace serviceInstanceID.
+func (s *Server) backend(serviceInstanceID string) *Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if backend, ok := s.workspaces[serviceInstanceID]; ok {
+		return backend
+	}
+	return s.Backend
+}
+
+// Delay makes the requests to a route wait for d before they are handled. A zero d clears the delay.
+func (s *Server) Delay(route string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d == 0 {
+		delete(s.delays, route)
+		return
+	}
+	s.delays[route] = d
+}
+
+// Fail makes every request to a route fail with the HTTP status. A zero status clears the failure.
+func (s *Server) Fail(route string, status int) {
+	s.FailTimes(route, status, -1)
+}
+
+// FailTimes makes the next count requests to a route fail with the HTTP status, e.g. to exercise retries.
+func (s *Server) FailTimes(route string, status int, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == 0 || count == 0 {
+		delete(s.failures, route)
+		return
+	}
+	s.failures[route] = &failure{status: status, count: count}
+}
+
+// Throttle makes the next count requests to a route fail with a 429 response asking to retry after d.
+func (s *Server) Throttle(route string, count int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[route] = &failure{
+		status:     http.StatusTooManyRequests,
+		count:      count,
+		retryAfter: strconv.Itoa(int(d.Seconds())),
+	}
+}
+
+// requestID returns the ID of a new request, returned in the X-Request-Id header of every response as
+// IBM Cloud does.
+func (s *Server) requestID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	return fmt.Sprintf("request-%d", s.requests)
+}
+
+// scripted returns the delay of a route and the failure its request has to return, if any.
+func (s *Server) scripted(route string) (time.Duration, *failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.failures[route]
+	if !ok {
+		return s.delays[route], nil
+	}
+	if f.count > 0 {
+		f.count--
+		if f.count == 0 {
+			delete(s.failures, route)
+		}
+	}
+	return s.delays[route], f
+}
+
+// empty is the body of the responses without a payload.
+var empty = map[string]interface{}{}
+
+// request is a decoded API request.
+type request struct {
+	*http.Request
+	id string
+	// b is the backend of the workspace of the request.
+	b *Backend
+}
+
+// decode reads the JSON body of the request.
+func (r request) decode(v interface{}) error {
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// handlerFunc handles a request and returns the status and body of the response.
+type handlerFunc func(r request) (int, interface{}, error)
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	v1 := "/pcloud/v1/cloud-instances/{cloud_instance_id}"
+	v2 := "/pcloud/v2/cloud-instances/{cloud_instance_id}"
+
+	s.handle(mux, "POST /identity/token", "IAM.GetToken", false, s.token)
+	s.handle(mux, "PUT /instance_identity/v1/token", "VPC.CreateAccessToken", false, s.instanceIdentityToken)
+	s.handle(mux, "POST /instance_identity/v1/iam_token", "VPC.CreateIAMToken", true, s.instanceIAMToken)
+	s.handle(mux, "GET /v2/resource_instances", "ResourceController.ListResourceInstances", true, s.listResourceInstances)
+	s.handle(mux, "POST /v3/tags/attach", "TaggingClient.AttachTag", true, s.attachTag)
+	s.handle(mux, "GET /v3/tags", "TaggingClient.ListTags", true, s.listTags)
+	s.handle(mux, "POST /v3/resources/search", "SearchClient.Search", true, s.search)
+
+	s.handle(mux, "GET "+v1+"/images", "ImageClient.GetAll", true, func(r request) (int, interface{}, error) {
+		images, err := r.b.ImageClient().GetAll()
+		return http.StatusOK, images, err
+	})
+	s.handle(mux, "GET "+v1+"/images/{id}", "ImageClient.Get", true, func(r request) (int, interface{}, error) {
+		image, err := r.b.ImageClient().Get(r.id)
+		return http.StatusOK, image, err
+	})
+	s.handle(mux, "POST "+v1+"/images", "ImageClient.Create", true, func(r request) (int, interface{}, error) {
+		var body models.CreateImage
+		if err := r.decode(&body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		image, err := r.b.ImageClient().Create(&body)
+		return http.StatusCreated, image, err
+	})
+	s.handle(mux, "DELETE "+v1+"/images/{id}", "ImageClient.Delete", true, func(r request) (int, interface{}, error) {
+		return http.StatusOK, empty, r.b.ImageClient().Delete(r.id)
+	})
+	s.handle(mux, "POST "+v1+"/cos-images", "ImageClient.CreateCosImage", true, func(r request) (int, interface{}, error) {
+		var body models.CreateCosImageImportJob
+		if err := r.decode(&body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		job, err := r.b.ImageClient().CreateCosImage(&body)
+		return http.StatusAccepted, job, err
+	})
+	s.handle(mux, "POST "+v2+"/images/{id}/export", "ImageClient.ExportImage", true, func(r request) (int, interface{}, error) {
+		var body models.ExportImage
+		if err := r.decode(&body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		job, err := r.b.ImageClient().ExportImage(r.id, &body)
+		return http.StatusAccepted, job, err
+	})
+	s.handle(mux, "GET "+v1+"/stock-images", "ImageClient.GetAllStockImages", true, func(r request) (int, interface{}, error) {
+		images, err := r.b.ImageClient().GetAllStockImages(false, false)
+		return http.StatusOK, images, err
+	})
+
+	s.handle(mux, "GET "+v1+"/pvm-instances", "InstanceClient.GetAll", true, func(r request) (int, interface{}, error) {
+		instances, err := r.b.InstanceClient().GetAll()
+		return http.StatusOK, instances, err
+	})
+	s.handle(mux, "GET "+v1+"/pvm-instances/{id}", "InstanceClient.Get", true, func(r request) (int, interface{}, error) {
+		in, err := r.b.InstanceClient().Get(r.id)
+		return http.StatusOK, in, err
+	})
+	s.handle(mux, "POST "+v1+"/pvm-instances", "InstanceClient.Create", true, func(r request) (int, interface{}, error) {
+		var body models.PVMInstanceCreate
+		if err := r.decode(&body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		list, err := r.b.InstanceClient().Create(&body)
+		return http.StatusCreated, list, err
+	})
+	s.handle(mux, "DELETE "+v1+"/pvm-instances/{id}", "InstanceClient.Delete", true, func(r request) (int, interface{}, error) {
+		return http.StatusOK, empty, r.b.InstanceClient().Delete(r.id)
+	})
+	s.handle(mux, "POST "+v1+"/pvm-instances/{id}/action", "InstanceClient.Action", true, func(r request) (int, interface{}, error) {
+		var body models.PVMInstanceAction
+		if err := r.decode(&body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		return http.StatusOK, empty, r.b.InstanceClient().Action(r.id, &body)
+	})
+	s.handle(mux, "POST "+v2+"/pvm-instances/{id}/capture", "InstanceClient.CaptureInstanceToImageCatalogV2", true, func(r request) (int, interface{}, error) {
+		var body models.PVMInstanceCapture
+		if err := r.decode(&body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		job, err := r.b.InstanceClient().CaptureInstanceToImageCatalogV2(r.id, &body)
+		return http.StatusAccepted, job, err
+	})
+
+	s.handle(mux, "GET "+v1+"/networks", "NetworkClient.GetAll", true, func(r request) (int, interface{}, error) {
+		networks, err := r.b.NetworkClient().GetAll()
+		return http.StatusOK, networks, err
+	})
+	s.handle(mux, "GET "+v1+"/networks/{id}", "NetworkClient.Get", true, func(r request) (int, interface{}, error) {
+		net, err := r.b.NetworkClient().Get(r.id)
+		return http.StatusOK, net, err
+	})
+	s.handle(mux, "POST "+v1+"/networks", "NetworkClient.Create", true, func(r request) (int, interface{}, error) {
+		var body models.NetworkCreate
+		if err := r.decode(&body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		net, err := r.b.NetworkClient().Create(&body)
+		return http.StatusCreated, net, err
+	})
+	s.handle(mux, "DELETE "+v1+"/networks/{id}", "NetworkClient.Delete", true, func(r request) (int, interface{}, error) {
+		return http.StatusOK, empty, r.b.NetworkClient().Delete(r.id)
+	})
+
+	s.handle(mux, "GET "+v1+"/jobs/{id}", "JobClient.Get", true, func(r request) (int, interface{}, error) {
+		job, err := r.b.JobClient().Get(r.id)
+		return http.StatusOK, job, err
+	})
+
+	s.handle(mux, "GET "+v1+"/services/dhcp", "DHCPClient.GetAll", true, func(r request) (int, interface{}, error) {
+		servers, err := r.b.DHCPClient().GetAll()
+		return http.StatusOK, servers, err
+	})
+	s.handle(mux, "GET "+v1+"/services/dhcp/{id}", "DHCPClient.Get", true, func(r request) (int, interface{}, error) {
+		server, err := r.b.DHCPClient().Get(r.id)
+		return http.StatusOK, server, err
+	})
+	s.handle(mux, "POST "+v1+"/services/dhcp", "DHCPClient.Create", true, func(r request) (int, interface{}, error) {
+		var body models.DHCPServerCreate
+		if err := r.decode(&body); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		server, err := r.b.DHCPClient().Create(&body)
+		return http.StatusAccepted, server, err
+	})
+	s.handle(mux, "DELETE "+v1+"/services/dhcp/{id}", "DHCPClient.Delete", true, func(r request) (int, interface{}, error) {
+		return http.StatusAccepted, empty, r.b.DHCPClient().Delete(r.id)
+	})
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s is not served by the fake PowerVS API", r.Method, r.URL.Path))
+	})
+	return mux
+}
+
+// handle registers a route. Routes requiring authentication reject requests without a bearer token.
+func (s *Server) handle(mux *http.ServeMux, pattern, route string, auth bool, fn handlerFunc) {
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", s.requestID())
+		delay, failure := s.scripted(route)
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if failure != nil {
+			if failure.retryAfter != "" {
+				w.Header().Set("Retry-After", failure.retryAfter)
+			}
+			writeError(w, failure.status, fmt.Errorf("%s failed with the scripted status %d", route, failure.status))
+			return
+		}
+		if auth && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			writeError(w, http.StatusUnauthorized, errors.New("missing bearer token"))
+			return
+		}
+
+		status, body, err := fn(request{Request: r, id: r.PathValue("id"), b: s.backend(r.PathValue("cloud_instance_id"))})
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				status = http.StatusNotFound
+			} else if status < http.StatusBadRequest {
+				status = http.StatusBadRequest
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, status, body)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes an error in the format of the PowerVS API.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &models.Error{
+		Code:        int64(status),
+		Description: err.Error(),
+		Error:       http.StatusText(status),
+	})
+}
+
+// token exchanges an API key or a compute resource token for an unsigned access token, as IAM does.
+func (s *Server) token(r request) (int, interface{}, error) {
+	if err := r.ParseForm(); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "urn:ibm:params:oauth:grant-type:apikey":
+		if r.PostForm.Get("apikey") == "" {
+			return http.StatusBadRequest, nil, errors.New("provided API key could not be found")
+		}
+	case "urn:ibm:params:oauth:grant-type:cr-token":
+		if r.PostForm.Get("cr_token") == "" {
+			return http.StatusBadRequest, nil, errors.New("provided compute resource token could not be found")
+		}
+		if r.PostForm.Get("profile_id") == "" && r.PostForm.Get("profile_name") == "" {
+			return http.StatusBadRequest, nil, errors.New("a trusted profile is required")
+		}
+	default:
+		return http.StatusBadRequest, nil, fmt.Errorf("unsupported grant type %q", grantType)
+	}
+	token, err := accessToken()
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, &core.IamTokenServerResponse{
+		AccessToken:  token,
+		RefreshToken: "refresh",
+		TokenType:    "Bearer",
+		ExpiresIn:    3600,
+		Expiration:   time.Now().Unix() + 3600,
+	}, nil
+}
+
+// instanceIdentityToken returns the identity token of the VPC instance, as its metadata service does.
+func (s *Server) instanceIdentityToken(r request) (int, interface{}, error) {
+	if r.Header.Get("Metadata-Flavor") != "ibm" {
+		return http.StatusBadRequest, nil, errors.New("missing Metadata-Flavor header")
+	}
+	return http.StatusOK, vpcToken("instance-identity"), nil
+}
+
+// instanceIAMToken exchanges the identity token of the VPC instance for an IAM access token.
+func (s *Server) instanceIAMToken(request) (int, interface{}, error) {
+	token, err := accessToken()
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, vpcToken(token), nil
+}
+
+func vpcToken(token string) map[string]interface{} {
+	now := time.Now().UTC()
+	return map[string]interface{}{
+		"access_token": token,
+		"created_at":   now.Format(time.RFC3339),
+		"expires_at":   now.Add(time.Hour).Format(time.RFC3339),
+		"expires_in":   3600,
+	}
+}
+
+// accessToken returns an unsigned IAM access token of the account.
+func accessToken() (string, error) {
+	now := time.Now().Unix()
+	claims, err := json.Marshal(map[string]interface{}{
+		"iam_id":  "iam-fake",
+		"iat":     now,
+		"exp":     now + 3600,
+		"account": map[string]string{"bss": AccountID},
+	})
+	if err != nil {
+		return "", err
+	}
+	segment := base64.RawURLEncoding.EncodeToString
+	return segment([]byte(`{"alg":"none"}`)) + "." + segment(claims) + "." + segment([]byte("fake")), nil
+}
+
+func (s *Server) attachTag(r request) (int, interface{}, error) {
+	var body struct {
+		Resources []globaltaggingv1.Resource `json:"resources"`
+		TagNames  []string                   `json:"tag_names"`
+		TagType   *string                    `json:"tag_type"`
+	}
+	if err := r.decode(&body); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	options := &globaltaggingv1.AttachTagOptions{Resources: body.Resources, TagNames: body.TagNames, TagType: body.TagType}
+	results, _, err := s.Backend.TaggingClient().AttachTagWithContext(r.Context(), options)
+	return http.StatusOK, results, err
+}
+
+func (s *Server) listTags(r request) (int, interface{}, error) {
+	options := &globaltaggingv1.ListTagsOptions{AttachedTo: core.StringPtr(r.URL.Query().Get("attached_to"))}
+	list, _, err := s.Backend.TaggingClient().ListTagsWithContext(r.Context(), options)
+	return http.StatusOK, list, err
+}
+
+func (s *Server) search(r request) (int, interface{}, error) {
+	options := &globalsearchv2.SearchOptions{}
+	if err := r.decode(options); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	result, _, err := s.Backend.SearchClient().SearchWithContext(r.Context(), options)
+	return http.StatusOK, result, err
+}
+
+// listResourceInstances lists the workspaces matching the name, guid and resource_id query parameters.
+func (s *Server) listResourceInstances(r request) (int, interface{}, error) {
+	query := r.URL.Query()
+	resources := []map[string]interface{}{}
+	s.Backend.mu.Lock()
+	defer s.Backend.mu.Unlock()
+	for _, w := range s.Backend.workspaces {
+		if name := query.Get("name"); name != "" && name != w.name {
+			continue
+		}
+		if guid := query.Get("guid"); guid != "" && guid != w.guid {
+			continue
+		}
+		if id := query.Get("resource_id"); id != "" && id != common.PowerVSResourceID {
+			continue
+		}
+		resources = append(resources, map[string]interface{}{
+			"guid":        w.guid,
+			"name":        w.name,
+			"crn":         fmt.Sprintf("crn:v1:bluemix:public:power-iaas:%s:a/%s:%s::", w.zone, AccountID, w.guid),
+			"region_id":   w.zone,
+			"resource_id": common.PowerVSResourceID,
+			"state":       "active",
+		})
+	}
+	return http.StatusOK, map[string]interface{}{"rows_count": len(resources), "resources": resources}, nil
+}
+
+// instanceList returns the instances of the workspace, as listed by the API.
+func (b *Backend) instanceList() (*models.PVMInstances, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("InstanceClient.GetAll"); err != nil {
+		return nil, err
+	}
+	list := &models.PVMInstances{PvmInstances: []*models.PVMInstanceReference{}}
+	for _, id := range sortedKeys(b.instances) {
+		var ref models.PVMInstanceReference
+		if err := convert(b.instances[id].m, &ref); err != nil {
+			return nil, err
+		}
+		list.PvmInstances = append(list.PvmInstances, &ref)
+	}
+	return list, nil
+}
+
+// networkList returns the networks of the workspace, as listed by the API.
+func (b *Backend) networkList() (*models.Networks, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("NetworkClient.GetAll"); err != nil {
+		return nil, err
+	}
+	list := &models.Networks{Networks: []*models.NetworkReference{}}
+	for _, id := range sortedKeys(b.networks) {
+		var ref models.NetworkReference
+		if err := convert(b.networks[id], &ref); err != nil {
+			return nil, err
+		}
+		list.Networks = append(list.Networks, &ref)
+	}
+	return list, nil
+}
+
+// dhcpServerList returns the DHCP servers of the workspace, as listed by the API.
+func (b *Backend) dhcpServerList() (models.DHCPServers, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("DHCPClient.GetAll"); err != nil {
+		return nil, err
+	}
+	list := models.DHCPServers{}
+	for _, id := range sortedKeys(b.dhcpServers) {
+		var server models.DHCPServer
+		if err := convert(b.dhcpServers[id].m, &server); err != nil {
+			return nil, err
+		}
+		list = append(list, &server)
+	}
+	return list, nil
+}
+
+// convert copies the fields two API models have in common.
+func convert(from, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
@@ -0,0 +1,37 @@
+package powervs
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// resourceCreated records a created resource in the cleanup journal and the event log, when the
+// build keeps them. A journal that cannot be written is reported but does not fail the build.
+func resourceCreated(state multistep.StateBag, resourceType, id, name string) {
+	eventLog(state).ResourceCreated(resourceType, id, name)
+	journal, ok := state.GetOk("journal")
+	if !ok {
+		return
+	}
+	if err := journal.(*common.Journal).Add(resourceType, id, name); err != nil {
+		ui := state.Get("ui").(packersdk.Ui)
+		ui.Error(fmt.Sprintf("Failed to record %s %s in the cleanup journal: %v", resourceType, id, err))
+	}
+}
+
+// resourceDeleted forgets a deleted resource in the cleanup journal and records it in the event log,
+// when the build keeps them.
+func resourceDeleted(state multistep.StateBag, resourceType, id string) {
+	eventLog(state).ResourceDeleted(resourceType, id)
+	journal, ok := state.GetOk("journal")
+	if !ok {
+		return
+	}
+	if err := journal.(*common.Journal).Remove(resourceType, id); err != nil {
+		ui := state.Get("ui").(packersdk.Ui)
+		ui.Error(fmt.Sprintf("Failed to remove %s %s from the cleanup journal: %v", resourceType, id, err))
+	}
+}
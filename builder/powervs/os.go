@@ -0,0 +1,94 @@
+package powervs
+
+import (
+	"strings"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+const (
+	OSTypeLinux = "linux"
+	OSTypeAIX   = "aix"
+	OSTypeIBMi  = "ibmi"
+
+	DeploymentTypeVTL = "VTL"
+)
+
+// osDefaults holds the settings the builder applies for an OS type when the user leaves them unset.
+type osDefaults struct {
+	// ShutdownBehavior used when shutdown_behavior is not set.
+	ShutdownBehavior string
+	// ShutdownCommand run in the guest for soft-stop when shutdown_command is not set.
+	ShutdownCommand string
+	// ShutdownSudo runs ShutdownCommand with sudo when the SSH user is not root.
+	ShutdownSudo bool
+	// UserData passed to the instance when user_data is not set.
+	UserData string
+	// DeploymentType of the instance when deployment_type is not set.
+	DeploymentType string
+	// LicenseRepositoryCapacity of the instance, in TiB, when license_repository_capacity is not set.
+	LicenseRepositoryCapacity int64
+	// CleanName applies the naming rules of the OS to the instance name, after the clean_resource_name
+	// ones. Nil keeps the name.
+	CleanName func(string) string
+}
+
+var osDefaultsByType = map[string]osDefaults{
+	OSTypeLinux: {
+		ShutdownBehavior: common.ShutdownBehaviorStop,
+		ShutdownCommand:  "shutdown -h now",
+		ShutdownSudo:     true,
+	},
+	OSTypeAIX: {
+		ShutdownBehavior: common.ShutdownBehaviorSoftStop,
+		ShutdownCommand:  "shutdown -F",
+		ShutdownSudo:     true,
+	},
+	OSTypeIBMi: {
+		ShutdownBehavior: common.ShutdownBehaviorSoftStop,
+		ShutdownCommand:  `system "PWRDWNSYS OPTION(*IMMED) RESTART(*NO) CONFIRM(*NO)"`,
+		// PowerVS only takes a license repository capacity with the VTL deployment type.
+		DeploymentType:            DeploymentTypeVTL,
+		LicenseRepositoryCapacity: 1,
+		CleanName:                 cleanIBMiName,
+		// The IBM i OpenSSH server is not started by default, start it through cloud-init so the
+		// communicator can connect and keep it autostarted for instances deployed from the image.
+		UserData: `#cloud-config
+runcmd:
+  - system "CHGTCPSVR SVRSPCVAL(*SSHD) AUTOSTART(*YES)"
+  - system "STRTCPSVR SERVER(*SSHD)"
+`,
+	},
+}
+
+// cleanIBMiName returns the instance name with the clean_resource_name rules, without underscores: IBM i
+// takes its TCP/IP host name from the instance name, and host names have none.
+func cleanIBMiName(name string) string {
+	return strings.ReplaceAll(common.CleanResourceName(name), "_", "-")
+}
+
+// imageOSType returns the OS type of an image from its specifications, defaulting to Linux.
+func imageOSType(imageRef *models.ImageReference) string {
+	if imageRef == nil || imageRef.Specifications == nil {
+		return OSTypeLinux
+	}
+	switch os := strings.ToLower(imageRef.Specifications.OperatingSystem); {
+	case strings.HasPrefix(os, OSTypeAIX):
+		return OSTypeAIX
+	case strings.HasPrefix(os, OSTypeIBMi), strings.HasPrefix(os, "ibm i"), strings.HasPrefix(os, "os400"):
+		return OSTypeIBMi
+	default:
+		return OSTypeLinux
+	}
+}
+
+// stateOSDefaults returns the defaults for the OS type detected by StepImageBaseImage.
+func stateOSDefaults(osType interface{}) osDefaults {
+	if t, ok := osType.(string); ok {
+		if d, ok := osDefaultsByType[t]; ok {
+			return d
+		}
+	}
+	return osDefaultsByType[OSTypeLinux]
+}
@@ -0,0 +1,139 @@
+package powervs
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/IBM/go-sdk-core/v5/core"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+func testImageRef(os string) *models.ImageReference {
+	return &models.ImageReference{
+		ImageID:        core.StringPtr("image-id"),
+		StorageType:    core.StringPtr(StorageTypeTier1),
+		Specifications: &models.ImageSpecifications{OperatingSystem: os},
+	}
+}
+
+func TestImageOSType(t *testing.T) {
+	tests := []struct {
+		name     string
+		imageRef *models.ImageReference
+		want     string
+	}{
+		{name: "nil image", imageRef: nil, want: OSTypeLinux},
+		{name: "no specifications", imageRef: &models.ImageReference{}, want: OSTypeLinux},
+		{name: "rhel", imageRef: testImageRef("rhel"), want: OSTypeLinux},
+		{name: "aix", imageRef: testImageRef("aix"), want: OSTypeAIX},
+		{name: "ibmi", imageRef: testImageRef("ibmi"), want: OSTypeIBMi},
+		{name: "ibmi upper case", imageRef: testImageRef("IBMi"), want: OSTypeIBMi},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imageOSType(tt.imageRef); got != tt.want {
+				t.Errorf("imageOSType() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepCreateInstance_OSDefaults(t *testing.T) {
+	tests := []struct {
+		name               string
+		osType             string
+		userData           string
+		deploymentType     string
+		lrc                int64
+		wantName           string
+		wantDeploymentType string
+		wantLRC            int64
+		wantUserDataPart   string
+	}{
+		{name: "ibmi defaults", osType: OSTypeIBMi, wantName: "packer-test-1", wantDeploymentType: DeploymentTypeVTL, wantLRC: 1, wantUserDataPart: "STRTCPSVR SERVER(*SSHD)"},
+		{name: "ibmi keeps settings", osType: OSTypeIBMi, userData: "custom", deploymentType: DeploymentTypeVTL, lrc: 10, wantName: "packer-test-1", wantDeploymentType: DeploymentTypeVTL, wantLRC: 10, wantUserDataPart: "custom"},
+		{name: "ibmi deployment type without capacity default", osType: OSTypeIBMi, deploymentType: "VMNoStorage", wantName: "packer-test-1", wantDeploymentType: "VMNoStorage", wantLRC: 0, wantUserDataPart: "STRTCPSVR SERVER(*SSHD)"},
+		{name: "linux has no defaults", osType: OSTypeLinux, wantName: "packer-test_1", wantDeploymentType: "", wantLRC: 0, wantUserDataPart: ""},
+		{name: "linux ignores license repository capacity", osType: OSTypeLinux, deploymentType: "VMNoStorage", lrc: 10, wantName: "packer-test_1", wantDeploymentType: "VMNoStorage", wantLRC: 0, wantUserDataPart: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := fake.NewBackend()
+			state := testCreateInstanceState(t, backend, tt.osType)
+
+			step := &StepCreateInstance{
+				InstanceName:              "packer-test_1",
+				UserData:                  tt.userData,
+				DeploymentType:            tt.deploymentType,
+				LicenseRepositoryCapacity: tt.lrc,
+			}
+			assertContinued(t, step.Run(context.Background(), state), state)
+
+			created := backend.InstanceRequest(*state.Get("instance").(*models.PVMInstance).PvmInstanceID)
+			if *created.ServerName != tt.wantName {
+				t.Errorf("ServerName = %s, want %s", *created.ServerName, tt.wantName)
+			}
+			if created.LicenseRepositoryCapacity != tt.wantLRC {
+				t.Errorf("LicenseRepositoryCapacity = %d, want %d", created.LicenseRepositoryCapacity, tt.wantLRC)
+			}
+			if created.DeploymentType != tt.wantDeploymentType {
+				t.Errorf("DeploymentType = %s, want %s", created.DeploymentType, tt.wantDeploymentType)
+			}
+			userData, err := b64.StdEncoding.DecodeString(created.UserData)
+			if err != nil {
+				t.Fatalf("failed to decode user data: %v", err)
+			}
+			if !strings.Contains(string(userData), tt.wantUserDataPart) {
+				t.Errorf("UserData = %q, want it to contain %q", userData, tt.wantUserDataPart)
+			}
+		})
+	}
+}
+
+func TestStepPrepare_OSDefaults(t *testing.T) {
+	tests := []struct {
+		name        string
+		os          string
+		behavior    string
+		wantActions []string
+		wantCommand string
+	}{
+		{name: "linux stops through the API", os: "rhel", wantActions: []string{common.ShutdownBehaviorStop}},
+		{name: "aix shuts down in the guest", os: "aix", wantCommand: "shutdown -F"},
+		{name: "ibmi powers down in the guest", os: "ibmi", wantCommand: "PWRDWNSYS"},
+		{name: "explicit behavior wins", os: "aix", behavior: common.ShutdownBehaviorImmediateShutdown, wantActions: []string{common.ShutdownBehaviorImmediateShutdown}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := fake.NewBackend()
+			state, id := testInstanceState(t, backend, tt.os)
+			comm := new(packersdk.MockCommunicator)
+			state.Put("communicator", comm)
+			if tt.wantCommand != "" {
+				// The fake guest powers off as soon as the command is sent.
+				backend.SetInstanceStatus(id, InstanceStatusShutoff)
+			}
+
+			step := &StepPrepare{ShutdownBehavior: tt.behavior}
+			assertContinued(t, step.Run(context.Background(), state), state)
+
+			if actions := backend.InstanceActions(id); strings.Join(actions, ",") != strings.Join(tt.wantActions, ",") {
+				t.Errorf("actions = %v, want %v", actions, tt.wantActions)
+			}
+			if tt.wantCommand == "" {
+				if comm.StartCalled {
+					t.Errorf("unexpected command run in the guest: %s", comm.StartCmd.Command)
+				}
+				return
+			}
+			if !comm.StartCalled || !strings.Contains(comm.StartCmd.Command, tt.wantCommand) {
+				t.Errorf("expected %q to be run in the guest", tt.wantCommand)
+			}
+		})
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/IBM-Cloud/power-go-client/clients/instance"
 	"github.com/IBM-Cloud/power-go-client/power/models"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -18,25 +20,32 @@ const (
 	CaptureJobPollInterval  = 5 * time.Minute
 )
 
+const (
+	CaptureDestinationImageCatalog = "image-catalog"
+	CaptureDestinationCloudStorage = "cloud-storage"
+	CaptureDestinationBoth         = "both"
+)
+
 var (
-	CaptureDestinationDefault = "cloud-storage"
+	CaptureDestinationDefault = CaptureDestinationCloudStorage
 )
 
 type StepCaptureInstance struct {
-	Capture common.Capture
+	Capture   common.Capture
+	ImageTags []string
 }
 
-func (s *StepCaptureInstance) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+func (s *StepCaptureInstance) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
 	ui.Say("Capturing Instance")
 
-	instanceClient := state.Get("instanceClient").(*instance.IBMPIInstanceClient)
+	instanceClient := state.Get("instanceClient").(common.InstanceClient)
 	i := state.Get("instance").(*models.PVMInstance)
 
 	in, err := instanceClient.Get(*i.PvmInstanceID)
 	if err != nil {
 		ui.Error(fmt.Sprintf(
-			"failed to get instance: %s, err: %v", *in.ServerName, err))
+			"failed to get instance: %s, err: %v", *i.ServerName, err))
 		state.Put("error", fmt.Errorf("failed to get instance: %w", err))
 		return multistep.ActionHalt
 	}
@@ -46,9 +55,19 @@ func (s *StepCaptureInstance) Run(_ context.Context, state multistep.StateBag) m
 		captureDestination = s.Capture.Destination
 	}
 
+	imageClient := state.Get("imageClient").(common.ImageClient)
+	captureName, err := s.captureName(imageClient)
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to name the captured image: %v", err))
+		state.Put("error", fmt.Errorf("failed to name the captured image: %w", err))
+		return multistep.ActionHalt
+	}
+	ui.Say(fmt.Sprintf("Capture name: %s", captureName))
+	state.Put("capture_name", captureName)
+
 	body := &models.PVMInstanceCapture{
 		CaptureDestination: &captureDestination,
-		CaptureName:        &s.Capture.Name,
+		CaptureName:        &captureName,
 	}
 	if s.Capture.COS != nil {
 		body.CloudStorageAccessKey = s.Capture.COS.AccessKey
@@ -64,36 +83,122 @@ func (s *StepCaptureInstance) Run(_ context.Context, state multistep.StateBag) m
 		return multistep.ActionHalt
 	}
 
-	jobClient := state.Get("jobClient").(*instance.IBMPIJobClient)
+	jobClient := state.Get("jobClient").(common.JobClient)
 	begin := time.Now()
 loop:
 	for {
 		job, err := jobClient.Get(*jobRef.ID)
-		ui.Say(fmt.Sprintf("Job state: %s, progress: %s, message: %s", *job.Status.State, *job.Status.Progress, job.Status.Message))
 		if err != nil {
 			ui.Error(fmt.Sprintf("failed to Get capture Job: %+v", err))
 			state.Put("error", fmt.Errorf("failed to Get capture Job: %w", err))
 			return multistep.ActionHalt
 		}
+		ui.Say(JobStatus(job))
+		jobProgress(state, *jobRef.ID, job)
 		switch *job.Status.State {
 		case "failed":
+			ui.Error(fmt.Sprintf("capture job failed: %s", job.Status.Message))
+			state.Put("error", fmt.Errorf("capture job failed: %s", job.Status.Message))
 			return multistep.ActionHalt
 		case "completed":
 			break loop
 		default:
-			if time.Since(begin) >= CaptureJobWaitThreshold {
+			if time.Since(begin) >= polling.captureTimeout {
 				ui.Error("timed out while waiting for image to be captured")
 				state.Put("error", errors.New("timed out while waiting for image to be captured"))
 				return multistep.ActionHalt
 			}
-			ui.Say(fmt.Sprintf("Sleeping for %s", CaptureJobPollInterval))
-			time.Sleep(CaptureJobPollInterval)
+			ui.Say(fmt.Sprintf("Sleeping for %s", polling.captureInterval))
+			time.Sleep(polling.captureInterval)
 		}
 	}
 
+	if captureDestination == CaptureDestinationCloudStorage {
+		return multistep.ActionContinue
+	}
+
+	image, err := findImageByName(imageClient, captureName)
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to find the captured image: %v", err))
+		state.Put("error", fmt.Errorf("failed to find the captured image: %w", err))
+		return multistep.ActionHalt
+	}
+	ui.Say(fmt.Sprintf("Captured image found with ID: %s", *image.ImageID))
+	state.Put("captured_image", image)
+
+	tags := s.ImageTags
+	if fingerprint, ok := state.GetOk("fingerprint"); ok {
+		tags = append(slices.Clone(tags), common.FingerprintTag(fingerprint.(string)))
+	}
+	if err := attachTags(ctx, state, string(image.Crn), tags); err != nil {
+		ui.Error(fmt.Sprintf("failed to tag the captured image: %v", err))
+		state.Put("error", fmt.Errorf("failed to tag the captured image: %w", err))
+		return multistep.ActionHalt
+	}
+
 	return multistep.ActionContinue
 }
 
+// nameSuffixTimestampLayout is the layout of the suffix of the timestamp name_suffix strategy.
+const nameSuffixTimestampLayout = "20060102150405"
+
+// captureName returns the capture name with the suffix of the name_suffix strategy.
+func (s *StepCaptureInstance) captureName(imageClient common.ImageClient) (string, error) {
+	switch s.Capture.NameSuffix {
+	case common.NameSuffixTimestamp:
+		return fmt.Sprintf("%s-%s", s.Capture.Name, time.Now().UTC().Format(nameSuffixTimestampLayout)), nil
+	case common.NameSuffixBuildNumber:
+		images, err := imageClient.GetAll()
+		if err != nil {
+			return "", err
+		}
+		last := 0
+		for _, image := range images.Images {
+			if image.Name == nil {
+				continue
+			}
+			n, ok := buildNumber(*image.Name, s.Capture.Name)
+			if ok && n > last {
+				last = n
+			}
+		}
+		return fmt.Sprintf("%s-%d", s.Capture.Name, last+1), nil
+	}
+	return s.Capture.Name, nil
+}
+
+// buildNumber returns the number of an image named `<prefix>-<number>`.
+func buildNumber(name, prefix string) (int, bool) {
+	suffix, ok := strings.CutPrefix(name, prefix+"-")
+	if !ok || suffix == "" || strings.TrimLeft(suffix, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(suffix)
+	return n, err == nil
+}
+
+// findImageByName returns the most recently created catalog image with the given name.
+func findImageByName(imageClient common.ImageClient, name string) (*models.ImageReference, error) {
+	images, err := imageClient.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var found *models.ImageReference
+	for _, image := range images.Images {
+		if image.Name == nil || *image.Name != name {
+			continue
+		}
+		if found == nil || (image.CreationDate != nil && found.CreationDate != nil &&
+			time.Time(*image.CreationDate).After(time.Time(*found.CreationDate))) {
+			found = image
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no image named %s in the image catalog", name)
+	}
+	return found, nil
+}
+
 // Cleanup can be used to clean up any artifact created by the step.
 // A step's clean up always run at the end of a build, regardless of whether provisioning succeeds or fails.
 func (s *StepCaptureInstance) Cleanup(_ multistep.StateBag) {
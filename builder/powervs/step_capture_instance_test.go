@@ -0,0 +1,79 @@
+package powervs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+func TestStepCaptureInstance_CloudStorage(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.JobPolls = 2
+	state, id := testInstanceState(t, backend, "rhel")
+
+	step := &StepCaptureInstance{Capture: common.Capture{
+		Name: "captured",
+		COS:  &common.CaptureCOS{Bucket: "bucket", Region: "us-south", AccessKey: "access", SecretKey: "secret"},
+	}}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	capture := backend.InstanceCapture(id)
+	if *capture.CaptureDestination != CaptureDestinationCloudStorage || capture.CloudStorageImagePath != "bucket" {
+		t.Errorf("capture = %+v, want a capture to the bucket", capture)
+	}
+	if _, ok := state.GetOk("captured_image"); ok {
+		t.Error("captured_image set for a cloud-storage capture")
+	}
+}
+
+func TestStepCaptureInstance_ImageCatalog(t *testing.T) {
+	backend := fake.NewBackend()
+	state, _ := testInstanceState(t, backend, "rhel")
+
+	step := &StepCaptureInstance{
+		Capture:   common.Capture{Name: "captured", Destination: CaptureDestinationImageCatalog},
+		ImageTags: []string{"packer:test"},
+	}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	image := state.Get("captured_image").(*models.ImageReference)
+	if *image.Name != "captured" {
+		t.Errorf("captured_image = %s, want captured", *image.Name)
+	}
+	if tags := backend.Tags(string(image.Crn)); len(tags) != 1 {
+		t.Errorf("tags = %v, want the image tags", tags)
+	}
+}
+
+func TestStepCaptureInstance_CaptureError(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.FailOn("InstanceClient.CaptureInstanceToImageCatalogV2", errors.New("instance not stopped"))
+	state, _ := testInstanceState(t, backend, "rhel")
+
+	step := &StepCaptureInstance{Capture: common.Capture{Name: "captured"}}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepCaptureInstance_JobFailed(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.JobResult = fake.JobStateFailed
+	state, _ := testInstanceState(t, backend, "rhel")
+
+	step := &StepCaptureInstance{Capture: common.Capture{Name: "captured", Destination: CaptureDestinationImageCatalog}}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepCaptureInstance_JobTimeout(t *testing.T) {
+	setDuration(t, &polling.captureTimeout, 20*time.Millisecond)
+	backend := fake.NewBackend()
+	backend.JobPolls = 1 << 30
+	state, _ := testInstanceState(t, backend, "rhel")
+
+	step := &StepCaptureInstance{Capture: common.Capture{Name: "captured"}}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
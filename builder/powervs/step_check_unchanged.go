@@ -0,0 +1,160 @@
+package powervs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globalsearchv2"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// StepCheckUnchanged computes the fingerprint of the build and looks for an image of the image
+// catalog tagged with it. When there is one, the build is not needed: the step halts it with the
+// image as captured_image and unchanged set, and Builder.Run returns the image as the artifact.
+type StepCheckUnchanged struct {
+	Source              common.Source
+	UserData            string
+	ContentHash         string
+	UsePrivateEndpoints bool
+
+	// cosClient reads the source object, created from Source.COS when nil.
+	cosClient common.COSClient
+}
+
+func (s *StepCheckUnchanged) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	ui.Say("Looking for an image built from the same inputs")
+
+	sourceImageID, err := s.sourceImageID(ctx, state.Get("imageClient").(common.ImageClient))
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to resolve the source image: %v", err))
+		state.Put("error", fmt.Errorf("failed to resolve the source image: %w", err))
+		return multistep.ActionHalt
+	}
+	fingerprint := common.Fingerprint(sourceImageID, s.UserData, s.ContentHash)
+	ui.Say(fmt.Sprintf("Build fingerprint: %s", fingerprint))
+	state.Put("fingerprint", fingerprint)
+
+	image, err := findImageByTag(ctx, state, common.FingerprintTag(fingerprint))
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to look for an image with the fingerprint: %v", err))
+		state.Put("error", fmt.Errorf("failed to look for an image with the fingerprint: %w", err))
+		return multistep.ActionHalt
+	}
+	if image == nil {
+		ui.Say("No image built from the same inputs, building")
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Image %s (%s) was built from the same inputs, skipping the build", *image.Name, *image.ImageID))
+	state.Put("captured_image", image)
+	state.Put("unchanged", true)
+	return multistep.ActionHalt
+}
+
+// sourceImageID returns the ID of the stock image or of the catalog image, or the location and ETag of
+// the object imported from Cloud Object Storage, so that replacing the object changes the fingerprint.
+func (s *StepCheckUnchanged) sourceImageID(ctx context.Context, imageClient common.ImageClient) (string, error) {
+	switch {
+	case s.Source.COS != nil:
+		return s.cosObjectID(ctx)
+	case s.Source.StockImage != nil:
+		stockImages, err := imageClient.GetAllStockImages(true, true)
+		if err != nil {
+			return "", err
+		}
+		for _, image := range stockImages.Images {
+			if *image.Name == s.Source.StockImage.Name {
+				return *image.ImageID, nil
+			}
+		}
+		return "", fmt.Errorf("no stock image named %s", s.Source.StockImage.Name)
+	default:
+		image, err := findImageByName(imageClient, s.Source.Name)
+		if err != nil {
+			return "", err
+		}
+		return *image.ImageID, nil
+	}
+}
+
+// cosObjectID returns the location of the source object with its ETag, or its last modification time
+// when COS returns no ETag.
+func (s *StepCheckUnchanged) cosObjectID(ctx context.Context) (string, error) {
+	cos := s.Source.COS
+	if s.cosClient == nil {
+		client, err := common.NewSourceCOSClient(cos, common.COSEndpoint(cos.Region, s.UsePrivateEndpoints))
+		if err != nil {
+			return "", err
+		}
+		s.cosClient = client
+	}
+	head, err := s.cosClient.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(cos.Bucket),
+		Key:    aws.String(cos.Object),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read the object %s of the bucket %s: %w", cos.Object, cos.Bucket, err)
+	}
+	version := aws.StringValue(head.ETag)
+	if version == "" && head.LastModified != nil {
+		version = head.LastModified.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("cos://%s/%s/%s@%s", cos.Region, cos.Bucket, cos.Object, version), nil
+}
+
+// findImageByTag returns the most recently created catalog image with the user tag, nil when there is
+// none. One Global Search query finds the CRNs of the resources with the tag.
+func findImageByTag(ctx context.Context, state multistep.StateBag, tag string) (*models.ImageReference, error) {
+	imageClient := state.Get("imageClient").(common.ImageClient)
+	searchClient := state.Get("searchClient").(common.SearchClient)
+
+	result, _, err := searchClient.SearchWithContext(ctx, &globalsearchv2.SearchOptions{
+		Query:  core.StringPtr(fmt.Sprintf("tags:%q", tag)),
+		Fields: []string{"crn"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search the resources tagged %s: %w", tag, err)
+	}
+	tagged := make(map[string]bool, len(result.Items))
+	for _, item := range result.Items {
+		if item.CRN != nil {
+			tagged[*item.CRN] = true
+		}
+	}
+	if len(tagged) == 0 {
+		return nil, nil
+	}
+
+	images, err := imageClient.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var found *models.ImageReference
+	for _, image := range images.Images {
+		if tagged[string(image.Crn)] && (found == nil || imageCreationDate(image).After(imageCreationDate(found))) {
+			found = image
+		}
+	}
+	return found, nil
+}
+
+func imageCreationDate(image *models.ImageReference) time.Time {
+	if image.CreationDate == nil {
+		return time.Time{}
+	}
+	return time.Time(*image.CreationDate)
+}
+
+// Cleanup can be used to clean up any artifact created by the step.
+// A step's clean up always run at the end of a build, regardless of whether provisioning succeeds or fails.
+func (s *StepCheckUnchanged) Cleanup(_ multistep.StateBag) {
+	// Nothing to clean
+}
@@ -0,0 +1,114 @@
+package powervs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+// headClient is a bucket with one object, read with HeadObject only.
+type headClient struct {
+	common.COSClient
+	key  string
+	etag string
+}
+
+func (c *headClient) HeadObjectWithContext(_ context.Context, input *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+	if *input.Key != c.key {
+		return nil, fmt.Errorf("no object %s", *input.Key)
+	}
+	return &s3.HeadObjectOutput{ETag: aws.String(c.etag), LastModified: aws.Time(time.Now())}, nil
+}
+
+// tagImage attaches the fingerprint tag to the image.
+func tagImage(t *testing.T, backend *fake.Backend, imageID, fingerprint string) {
+	t.Helper()
+	image, _ := backend.Image(imageID)
+	_, _, err := backend.TaggingClient().AttachTagWithContext(context.Background(), &globaltaggingv1.AttachTagOptions{
+		Resources: []globaltaggingv1.Resource{{ResourceID: core.StringPtr(string(image.Crn))}},
+		TagNames:  []string{common.FingerprintTag(fingerprint)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStepCheckUnchanged_CatalogSource(t *testing.T) {
+	backend := fake.NewBackend()
+	source := backend.AddImage("golden-base", "rhel")
+	state := testBackendState(t, backend)
+
+	step := &StepCheckUnchanged{Source: common.Source{Name: "golden-base"}, ContentHash: "hash-1"}
+	assertContinued(t, step.Run(context.Background(), state), state)
+	fingerprint := state.Get("fingerprint").(string)
+	if want := common.Fingerprint(source, "", "hash-1"); fingerprint != want {
+		t.Fatalf("fingerprint = %s, want the one of the catalog image %s", fingerprint, source)
+	}
+
+	// The most recent of the images with the fingerprint is the artifact.
+	older := backend.AddImage("golden-1", "rhel")
+	backend.SetImageCreationDate(older, time.Now().Add(-time.Hour))
+	tagImage(t, backend, older, fingerprint)
+	newer := backend.AddImage("golden-2", "rhel")
+	tagImage(t, backend, newer, fingerprint)
+
+	state = testBackendState(t, backend)
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt || state.Get("unchanged") != true {
+		t.Fatalf("Run() = %v, unchanged %v, error: %v", action, state.Get("unchanged"), state.Get("error"))
+	}
+	if image := state.Get("captured_image").(*models.ImageReference); *image.ImageID != newer {
+		t.Errorf("captured_image = %s, want %s", *image.ImageID, newer)
+	}
+	searches := 0
+	for _, call := range backend.Calls() {
+		if call == "SearchClient.Search" {
+			searches++
+		}
+	}
+	if searches != 2 {
+		t.Errorf("searches = %d, want one per run", searches)
+	}
+}
+
+func TestStepCheckUnchanged_MissingCatalogSource(t *testing.T) {
+	backend := fake.NewBackend()
+	state := testBackendState(t, backend)
+
+	step := &StepCheckUnchanged{Source: common.Source{Name: "golden-base"}}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepCheckUnchanged_COSSource(t *testing.T) {
+	backend := fake.NewBackend()
+	cos := &common.COS{Bucket: "images", Object: "rhel.ova.gz", Region: "us-south"}
+	client := &headClient{key: "rhel.ova.gz", etag: `"etag-1"`}
+
+	fingerprint := func() string {
+		t.Helper()
+		state := testBackendState(t, backend)
+		step := &StepCheckUnchanged{Source: common.Source{COS: cos}, cosClient: client}
+		assertContinued(t, step.Run(context.Background(), state), state)
+		return state.Get("fingerprint").(string)
+	}
+	first := fingerprint()
+	if again := fingerprint(); again != first {
+		t.Errorf("fingerprint = %s, want %s for the same object", again, first)
+	}
+
+	// Replacing the object changes the fingerprint.
+	client.etag = `"etag-2"`
+	if replaced := fingerprint(); replaced == first {
+		t.Error("fingerprint unchanged after the object was replaced")
+	}
+}
@@ -7,11 +7,11 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/IBM-Cloud/power-go-client/clients/instance"
 	"github.com/IBM-Cloud/power-go-client/power/models"
 	"github.com/IBM/go-sdk-core/v5/core"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
 )
 
 const (
@@ -22,19 +22,28 @@ const (
 )
 
 type StepCreateInstance struct {
-	InstanceName   string
-	KeyPairName    string
-	UserData       string
-	CleanupTimeout time.Duration
+	InstanceName     string
+	KeyPairName      string
+	UserData         string
+	CleanupTimeout   time.Duration
+	PlacementGroup   string
+	PinPolicy        string
+	AffinityPolicy   string
+	AffinityInstance string
+	HostID           string
+	DeploymentType   string
+	// LicenseRepositoryCapacity is only applied to IBM i instances.
+	LicenseRepositoryCapacity int64
+	RunTags                   []string
 
 	doCleanup bool
 }
 
-func (s *StepCreateInstance) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+func (s *StepCreateInstance) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
 	ui.Say("Creating Instance")
 
-	instanceClient := state.Get("instanceClient").(*instance.IBMPIInstanceClient)
+	instanceClient := state.Get("instanceClient").(common.InstanceClient)
 
 	net := state.Get("network").(*models.Network)
 
@@ -56,6 +65,28 @@ func (s *StepCreateInstance) Run(_ context.Context, state multistep.StateBag) mu
 		networks = append(networks, &models.PVMInstanceAddNetwork{NetworkID: net.NetworkID})
 	}
 
+	osType, _ := state.Get("os_type").(string)
+	defaults := stateOSDefaults(osType)
+	userData := s.UserData
+	if userData == "" {
+		userData = defaults.UserData
+	}
+	deploymentType := s.DeploymentType
+	if deploymentType == "" {
+		deploymentType = defaults.DeploymentType
+	}
+	capacity := s.LicenseRepositoryCapacity
+	if capacity == 0 && deploymentType == defaults.DeploymentType {
+		capacity = defaults.LicenseRepositoryCapacity
+	}
+	name := s.InstanceName
+	if defaults.CleanName != nil {
+		name = defaults.CleanName(name)
+		if name != s.InstanceName {
+			ui.Say(fmt.Sprintf("Naming the %s instance %s instead of %s", osType, name, s.InstanceName))
+		}
+	}
+
 	body := &models.PVMInstanceCreate{
 		ImageID:     imageRef.ImageID,
 		KeyPairName: s.KeyPairName,
@@ -63,9 +94,35 @@ func (s *StepCreateInstance) Run(_ context.Context, state multistep.StateBag) mu
 		Networks:    networks,
 		ProcType:    core.StringPtr("shared"),
 		Processors:  core.Float64Ptr(0.5),
-		ServerName:  &s.InstanceName,
+		ServerName:  &name,
 		StorageType: *imageRef.StorageType,
-		UserData:    b64.StdEncoding.EncodeToString([]byte(s.UserData)),
+		UserData:    b64.StdEncoding.EncodeToString([]byte(userData)),
+	}
+	body.DeploymentType = deploymentType
+	if capacity > 0 {
+		if osType == OSTypeIBMi {
+			body.LicenseRepositoryCapacity = capacity
+		} else {
+			ui.Say(fmt.Sprintf("Ignoring license_repository_capacity for a %s image", osType))
+		}
+	}
+	if s.PlacementGroup != "" {
+		body.PlacementGroup = s.PlacementGroup
+	}
+	if s.PinPolicy != "" {
+		body.PinPolicy = models.PinPolicy(s.PinPolicy)
+	}
+	if s.AffinityPolicy != "" {
+		body.StorageAffinity = &models.StorageAffinity{
+			AffinityPolicy:      &s.AffinityPolicy,
+			AffinityPVMInstance: &s.AffinityInstance,
+		}
+	}
+	if s.HostID != "" {
+		body.DeploymentTarget = &models.DeploymentTarget{
+			ID:   &s.HostID,
+			Type: core.StringPtr("host"),
+		}
 	}
 	ui.Say("Creating Instance")
 	ins, err := instanceClient.Create(body)
@@ -79,6 +136,7 @@ func (s *StepCreateInstance) Run(_ context.Context, state multistep.StateBag) mu
 	for _, in := range *ins {
 		insID := in.PvmInstanceID
 		insIDs = append(insIDs, *insID)
+		resourceCreated(state, common.ResourceTypeInstance, *insID, name)
 	}
 
 	if len(insIDs) == 0 {
@@ -90,7 +148,7 @@ func (s *StepCreateInstance) Run(_ context.Context, state multistep.StateBag) mu
 	var in *models.PVMInstance
 
 	//nolint:staticcheck // SA1015 this disable staticcheck for the next line
-	if err := pollUntil(time.Tick(30*time.Second), time.After(5*time.Minute), func() (bool, error) {
+	if err := pollUntil(time.Tick(polling.instanceCreateInterval), time.After(polling.instanceCreateTimeout), func() (bool, error) {
 		in, err = instanceClient.Get(insIDs[0])
 		if err != nil || in == nil {
 			ui.Say("No response or error encountered while retrieving the instance. Retrying...")
@@ -106,8 +164,17 @@ func (s *StepCreateInstance) Run(_ context.Context, state multistep.StateBag) mu
 	ui.Say(fmt.Sprintf("Instance Created, Name: %s, ID: %s", *in.ServerName, *in.PvmInstanceID))
 
 	state.Put("instance", in)
+	// instance_id is the ID of the build of the provisioners.
+	state.Put("instance_id", *in.PvmInstanceID)
+	generatedData(state).Put("InstanceID", *in.PvmInstanceID)
 	s.doCleanup = true
 
+	if err := attachTags(ctx, state, string(in.Crn), s.RunTags); err != nil {
+		ui.Error(fmt.Sprintf("failed to tag the instance: %v", err))
+		state.Put("error", fmt.Errorf("failed to tag the instance: %w", err))
+		return multistep.ActionHalt
+	}
+
 	return multistep.ActionContinue
 }
 
@@ -120,7 +187,7 @@ func (s *StepCreateInstance) Cleanup(state multistep.StateBag) {
 	ui := state.Get("ui").(packersdk.Ui)
 
 	ui.Say("Deleting the Instance")
-	instanceClient := state.Get("instanceClient").(*instance.IBMPIInstanceClient)
+	instanceClient := state.Get("instanceClient").(common.InstanceClient)
 	i := state.Get("instance").(*models.PVMInstance)
 
 	// Initiate deletion
@@ -144,12 +211,13 @@ func (s *StepCreateInstance) Cleanup(state multistep.StateBag) {
 	maxErrorStateRetries := 5 // Give some retries even in ERROR state
 
 	//nolint:staticcheck // SA1015 this disable staticcheck for the next line
-	err = pollUntil(time.Tick(CleanupPollInterval), time.After(timeout), func() (bool, error) {
+	err = pollUntil(time.Tick(polling.cleanupInterval), time.After(timeout), func() (bool, error) {
 		in, err := instanceClient.Get(*i.PvmInstanceID)
 
 		// Instance not found means it was successfully deleted
 		if err != nil {
 			ui.Say("Instance deleted successfully")
+			resourceDeleted(state, common.ResourceTypeInstance, *i.PvmInstanceID)
 			return true, nil
 		}
 
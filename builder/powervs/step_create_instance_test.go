@@ -0,0 +1,141 @@
+package powervs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+// testCreateInstanceState returns a state bag as left by StepImageBaseImage and StepCreateNetwork.
+func testCreateInstanceState(t *testing.T, backend *fake.Backend, os string) *multistep.BasicStateBag {
+	state := testBackendState(t, backend)
+	imageID := backend.AddImage("source-image", os)
+	images, err := backend.ImageClient().GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, image := range images.Images {
+		if *image.ImageID == imageID {
+			state.Put("source_image", image)
+			state.Put("os_type", imageOSType(image))
+		}
+	}
+	net, err := backend.NetworkClient().Get(backend.AddNetwork("network", "pub-vlan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Put("network", net)
+	return state
+}
+
+func TestStepCreateInstance(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.InstancePolls = 2
+	state := testCreateInstanceState(t, backend, "rhel")
+	state.Put("journal", common.NewJournal(t.TempDir()+"/journal.json", &common.AccessConfig{}))
+
+	step := &StepCreateInstance{
+		InstanceName:     "packer-test",
+		KeyPairName:      "key",
+		PlacementGroup:   "placement-group",
+		PinPolicy:        common.PinPolicySoft,
+		AffinityPolicy:   common.AffinityPolicyAntiAffinity,
+		AffinityInstance: "other-instance",
+		HostID:           "host",
+		RunTags:          []string{"packer:test"},
+	}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	in := state.Get("instance").(*models.PVMInstance)
+	created := backend.InstanceRequest(*in.PvmInstanceID)
+	if created.PlacementGroup != "placement-group" || created.PinPolicy != models.PinPolicy(common.PinPolicySoft) {
+		t.Errorf("placement group and pin policy not set: %q, %q", created.PlacementGroup, created.PinPolicy)
+	}
+	if created.StorageAffinity == nil || *created.StorageAffinity.AffinityPVMInstance != "other-instance" {
+		t.Errorf("storage affinity not set: %+v", created.StorageAffinity)
+	}
+	if created.DeploymentTarget == nil || *created.DeploymentTarget.ID != "host" {
+		t.Errorf("deployment target not set: %+v", created.DeploymentTarget)
+	}
+	if tags := backend.Tags(string(in.Crn)); len(tags) != 1 || tags[0] != "packer:test" {
+		t.Errorf("tags = %v, want [packer:test]", tags)
+	}
+	journal := state.Get("journal").(*common.Journal)
+	if len(journal.Resources) != 1 || journal.Resources[0].ID != *in.PvmInstanceID {
+		t.Errorf("journal = %+v, want the instance", journal.Resources)
+	}
+
+	step.Cleanup(state)
+	if ids := backend.InstanceIDs(); len(ids) != 0 {
+		t.Errorf("instances left after cleanup: %v", ids)
+	}
+	if len(journal.Resources) != 0 {
+		t.Errorf("journal not emptied by cleanup: %+v", journal.Resources)
+	}
+}
+
+func TestStepCreateInstance_CreateError(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.FailOn("InstanceClient.Create", errors.New("quota exceeded"))
+	state := testCreateInstanceState(t, backend, "rhel")
+
+	step := &StepCreateInstance{InstanceName: "packer-test"}
+	assertHalted(t, step.Run(context.Background(), state), state)
+
+	// Nothing was created, the cleanup must not try to delete anything.
+	step.Cleanup(state)
+	for _, call := range backend.Calls() {
+		if call == "InstanceClient.Delete" {
+			t.Error("cleanup deleted an instance that was never created")
+		}
+	}
+}
+
+func TestStepCreateInstance_GetTimeout(t *testing.T) {
+	setDuration(t, &polling.instanceCreateTimeout, 20*time.Millisecond)
+	backend := fake.NewBackend()
+	backend.FailOn("InstanceClient.Get", errors.New("service unavailable"))
+	state := testCreateInstanceState(t, backend, "rhel")
+
+	step := &StepCreateInstance{InstanceName: "packer-test"}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepCreateInstance_CleanupTimeout(t *testing.T) {
+	backend := fake.NewBackend()
+	state := testCreateInstanceState(t, backend, "rhel")
+	state.Put("journal", common.NewJournal(t.TempDir()+"/journal.json", &common.AccessConfig{}))
+
+	step := &StepCreateInstance{InstanceName: "packer-test", CleanupTimeout: 20 * time.Millisecond}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	// The instance never goes away within the cleanup timeout.
+	backend.DeletePolls = 1 << 30
+	step.Cleanup(state)
+	if ids := backend.InstanceIDs(); len(ids) != 1 {
+		t.Errorf("instances = %v, want the instance still being deleted", ids)
+	}
+	if journal := state.Get("journal").(*common.Journal); len(journal.Resources) != 1 {
+		t.Errorf("journal = %+v, want the instance kept for a later cleanup", journal.Resources)
+	}
+}
+
+func TestStepCreateInstance_CleanupDeleteError(t *testing.T) {
+	backend := fake.NewBackend()
+	state := testCreateInstanceState(t, backend, "rhel")
+
+	step := &StepCreateInstance{InstanceName: "packer-test"}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	backend.FailOn("InstanceClient.Delete", errors.New("forbidden"))
+	step.Cleanup(state)
+	if ids := backend.InstanceIDs(); len(ids) != 1 {
+		t.Errorf("instances = %v, want the instance kept", ids)
+	}
+}
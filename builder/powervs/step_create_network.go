@@ -5,11 +5,12 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/IBM-Cloud/power-go-client/clients/instance"
 	"github.com/IBM-Cloud/power-go-client/power/models"
 	"github.com/IBM/go-sdk-core/v5/core"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
 )
 
 const (
@@ -22,13 +23,14 @@ const (
 type StepCreateNetwork struct {
 	SubnetIDs   []string
 	DHCPNetwork bool
+	RunTags     []string
 	doCleanup   bool
 }
 
-func (s *StepCreateNetwork) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+func (s *StepCreateNetwork) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
 
-	networkClient := state.Get("networkClient").(*instance.IBMPINetworkClient)
+	networkClient := state.Get("networkClient").(common.NetworkClient)
 
 	if s.SubnetIDs != nil {
 		for i, subnetID := range s.SubnetIDs {
@@ -43,6 +45,7 @@ func (s *StepCreateNetwork) Run(_ context.Context, state multistep.StateBag) mul
 			if i == 0 {
 				ui.Say(fmt.Sprintf("Registering subnet %s as interface for ssh", subnetID))
 				state.Put("network", net)
+				generatedData(state).Put("NetworkID", *net.NetworkID)
 			}
 		}
 		// The subnets have been validated, let's pass them further as plain ids
@@ -61,6 +64,12 @@ func (s *StepCreateNetwork) Run(_ context.Context, state multistep.StateBag) mul
 			return multistep.ActionHalt
 		}
 		s.doCleanup = true
+		net := state.Get("network").(*models.Network)
+		if err := attachTags(ctx, state, string(net.Crn), s.RunTags); err != nil {
+			ui.Error(fmt.Sprintf("failed to tag the DHCP network: %v", err))
+			state.Put("error", fmt.Errorf("failed to tag the DHCP network: %w", err))
+			return multistep.ActionHalt
+		}
 		return multistep.ActionContinue
 	}
 
@@ -76,9 +85,17 @@ func (s *StepCreateNetwork) Run(_ context.Context, state multistep.StateBag) mul
 		return multistep.ActionHalt
 	}
 	ui.Say(fmt.Sprintf("Network Created, Name: %s, ID: %s", *net.Name, *net.NetworkID))
+	resourceCreated(state, common.ResourceTypeNetwork, *net.NetworkID, *net.Name)
 	state.Put("network", net)
+	generatedData(state).Put("NetworkID", *net.NetworkID)
 	s.doCleanup = true
 
+	if err := attachTags(ctx, state, string(net.Crn), s.RunTags); err != nil {
+		ui.Error(fmt.Sprintf("failed to tag the network: %v", err))
+		state.Put("error", fmt.Errorf("failed to tag the network: %w", err))
+		return multistep.ActionHalt
+	}
+
 	return multistep.ActionContinue
 }
 
@@ -95,27 +112,31 @@ func (s *StepCreateNetwork) Cleanup(state multistep.StateBag) {
 	if s.DHCPNetwork {
 		ui.Say("Deleting DHCP server")
 		dhcpServerID := state.Get("dhcpServerID").(string)
-		dhcpClient := state.Get("dhcpClient").(*instance.IBMPIDhcpClient)
+		dhcpClient := state.Get("dhcpClient").(common.DHCPClient)
 
 		if err := dhcpClient.Delete(dhcpServerID); err != nil {
 			ui.Error(fmt.Sprintf("Error cleaning up DHCP server. Please delete the DHCP server manually: %s error: %v", dhcpServerID, err.Error()))
+			return
 		}
+		resourceDeleted(state, common.ResourceTypeDHCPServer, dhcpServerID)
 		ui.Say("Successfully deleted DHCP server")
 		return
 	}
-	networkClient := state.Get("networkClient").(*instance.IBMPINetworkClient)
+	networkClient := state.Get("networkClient").(common.NetworkClient)
 	net := state.Get("network").(*models.Network)
 	err := networkClient.Delete(*net.NetworkID)
 	if err != nil {
 		ui.Error(fmt.Sprintf(
 			"Error cleaning up network. Please delete the network manually: %s", *net.Name))
+		return
 	}
+	resourceDeleted(state, common.ResourceTypeNetwork, *net.NetworkID)
 	ui.Say("Successfully deleted network")
 }
 
 func (s *StepCreateNetwork) createDHCPNetwork(state multistep.StateBag) error {
 	ui := state.Get("ui").(packersdk.Ui)
-	dhcpClient := state.Get("dhcpClient").(*instance.IBMPIDhcpClient)
+	dhcpClient := state.Get("dhcpClient").(common.DHCPClient)
 
 	dhcpServer, err := dhcpClient.Create(&models.DHCPServerCreate{})
 	if err != nil {
@@ -126,6 +147,7 @@ func (s *StepCreateNetwork) createDHCPNetwork(state multistep.StateBag) error {
 		return fmt.Errorf("error created DHCP server ID is nil")
 	}
 	state.Put("dhcpServerID", *dhcpServer.ID)
+	resourceCreated(state, common.ResourceTypeDHCPServer, *dhcpServer.ID, "")
 
 	startTime := time.Now()
 	var networkID string
@@ -139,19 +161,20 @@ func (s *StepCreateNetwork) createDHCPNetwork(state multistep.StateBag) error {
 			ui.Say("DHCP server in active state")
 			break
 		}
-		if time.Since(startTime) > DHCPServerActiveTimeOut {
-			return fmt.Errorf("error DHCP server did not become active even after %f min", DHCPServerActiveTimeOut.Minutes())
+		if time.Since(startTime) > polling.dhcpServerTimeout {
+			return fmt.Errorf("error DHCP server did not become active even after %f min", polling.dhcpServerTimeout.Minutes())
 		}
 		ui.Say("Wating for DHCP server to become active")
-		time.Sleep(DHCPServerInterval)
+		time.Sleep(polling.dhcpServerInterval)
 	}
 	ui.Say("Fetching network details")
-	networkClient := state.Get("networkClient").(*instance.IBMPINetworkClient)
+	networkClient := state.Get("networkClient").(common.NetworkClient)
 	// fetch the dhcp network details and store it for future usage.
 	net, err := networkClient.Get(networkID)
 	if err != nil {
 		return fmt.Errorf("error fetching network details with network id %s error: %v", networkID, err)
 	}
 	state.Put("network", net)
+	generatedData(state).Put("NetworkID", *net.NetworkID)
 	return nil
 }
@@ -0,0 +1,142 @@
+package powervs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+func TestStepCreateNetwork_Subnets(t *testing.T) {
+	backend := fake.NewBackend()
+	first := backend.AddNetwork("first", "vlan")
+	second := backend.AddNetwork("second", "vlan")
+	state := testBackendState(t, backend)
+
+	step := &StepCreateNetwork{SubnetIDs: []string{first, second}}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	if net := state.Get("network").(*models.Network); *net.NetworkID != first {
+		t.Errorf("network = %s, want the first subnet %s", *net.NetworkID, first)
+	}
+	if networks := state.Get("networks").([]string); len(networks) != 2 {
+		t.Errorf("networks = %v, want both subnets", networks)
+	}
+
+	// User specified subnets are never deleted.
+	step.Cleanup(state)
+	if ids := backend.NetworkIDs(); len(ids) != 2 {
+		t.Errorf("networks = %v, want both subnets kept", ids)
+	}
+}
+
+func TestStepCreateNetwork_SubnetNotFound(t *testing.T) {
+	backend := fake.NewBackend()
+	state := testBackendState(t, backend)
+
+	step := &StepCreateNetwork{SubnetIDs: []string{"missing"}}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepCreateNetwork_PublicNetwork(t *testing.T) {
+	backend := fake.NewBackend()
+	state := testBackendState(t, backend)
+	state.Put("journal", common.NewJournal(t.TempDir()+"/journal.json", &common.AccessConfig{}))
+
+	step := &StepCreateNetwork{RunTags: []string{"packer:test"}}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	net := state.Get("network").(*models.Network)
+	if *net.Type != "pub-vlan" {
+		t.Errorf("network type = %s, want pub-vlan", *net.Type)
+	}
+	if tags := backend.Tags(string(net.Crn)); len(tags) != 1 {
+		t.Errorf("tags = %v, want the run tags", tags)
+	}
+
+	step.Cleanup(state)
+	if ids := backend.NetworkIDs(); len(ids) != 0 {
+		t.Errorf("networks left after cleanup: %v", ids)
+	}
+	if journal := state.Get("journal").(*common.Journal); len(journal.Resources) != 0 {
+		t.Errorf("journal not emptied by cleanup: %+v", journal.Resources)
+	}
+}
+
+func TestStepCreateNetwork_CreateError(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.FailOn("NetworkClient.Create", errors.New("quota exceeded"))
+	state := testBackendState(t, backend)
+
+	step := &StepCreateNetwork{}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepCreateNetwork_DHCP(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.DHCPPolls = 2
+	state := testBackendState(t, backend)
+	state.Put("journal", common.NewJournal(t.TempDir()+"/journal.json", &common.AccessConfig{}))
+
+	step := &StepCreateNetwork{DHCPNetwork: true}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	net := state.Get("network").(*models.Network)
+	if *net.Type != "vlan" {
+		t.Errorf("network type = %s, want the private DHCP network", *net.Type)
+	}
+	if _, ok := state.GetOk("dhcpServerID"); !ok {
+		t.Error("dhcpServerID not set")
+	}
+
+	step.Cleanup(state)
+	if ids := backend.DHCPServerIDs(); len(ids) != 0 {
+		t.Errorf("DHCP servers left after cleanup: %v", ids)
+	}
+	if ids := backend.NetworkIDs(); len(ids) != 0 {
+		t.Errorf("networks left after cleanup: %v", ids)
+	}
+	if journal := state.Get("journal").(*common.Journal); len(journal.Resources) != 0 {
+		t.Errorf("journal not emptied by cleanup: %+v", journal.Resources)
+	}
+}
+
+func TestStepCreateNetwork_DHCPTimeout(t *testing.T) {
+	setDuration(t, &polling.dhcpServerTimeout, 20*time.Millisecond)
+	backend := fake.NewBackend()
+	backend.DHCPPolls = 1 << 30
+	state := testBackendState(t, backend)
+
+	step := &StepCreateNetwork{DHCPNetwork: true}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepCreateNetwork_CleanupNetworkInUse(t *testing.T) {
+	backend := fake.NewBackend()
+	state := testBackendState(t, backend)
+	state.Put("journal", common.NewJournal(t.TempDir()+"/journal.json", &common.AccessConfig{}))
+
+	step := &StepCreateNetwork{}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	// An instance that could not be deleted keeps the network in use.
+	net := state.Get("network").(*models.Network)
+	if _, err := backend.InstanceClient().Create(&models.PVMInstanceCreate{
+		ServerName: net.Name,
+		ImageID:    net.Name,
+		Networks:   []*models.PVMInstanceAddNetwork{{NetworkID: net.NetworkID}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	step.Cleanup(state)
+	if ids := backend.NetworkIDs(); len(ids) != 1 {
+		t.Errorf("networks = %v, want the network kept", ids)
+	}
+	if journal := state.Get("journal").(*common.Journal); len(journal.Resources) != 1 {
+		t.Errorf("journal = %+v, want the network kept for a later cleanup", journal.Resources)
+	}
+}
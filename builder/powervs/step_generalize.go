@@ -0,0 +1,91 @@
+package powervs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// generalizeCommands holds the shell command run for each generalize step, per distro family.
+var generalizeCommands = map[string]map[string]string{
+	common.GeneralizeCloudInit: {
+		common.DistroRHEL:   "cloud-init clean --logs",
+		common.DistroSLES:   "cloud-init clean --logs",
+		common.DistroUbuntu: "cloud-init clean --logs",
+	},
+	common.GeneralizeMachineID: {
+		common.DistroRHEL:   "truncate -s 0 /etc/machine-id && rm -f /var/lib/dbus/machine-id",
+		common.DistroSLES:   "rm -f /etc/machine-id /var/lib/dbus/machine-id && touch /etc/machine-id",
+		common.DistroUbuntu: "truncate -s 0 /etc/machine-id && rm -f /var/lib/dbus/machine-id && ln -s /etc/machine-id /var/lib/dbus/machine-id",
+	},
+	common.GeneralizeSSHHostKeys: {
+		common.DistroRHEL:   "rm -f /etc/ssh/ssh_host_*",
+		common.DistroSLES:   "rm -f /etc/ssh/ssh_host_*",
+		common.DistroUbuntu: "rm -f /etc/ssh/ssh_host_*",
+	},
+	common.GeneralizeRMCNodeID: {
+		common.DistroRHEL:   "if [ -x /opt/rsct/install/bin/recfgct ]; then /opt/rsct/install/bin/recfgct; fi",
+		common.DistroSLES:   "if [ -x /opt/rsct/install/bin/recfgct ]; then /opt/rsct/install/bin/recfgct; fi",
+		common.DistroUbuntu: "if [ -x /opt/rsct/install/bin/recfgct ]; then /opt/rsct/install/bin/recfgct; fi",
+	},
+}
+
+// StepGeneralize removes the build instance identity from the guest so that the captured image
+// can be cloned without collisions.
+type StepGeneralize struct {
+	Steps   []string
+	UseSudo bool
+}
+
+func (s *StepGeneralize) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	ui.Say("Generalizing Instance")
+
+	comm := state.Get("communicator").(packersdk.Communicator)
+
+	var stdout bytes.Buffer
+	cmd := &packersdk.RemoteCmd{Command: "cat /etc/os-release", Stdout: &stdout}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil || cmd.ExitStatus() != 0 {
+		ui.Error(fmt.Sprintf("failed to read /etc/os-release, exit status: %d, err: %v", cmd.ExitStatus(), err))
+		state.Put("error", fmt.Errorf("failed to read /etc/os-release: exit status %d, err: %v", cmd.ExitStatus(), err))
+		return multistep.ActionHalt
+	}
+	distro, err := common.DetectDistro(stdout.String())
+	if err != nil {
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+	ui.Say(fmt.Sprintf("Detected distro family: %s", distro))
+
+	for _, step := range s.Steps {
+		command := generalizeCommands[step][distro]
+		if s.UseSudo {
+			command = fmt.Sprintf("sudo sh -c '%s'", command)
+		}
+		ui.Say(fmt.Sprintf("Running generalize step %s: %s", step, command))
+		cmd := &packersdk.RemoteCmd{Command: command}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			ui.Error(fmt.Sprintf("failed to run generalize step %s: %v", step, err))
+			state.Put("error", fmt.Errorf("failed to run generalize step %s: %w", step, err))
+			return multistep.ActionHalt
+		}
+		if cmd.ExitStatus() != 0 {
+			ui.Error(fmt.Sprintf("generalize step %s exited with status %d", step, cmd.ExitStatus()))
+			state.Put("error", fmt.Errorf("generalize step %s exited with status %d", step, cmd.ExitStatus()))
+			return multistep.ActionHalt
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup can be used to clean up any artifact created by the step.
+// A step's clean up always run at the end of a build, regardless of whether provisioning succeeds or fails.
+func (s *StepGeneralize) Cleanup(_ multistep.StateBag) {
+	// Nothing to clean
+}
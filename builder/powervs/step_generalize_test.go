@@ -0,0 +1,64 @@
+package powervs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+func testGeneralizeState(t *testing.T, comm packersdk.Communicator) *multistep.BasicStateBag {
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("communicator", comm)
+	return state
+}
+
+func TestStepGeneralize(t *testing.T) {
+	comm := &packersdk.MockCommunicator{StartStdout: "ID=\"rhel\"\n"}
+	state := testGeneralizeState(t, comm)
+
+	step := &StepGeneralize{Steps: []string{common.GeneralizeSSHHostKeys}, UseSudo: true}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	if want := "sudo sh -c 'rm -f /etc/ssh/ssh_host_*'"; comm.StartCmd.Command != want {
+		t.Errorf("last command = %q, want %q", comm.StartCmd.Command, want)
+	}
+}
+
+func TestStepGeneralize_UnknownDistro(t *testing.T) {
+	comm := &packersdk.MockCommunicator{StartStdout: "ID=alpine\n"}
+	state := testGeneralizeState(t, comm)
+
+	step := &StepGeneralize{Steps: common.GeneralizeStepsDefault}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepGeneralize_OSReleaseFailed(t *testing.T) {
+	comm := &packersdk.MockCommunicator{StartStdout: "ID=ubuntu\n", StartExitStatus: 1}
+	state := testGeneralizeState(t, comm)
+
+	step := &StepGeneralize{Steps: common.GeneralizeStepsDefault}
+	action := step.Run(context.Background(), state)
+	assertHalted(t, action, state)
+	if !strings.Contains(state.Get("error").(error).Error(), "os-release") {
+		t.Errorf("error = %v, want the os-release read to fail first", state.Get("error"))
+	}
+}
+
+func TestStepGeneralize_CommandFailed(t *testing.T) {
+	comm := &exitCommunicator{MockCommunicator: &packersdk.MockCommunicator{StartStdout: "ID=ubuntu\n"}, match: "machine-id", status: 1}
+	state := testGeneralizeState(t, comm)
+
+	step := &StepGeneralize{Steps: []string{common.GeneralizeMachineID, common.GeneralizeSSHHostKeys}}
+	assertHalted(t, step.Run(context.Background(), state), state)
+	if err := state.Get("error").(error); !strings.Contains(err.Error(), "generalize step machine-id exited with status 1") {
+		t.Errorf("error = %v, want the exit status of the machine-id step", err)
+	}
+	if strings.Contains(comm.StartCmd.Command, "ssh_host") {
+		t.Errorf("last command = %q, want the steps after the failed one skipped", comm.StartCmd.Command)
+	}
+}
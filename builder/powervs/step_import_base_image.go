@@ -7,7 +7,6 @@ import (
 	"math/rand"
 	"time"
 
-	"github.com/IBM-Cloud/power-go-client/clients/instance"
 	"github.com/IBM-Cloud/power-go-client/power/models"
 	"github.com/IBM/go-sdk-core/v5/core"
 
@@ -25,21 +24,28 @@ var (
 	ImageStateFailed = "failed"
 )
 
+const (
+	StorageTypeTier1 = "tier1"
+)
+
 const (
 	JobWaitThreshold        = 30 * time.Minute
 	JobPollInterval         = 2 * time.Minute
 	ImageImportThreshold    = 30 * time.Minute
 	ImageImportPollInterval = 2 * time.Minute
-	StorageTypeTier1        = "tier1"
 )
 
 var (
-	BucketAccessPublic = "public"
+	BucketAccessPublic  = "public"
+	BucketAccessPrivate = "private"
 )
 
 type StepImageBaseImage struct {
 	Source  common.Source
+	RunTags []string
 	cleanup bool
+
+	importJobID string
 }
 
 func (s *StepImageBaseImage) SetCleanup() {
@@ -50,57 +56,36 @@ func (s *StepImageBaseImage) GetCleanup() bool {
 	return s.cleanup
 }
 
-func (s *StepImageBaseImage) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+func (s *StepImageBaseImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
 	ui.Say("Importing the Base Image")
-	imageClient := state.Get("imageClient").(*instance.IBMPIImageClient)
-	jobClient := state.Get("jobClient").(*instance.IBMPIJobClient)
+	imageClient := state.Get("imageClient").(common.ImageClient)
+	jobClient := state.Get("jobClient").(common.JobClient)
+	var imageRef *models.ImageReference
 	switch {
 	case s.Source.COS != nil:
-		ui.Say(fmt.Sprintf("Importing from the COS bucket: %+v\n", s.Source.COS))
+		ui.Say(fmt.Sprintf("Importing %s from the COS bucket %s (%s)", s.Source.COS.Object, s.Source.COS.Bucket, s.Source.COS.Region))
 		if s.Source.Name == "" {
 			s1 := rand.NewSource(time.Now().UnixNano())
 			s.Source.Name = fmt.Sprintf("%s-image-%d", s.Source.COS.Bucket, rand.New(s1).Intn(100))
 		}
-		body := &models.CreateCosImageImportJob{
-			ImageName:     &s.Source.Name,
-			BucketName:    core.StringPtr(s.Source.COS.Bucket),
-			BucketAccess:  &BucketAccessPublic,
-			Region:        core.StringPtr(s.Source.COS.Region),
-			ImageFilename: core.StringPtr(s.Source.COS.Object),
-			StorageType:   StorageTypeTier1,
-		}
-		imageJob, err := imageClient.CreateCosImage(body)
+		imageJob, err := imageClient.CreateCosImage(CosImageImportJob(s.Source.Name, s.Source.COS, StorageTypeTier1))
 		if err != nil {
 			ui.Error(fmt.Sprintf("failed to CreateCosImage: %+v", err))
 			state.Put("error", fmt.Errorf("failed to CreateCosImage: %w", err))
 			return multistep.ActionHalt
 		}
 		s.SetCleanup()
-		begin := time.Now()
-	loop:
-		for {
-			job, err := jobClient.Get(*imageJob.ID)
-			ui.Say(fmt.Sprintf("Job state: %s, progress: %s, message: %s", *job.Status.State, *job.Status.Progress, job.Status.Message))
-			if err != nil {
-				ui.Error(fmt.Sprintf("failed to Get Import Job: %+v", err))
-				state.Put("error", fmt.Errorf("failed to Get Import Job: %w", err))
-				return multistep.ActionHalt
-			}
-			switch *job.Status.State {
-			case "failed":
-				return multistep.ActionHalt
-			case "completed":
-				break loop
-			default:
-				if time.Since(begin) >= JobWaitThreshold {
-					ui.Error("timed out while waiting for image to be imported")
-					state.Put("error", fmt.Errorf("timed out while waiting for image to be imported: %w", err))
-					return multistep.ActionHalt
-				}
-				ui.Say(fmt.Sprintf("Sleeping for %s Minutes", JobPollInterval))
-				time.Sleep(JobPollInterval)
-			}
+		// The image is only known once the import job completed, the job is journaled until then.
+		s.importJobID = *imageJob.ID
+		resourceCreated(state, common.ResourceTypeImageImport, s.importJobID, s.Source.Name)
+		imageRef, err = WaitCOSImageImport(ui, imageClient, jobClient, *imageJob.ID, s.Source.Name, polling.jobInterval, func(job *models.Job) {
+			jobProgress(state, *imageJob.ID, job)
+		})
+		if err != nil {
+			ui.Error(err.Error())
+			state.Put("error", err)
+			return multistep.ActionHalt
 		}
 	case s.Source.StockImage != nil:
 		ui.Say(fmt.Sprintf("Importing from the Stock Image: %+v\n", s.Source.StockImage))
@@ -133,6 +118,7 @@ func (s *StepImageBaseImage) Run(_ context.Context, state multistep.StateBag) mu
 			return multistep.ActionHalt
 		}
 		s.SetCleanup()
+		resourceCreated(state, common.ResourceTypeImage, *image.ImageID, *image.Name)
 		s.Source.Name = *image.Name
 		begin := time.Now()
 	loop2:
@@ -146,31 +132,34 @@ func (s *StepImageBaseImage) Run(_ context.Context, state multistep.StateBag) mu
 			ui.Say(fmt.Sprintf("Image state: %s", img.State))
 			switch img.State {
 			case ImageStateFailed:
+				ui.Error("image import failed")
+				state.Put("error", errors.New("image import failed"))
 				return multistep.ActionHalt
 			case ImageStateACTIVE:
 				break loop2
 			default:
-				if time.Since(begin) >= ImageImportThreshold {
+				if time.Since(begin) >= polling.imageImportTimeout {
 					ui.Error("timed out while waiting for image to be imported")
 					state.Put("error", errors.New("timed out while waiting for image to be imported"))
 					return multistep.ActionHalt
 				}
-				ui.Say(fmt.Sprintf("Sleeping for %s Minutes", ImageImportPollInterval))
-				time.Sleep(ImageImportPollInterval)
+				ui.Say(fmt.Sprintf("Sleeping for %s", polling.imageImportInterval))
+				time.Sleep(polling.imageImportInterval)
 			}
 		}
 	}
 
-	var imageRef *models.ImageReference
-	images, err := imageClient.GetAll()
-	if err != nil {
-		ui.Error(fmt.Sprintf("failed to get all the images: %v", err))
-		state.Put("error", fmt.Errorf("failed to get all the images: %w", err))
-		return multistep.ActionHalt
-	}
-	for _, image := range images.Images {
-		if *image.Name == s.Source.Name {
-			imageRef = image
+	if imageRef == nil {
+		images, err := imageClient.GetAll()
+		if err != nil {
+			ui.Error(fmt.Sprintf("failed to get all the images: %v", err))
+			state.Put("error", fmt.Errorf("failed to get all the images: %w", err))
+			return multistep.ActionHalt
+		}
+		for _, image := range images.Images {
+			if *image.Name == s.Source.Name {
+				imageRef = image
+			}
 		}
 	}
 
@@ -182,6 +171,23 @@ func (s *StepImageBaseImage) Run(_ context.Context, state multistep.StateBag) mu
 
 	ui.Say(fmt.Sprintf("Image found with ID: %s", *imageRef.ImageID))
 	state.Put("source_image", imageRef)
+	generatedData(state).Put("SourceImageID", *imageRef.ImageID)
+
+	if s.GetCleanup() {
+		resourceCreated(state, common.ResourceTypeImage, *imageRef.ImageID, *imageRef.Name)
+		if s.importJobID != "" {
+			resourceDeleted(state, common.ResourceTypeImageImport, s.importJobID)
+		}
+		if err := attachTags(ctx, state, string(imageRef.Crn), s.RunTags); err != nil {
+			ui.Error(fmt.Sprintf("failed to tag the image: %v", err))
+			state.Put("error", fmt.Errorf("failed to tag the image: %w", err))
+			return multistep.ActionHalt
+		}
+	}
+
+	osType := imageOSType(imageRef)
+	ui.Say(fmt.Sprintf("Image OS type: %s", osType))
+	state.Put("os_type", osType)
 	return multistep.ActionContinue
 }
 
@@ -194,21 +200,29 @@ func (s *StepImageBaseImage) Cleanup(state multistep.StateBag) {
 	ui := state.Get("ui").(packersdk.Ui)
 
 	ui.Say("Deleting the Image")
-	imageClient := state.Get("imageClient").(*instance.IBMPIImageClient)
-	si := state.Get("source_image").(*models.ImageReference)
+	imageClient := state.Get("imageClient").(common.ImageClient)
+	// The image is only known once the import finished.
+	v, ok := state.GetOk("source_image")
+	if !ok {
+		ui.Error(fmt.Sprintf("Error cleaning up an image. Please delete an image manually: %s", s.Source.Name))
+		return
+	}
+	si := v.(*models.ImageReference)
 	err := imageClient.Delete(*si.ImageID)
 	if err != nil {
 		ui.Error(fmt.Sprintf(
 			"Error cleaning up an image. Please delete an image manually: %s", *si.Name))
+		return
 	}
 	for {
 		img, err := imageClient.Get(*si.ImageID)
 		if err == nil {
 			ui.Say(fmt.Sprintf("Image still exists, state: %s", img.State))
-			time.Sleep(10 * time.Second)
+			time.Sleep(polling.imageDeleteInterval)
 			continue
 		} else {
 			ui.Say("image deleted successfully")
+			resourceDeleted(state, common.ResourceTypeImage, *si.ImageID)
 			break
 		}
 	}
@@ -0,0 +1,186 @@
+package powervs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+func stockImageSource(name string) common.Source {
+	return common.Source{StockImage: &common.StockImage{Name: name}}
+}
+
+func cosImageSource() common.Source {
+	return common.Source{
+		Name: "cos-image",
+		COS:  &common.COS{Bucket: "bucket", Object: "image.ova.gz", Region: "us-south"},
+	}
+}
+
+func TestStepImageBaseImage_StockImage(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.ImagePolls = 2
+	backend.AddStockImage("CentOS-Stream-9", "aix")
+	state := testBackendState(t, backend)
+	state.Put("journal", common.NewJournal(t.TempDir()+"/journal.json", &common.AccessConfig{}))
+
+	step := &StepImageBaseImage{Source: stockImageSource("CentOS-Stream-9"), RunTags: []string{"packer:test"}}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	image := state.Get("source_image").(*models.ImageReference)
+	if *image.Name != "CentOS-Stream-9" {
+		t.Errorf("source_image = %s, want the copy of the stock image", *image.Name)
+	}
+	if osType := state.Get("os_type"); osType != OSTypeAIX {
+		t.Errorf("os_type = %v, want %s", osType, OSTypeAIX)
+	}
+	if tags := backend.Tags(string(image.Crn)); len(tags) != 1 {
+		t.Errorf("tags = %v, want the run tags", tags)
+	}
+	journal := state.Get("journal").(*common.Journal)
+	if len(journal.Resources) != 1 {
+		t.Errorf("journal = %+v, want the image", journal.Resources)
+	}
+
+	step.Cleanup(state)
+	if ids := backend.ImageIDs(); len(ids) != 0 {
+		t.Errorf("images left after cleanup: %v", ids)
+	}
+	if len(journal.Resources) != 0 {
+		t.Errorf("journal not emptied by cleanup: %+v", journal.Resources)
+	}
+}
+
+func TestStepImageBaseImage_StockImageNotFound(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddStockImage("CentOS-Stream-9", "rhel")
+	state := testBackendState(t, backend)
+
+	step := &StepImageBaseImage{Source: stockImageSource("RHEL9-SP4")}
+	assertHalted(t, step.Run(context.Background(), state), state)
+	if step.GetCleanup() {
+		t.Error("cleanup enabled although nothing was imported")
+	}
+}
+
+func TestStepImageBaseImage_StockImageFailed(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.ImageResult = fake.ImageStateFailed
+	backend.AddStockImage("CentOS-Stream-9", "rhel")
+	state := testBackendState(t, backend)
+
+	step := &StepImageBaseImage{Source: stockImageSource("CentOS-Stream-9")}
+	assertHalted(t, step.Run(context.Background(), state), state)
+	if !step.GetCleanup() {
+		t.Error("cleanup disabled although an image was created")
+	}
+}
+
+func TestStepImageBaseImage_StockImageTimeout(t *testing.T) {
+	setDuration(t, &polling.imageImportTimeout, 20*time.Millisecond)
+	backend := fake.NewBackend()
+	backend.ImagePolls = 1 << 30
+	backend.AddStockImage("CentOS-Stream-9", "rhel")
+	state := testBackendState(t, backend)
+
+	step := &StepImageBaseImage{Source: stockImageSource("CentOS-Stream-9")}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepImageBaseImage_COS(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.JobPolls = 2
+	state := testBackendState(t, backend)
+
+	state.Put("journal", common.NewJournal(t.TempDir()+"/journal.json", &common.AccessConfig{}))
+
+	step := &StepImageBaseImage{Source: cosImageSource()}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	image := state.Get("source_image").(*models.ImageReference)
+	if *image.Name != "cos-image" {
+		t.Errorf("source_image = %s, want cos-image", *image.Name)
+	}
+	// The import job is replaced by the image it imported.
+	journal := state.Get("journal").(*common.Journal)
+	if len(journal.Resources) != 1 || journal.Resources[0].Type != common.ResourceTypeImage || journal.Resources[0].ID != *image.ImageID {
+		t.Errorf("journal = %+v, want the image", journal.Resources)
+	}
+
+	step.Cleanup(state)
+	if ids := backend.ImageIDs(); len(ids) != 0 {
+		t.Errorf("images left after cleanup: %v", ids)
+	}
+}
+
+func TestCosImageImportJob(t *testing.T) {
+	cos := &common.COS{Bucket: "bucket", Object: "nightly/centos/image.ova.gz", Region: "us-south"}
+	body := CosImageImportJob("image", cos, StorageTypeTier1)
+	if *body.BucketName != "bucket" || *body.ImageFilename != "nightly/centos/image.ova.gz" || *body.BucketAccess != BucketAccessPublic || body.AccessKey != "" {
+		t.Errorf("import job = %+v, want a public import of nightly/centos/image.ova.gz from bucket", body)
+	}
+
+	cos.AccessKey, cos.SecretKey = "access", "secret"
+	body = CosImageImportJob("image", cos, StorageTypeTier1)
+	if *body.BucketAccess != BucketAccessPrivate || body.AccessKey != "access" || body.SecretKey != "secret" {
+		t.Errorf("import job = %+v, want a private import", body)
+	}
+}
+
+func TestStepImageBaseImage_COSJobFailed(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.JobResult = fake.JobStateFailed
+	state := testBackendState(t, backend)
+
+	state.Put("journal", common.NewJournal(t.TempDir()+"/journal.json", &common.AccessConfig{}))
+
+	step := &StepImageBaseImage{Source: cosImageSource()}
+	assertHalted(t, step.Run(context.Background(), state), state)
+
+	// The image was never found, the cleanup reports it instead of panicking.
+	step.Cleanup(state)
+	// The import job stays journaled, the image may still show up.
+	journal := state.Get("journal").(*common.Journal)
+	if len(journal.Resources) != 1 || journal.Resources[0].Type != common.ResourceTypeImageImport || journal.Resources[0].Name != "cos-image" {
+		t.Errorf("journal = %+v, want the import job", journal.Resources)
+	}
+}
+
+func TestStepImageBaseImage_COSJobError(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.FailOn("JobClient.Get", errors.New("service unavailable"))
+	state := testBackendState(t, backend)
+
+	step := &StepImageBaseImage{Source: cosImageSource()}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepImageBaseImage_COSJobTimeout(t *testing.T) {
+	setDuration(t, &polling.jobTimeout, 20*time.Millisecond)
+	backend := fake.NewBackend()
+	backend.JobPolls = 1 << 30
+	state := testBackendState(t, backend)
+
+	step := &StepImageBaseImage{Source: cosImageSource()}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepImageBaseImage_CleanupDeleteError(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddStockImage("CentOS-Stream-9", "rhel")
+	state := testBackendState(t, backend)
+
+	step := &StepImageBaseImage{Source: stockImageSource("CentOS-Stream-9")}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	backend.FailOn("ImageClient.Delete", errors.New("image in use"))
+	step.Cleanup(state)
+	if ids := backend.ImageIDs(); len(ids) != 1 {
+		t.Errorf("images = %v, want the image kept", ids)
+	}
+}
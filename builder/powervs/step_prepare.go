@@ -6,52 +6,129 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/IBM-Cloud/power-go-client/clients/instance"
 	"github.com/IBM-Cloud/power-go-client/power/models"
 	"github.com/IBM/go-sdk-core/v5/core"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
 )
 
 const (
 	PrepareWaitThreshold = 6 * time.Minute
-	PreparePollInterval  = 2 * time.Minute
+	PreparePollInterval  = 30 * time.Second
+
+	InstanceStatusShutoff = "SHUTOFF"
+	InstanceStatusError   = "ERROR"
 )
 
 type StepPrepare struct {
+	ShutdownCommand  string
+	ShutdownBehavior string
+	ShutdownTimeout  time.Duration
+	// UseSudo runs the default shutdown command of the OS with sudo, for SSH users other than root.
+	UseSudo bool
 }
 
-func (s *StepPrepare) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+func (s *StepPrepare) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
 	ui.Say("Preparing Instance")
-	instanceClient := state.Get("instanceClient").(*instance.IBMPIInstanceClient)
+
+	defaults := stateOSDefaults(state.Get("os_type"))
+	behavior := s.ShutdownBehavior
+	if behavior == "" {
+		behavior = defaults.ShutdownBehavior
+	}
+	command := s.ShutdownCommand
+	if command == "" {
+		command = defaults.ShutdownCommand
+		if s.UseSudo && defaults.ShutdownSudo {
+			command = "sudo " + command
+		}
+	}
+
+	if behavior == common.ShutdownBehaviorNone {
+		ui.Say("Shutdown behavior is none, capturing the running instance")
+		return multistep.ActionContinue
+	}
+
+	instanceClient := state.Get("instanceClient").(common.InstanceClient)
 	i := state.Get("instance").(*models.PVMInstance)
-	body := &models.PVMInstanceAction{
-		Action: core.StringPtr("stop"),
+
+	// exited receives the exit status of the shutdown command.
+	var exited chan int
+	switch behavior {
+	case common.ShutdownBehaviorSoftStop:
+		comm := state.Get("communicator").(packersdk.Communicator)
+		ui.Say(fmt.Sprintf("Gracefully shutting down the instance with: %s", command))
+		cmd := &packersdk.RemoteCmd{Command: command}
+		if err := comm.Start(ctx, cmd); err != nil {
+			ui.Error(fmt.Sprintf("Error sending shutdown command, %v", err))
+			state.Put("error", fmt.Errorf("error sending shutdown command: %w", err))
+			return multistep.ActionHalt
+		}
+		exited = make(chan int, 1)
+		go func() { exited <- cmd.Wait() }()
+	default:
+		ui.Say(fmt.Sprintf("Sending %s action to the instance", behavior))
+		body := &models.PVMInstanceAction{
+			Action: core.StringPtr(behavior),
+		}
+		err := instanceClient.Action(*i.PvmInstanceID, body)
+		if err != nil {
+			ui.Error(fmt.Sprintf(
+				"Error stopping the instance, %v", err))
+			state.Put("error", fmt.Errorf("error stopping the instance: %w", err))
+			return multistep.ActionHalt
+		}
 	}
-	err := instanceClient.Action(*i.PvmInstanceID, body)
-	if err != nil {
-		ui.Error(fmt.Sprintf(
-			"Error stopping the instance, %v", err))
-		state.Put("error", fmt.Errorf("error stopping the instance: %w", err))
-		return multistep.ActionHalt
+
+	timeout := s.ShutdownTimeout
+	if timeout == 0 {
+		timeout = PrepareWaitThreshold
 	}
+
 	begin := time.Now()
 	for {
 		in, err := instanceClient.Get(*i.PvmInstanceID)
 		if err != nil {
-			ui.Error(fmt.Sprintf("failed to get instane, err: %+v", err))
-			state.Put("error", fmt.Errorf("failed to get instane: %w", err))
+			ui.Error(fmt.Sprintf("failed to get instance, err: %+v", err))
+			state.Put("error", fmt.Errorf("failed to get instance: %w", err))
 			return multistep.ActionHalt
 		}
-		if *in.Status == "SHUTOFF" {
+		switch *in.Status {
+		case InstanceStatusShutoff:
+			ui.Say(fmt.Sprintf("Instance is shut off (elapsed: %s)", time.Since(begin).Round(time.Second)))
 			return multistep.ActionContinue
-		} else if time.Since(begin) >= PrepareWaitThreshold {
-			ui.Error("timed out waiting for vm to shutoff")
+		case InstanceStatusError:
+			fault := "no fault reported"
+			if in.Fault != nil && in.Fault.Message != "" {
+				fault = in.Fault.Message
+			}
+			ui.Error(fmt.Sprintf("instance entered ERROR state while shutting down: %s", fault))
+			state.Put("error", fmt.Errorf("instance entered ERROR state while shutting down: %s", fault))
+			return multistep.ActionHalt
+		}
+		if time.Since(begin) >= timeout {
+			ui.Error(fmt.Sprintf("timed out waiting for vm to shutoff after %s, state: %s", timeout, *in.Status))
 			state.Put("error", errors.New("timed out waiting for vm to shutoff"))
 			return multistep.ActionHalt
 		}
-		time.Sleep(PreparePollInterval)
+		ui.Say(fmt.Sprintf("Waiting for instance to shut off, state: %s", *in.Status))
+		select {
+		case <-ctx.Done():
+			ui.Error("cancelled while waiting for vm to shutoff")
+			state.Put("error", fmt.Errorf("cancelled while waiting for vm to shutoff: %w", ctx.Err()))
+			return multistep.ActionHalt
+		case status := <-exited:
+			exited = nil
+			// A shutdown ending the session exits with a signal status or a disconnect.
+			if status > 0 && status < 128 {
+				ui.Error(fmt.Sprintf("shutdown command exited with status %d", status))
+				state.Put("error", fmt.Errorf("shutdown command exited with status %d", status))
+				return multistep.ActionHalt
+			}
+		case <-time.After(polling.prepareInterval):
+		}
 	}
 }
 
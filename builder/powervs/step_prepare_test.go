@@ -0,0 +1,104 @@
+package powervs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+func TestStepPrepare_Stop(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.ShutdownPolls = 2
+	state, id := testInstanceState(t, backend, "rhel")
+
+	step := &StepPrepare{ShutdownTimeout: time.Second}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	if in, _ := backend.Instance(id); *in.Status != InstanceStatusShutoff {
+		t.Errorf("status = %s, want %s", *in.Status, InstanceStatusShutoff)
+	}
+}
+
+func TestStepPrepare_None(t *testing.T) {
+	backend := fake.NewBackend()
+	state, id := testInstanceState(t, backend, "rhel")
+
+	step := &StepPrepare{ShutdownBehavior: common.ShutdownBehaviorNone}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	if actions := backend.InstanceActions(id); len(actions) != 0 {
+		t.Errorf("actions = %v, want none", actions)
+	}
+}
+
+func TestStepPrepare_ActionError(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.FailOn("InstanceClient.Action", errors.New("instance locked"))
+	state, _ := testInstanceState(t, backend, "rhel")
+
+	step := &StepPrepare{}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepPrepare_ErrorState(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.ShutdownResult = InstanceStatusError
+	state, _ := testInstanceState(t, backend, "rhel")
+
+	step := &StepPrepare{}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepPrepare_Timeout(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.ShutdownPolls = 1 << 30
+	state, _ := testInstanceState(t, backend, "rhel")
+
+	step := &StepPrepare{ShutdownTimeout: 20 * time.Millisecond}
+	assertHalted(t, step.Run(context.Background(), state), state)
+}
+
+func TestStepPrepare_SoftStop(t *testing.T) {
+	backend := fake.NewBackend()
+	state, id := testInstanceState(t, backend, "aix")
+	comm := new(packersdk.MockCommunicator)
+	state.Put("communicator", comm)
+	backend.SetInstanceStatus(id, InstanceStatusShutoff)
+
+	step := &StepPrepare{UseSudo: true}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	if comm.StartCmd == nil || comm.StartCmd.Command != "sudo shutdown -F" {
+		t.Errorf("command = %+v, want sudo shutdown -F", comm.StartCmd)
+	}
+}
+
+func TestStepPrepare_SoftStopFailed(t *testing.T) {
+	backend := fake.NewBackend()
+	state, _ := testInstanceState(t, backend, "aix")
+	state.Put("communicator", &exitCommunicator{MockCommunicator: new(packersdk.MockCommunicator), match: "shutdown", status: 1})
+
+	// The failed command ends the wait instead of the timeout.
+	step := &StepPrepare{ShutdownTimeout: time.Hour}
+	assertHalted(t, step.Run(context.Background(), state), state)
+	if err := state.Get("error").(error); !strings.Contains(err.Error(), "exited with status 1") {
+		t.Errorf("error = %v, want the exit status", err)
+	}
+}
+
+func TestStepPrepare_Cancelled(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.ShutdownPolls = 1 << 30
+	state, _ := testInstanceState(t, backend, "rhel")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	step := &StepPrepare{ShutdownTimeout: time.Hour}
+	assertHalted(t, step.Run(ctx, state), state)
+}
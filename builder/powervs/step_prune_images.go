@@ -0,0 +1,113 @@
+package powervs
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// StepPruneImages deletes the catalog images replaced by the captured image: the other images with its
+// name when ForceDeregister is set, and the oldest images of the Prefix series beyond the KeepLastN most
+// recent ones. The images of a series are named Prefix, or Prefix followed by a dash and a suffix of
+// the NameSuffix strategy: a build number or a timestamp.
+// The captured image is never deleted, and failing to delete an image does not fail the build.
+type StepPruneImages struct {
+	Prefix          string
+	NameSuffix      string
+	ForceDeregister bool
+	KeepLastN       int
+}
+
+func (s *StepPruneImages) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	captured, ok := state.GetOk("captured_image")
+	if !ok {
+		return multistep.ActionContinue
+	}
+	capturedImage := captured.(*models.ImageReference)
+	ui.Say("Pruning the images replaced by the captured image")
+
+	imageClient := state.Get("imageClient").(common.ImageClient)
+	images, err := imageClient.GetAll()
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to list the images to prune: %v", err))
+		return multistep.ActionContinue
+	}
+
+	for _, image := range s.imagesToDelete(images.Images, capturedImage) {
+		ui.Say(fmt.Sprintf("Deleting the image %s (%s)", *image.Name, *image.ImageID))
+		if err := imageClient.Delete(*image.ImageID); err != nil {
+			ui.Error(fmt.Sprintf("failed to delete the image %s: %v", *image.ImageID, err))
+			continue
+		}
+		eventLog(state).ResourceDeleted(common.ResourceTypeImage, *image.ImageID)
+	}
+	return multistep.ActionContinue
+}
+
+// imagesToDelete returns the images to delete, the oldest first.
+func (s *StepPruneImages) imagesToDelete(images []*models.ImageReference, captured *models.ImageReference) []*models.ImageReference {
+	var series []*models.ImageReference
+	for _, image := range images {
+		if image.Name == nil || image.ImageID == nil || *image.ImageID == *captured.ImageID {
+			continue
+		}
+		if s.inSeries(*image.Name) {
+			series = append(series, image)
+		}
+	}
+	// The most recent first.
+	slices.SortFunc(series, func(a, b *models.ImageReference) int {
+		return imageCreationDate(b).Compare(imageCreationDate(a))
+	})
+
+	var toDelete []*models.ImageReference
+	// The captured image is the first of the images kept.
+	kept := 1
+	for _, image := range series {
+		switch {
+		case s.ForceDeregister && *image.Name == *captured.Name:
+			toDelete = append(toDelete, image)
+		case s.KeepLastN > 0 && kept >= s.KeepLastN:
+			toDelete = append(toDelete, image)
+		default:
+			kept++
+		}
+	}
+	slices.Reverse(toDelete)
+	return toDelete
+}
+
+// inSeries reports whether an image name is one of the names of the series, e.g. `golden-12` but not
+// `golden-gpu-3` with build numbers.
+func (s *StepPruneImages) inSeries(name string) bool {
+	if name == s.Prefix {
+		return true
+	}
+	switch s.NameSuffix {
+	case common.NameSuffixBuildNumber:
+		_, ok := buildNumber(name, s.Prefix)
+		return ok
+	case common.NameSuffixTimestamp:
+		suffix, ok := strings.CutPrefix(name, s.Prefix+"-")
+		if !ok {
+			return false
+		}
+		_, err := time.Parse(nameSuffixTimestampLayout, suffix)
+		return err == nil
+	}
+	return false
+}
+
+// Cleanup can be used to clean up any artifact created by the step.
+// A step's clean up always run at the end of a build, regardless of whether provisioning succeeds or fails.
+func (s *StepPruneImages) Cleanup(_ multistep.StateBag) {
+	// Nothing to clean
+}
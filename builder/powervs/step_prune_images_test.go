@@ -0,0 +1,117 @@
+package powervs
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+// imageNames returns the sorted names of the images in the image catalog. Getting the images applies
+// their pending deletion.
+func imageNames(backend *fake.Backend) []string {
+	var names []string
+	for _, id := range backend.ImageIDs() {
+		if image, err := backend.ImageClient().Get(id); err == nil {
+			names = append(names, *image.Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestStepPruneImages_ForceDeregister(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddImage("golden", "rhel")
+	backend.AddImage("golden", "rhel")
+	backend.AddImage("golden-1", "rhel")
+	state, _ := testInstanceState(t, backend, "rhel")
+
+	capture := common.Capture{Name: "golden", Destination: CaptureDestinationImageCatalog, ForceDeregister: true}
+	assertContinued(t, (&StepCaptureInstance{Capture: capture}).Run(context.Background(), state), state)
+	step := &StepPruneImages{Prefix: capture.Name, ForceDeregister: true}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	if names := imageNames(backend); !reflect.DeepEqual(names, []string{"golden", "golden-1", "source-image"}) {
+		t.Errorf("images = %v, want the other images named golden deleted", names)
+	}
+	captured := state.Get("captured_image").(*models.ImageReference)
+	if _, ok := backend.Image(*captured.ImageID); !ok {
+		t.Error("captured image deleted")
+	}
+}
+
+func TestStepPruneImages_KeepLastN(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddImage("golden", "rhel")
+	backend.AddImage("golden-1", "rhel")
+	backend.AddImage("golden-2", "rhel")
+	backend.AddImage("golden2", "rhel")
+	// The images of sibling series with longer names.
+	backend.AddImage("golden-gpu-3", "rhel")
+	backend.AddImage("golden-2204-base", "rhel")
+	state, _ := testInstanceState(t, backend, "rhel")
+
+	capture := common.Capture{Name: "golden", Destination: CaptureDestinationImageCatalog, NameSuffix: common.NameSuffixBuildNumber, KeepLastN: 2}
+	assertContinued(t, (&StepCaptureInstance{Capture: capture}).Run(context.Background(), state), state)
+	if name := state.Get("capture_name"); name != "golden-3" {
+		t.Fatalf("capture_name = %v, want golden-3", name)
+	}
+	step := &StepPruneImages{Prefix: capture.Name, NameSuffix: capture.NameSuffix, KeepLastN: 2}
+	assertContinued(t, step.Run(context.Background(), state), state)
+
+	want := []string{"golden-2", "golden-2204-base", "golden-3", "golden-gpu-3", "golden2", "source-image"}
+	if names := imageNames(backend); !reflect.DeepEqual(names, want) {
+		t.Errorf("images = %v, want the two most recent golden images kept", names)
+	}
+}
+
+func TestStepPruneImages_InSeries(t *testing.T) {
+	for _, tt := range []struct {
+		nameSuffix, name string
+		want             bool
+	}{
+		{"", "golden", true},
+		{"", "golden-1", false},
+		{common.NameSuffixBuildNumber, "golden-12", true},
+		{common.NameSuffixBuildNumber, "golden-20261019061315", true},
+		{common.NameSuffixBuildNumber, "golden-gpu-3", false},
+		{common.NameSuffixTimestamp, "golden-20261019061315", true},
+		{common.NameSuffixTimestamp, "golden-12", false},
+		{common.NameSuffixTimestamp, "golden-2204-base", false},
+	} {
+		step := &StepPruneImages{Prefix: "golden", NameSuffix: tt.nameSuffix}
+		if got := step.inSeries(tt.name); got != tt.want {
+			t.Errorf("inSeries(%q) with name_suffix %q = %t, want %t", tt.name, tt.nameSuffix, got, tt.want)
+		}
+	}
+}
+
+func TestStepCaptureInstance_NameSuffix(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.AddImage("golden-7", "rhel")
+	backend.AddImage("golden-x", "rhel")
+	backend.AddImage("golden-12-old", "rhel")
+	imageClient := backend.ImageClient()
+
+	for suffix, want := range map[string]string{
+		"":                           "golden",
+		common.NameSuffixBuildNumber: "golden-8",
+	} {
+		step := &StepCaptureInstance{Capture: common.Capture{Name: "golden", NameSuffix: suffix}}
+		name, err := step.captureName(imageClient)
+		if err != nil || name != want {
+			t.Errorf("captureName() with %q = %s, %v, want %s", suffix, name, err, want)
+		}
+	}
+
+	step := &StepCaptureInstance{Capture: common.Capture{Name: "golden", NameSuffix: common.NameSuffixTimestamp}}
+	name, err := step.captureName(imageClient)
+	if err != nil || len(name) != len("golden-20261019061315") {
+		t.Errorf("captureName() with a timestamp = %s, %v", name, err)
+	}
+}
@@ -0,0 +1,111 @@
+package powervs
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	powervscommon "github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+func TestMain(m *testing.M) {
+	// Poll the fake backend without waiting.
+	polling.jobInterval = time.Millisecond
+	polling.imageImportInterval = time.Millisecond
+	polling.imageDeleteInterval = time.Millisecond
+	polling.captureInterval = time.Millisecond
+	polling.dhcpServerInterval = time.Millisecond
+	polling.instanceCreateInterval = time.Millisecond
+	polling.cleanupInterval = time.Millisecond
+	polling.prepareInterval = time.Millisecond
+	powervscommon.RetryBaseDelay = time.Millisecond
+	os.Exit(m.Run())
+}
+
+// setDuration overrides a duration for the duration of a test.
+func setDuration(t *testing.T, d *time.Duration, value time.Duration) {
+	old := *d
+	*d = value
+	t.Cleanup(func() { *d = old })
+}
+
+// testBackendState returns a state bag holding the clients of the fake backend, as Builder.Run does.
+func testBackendState(t *testing.T, backend *fake.Backend) *multistep.BasicStateBag {
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("imageClient", backend.ImageClient())
+	state.Put("instanceClient", backend.InstanceClient())
+	state.Put("networkClient", backend.NetworkClient())
+	state.Put("jobClient", backend.JobClient())
+	state.Put("dhcpClient", backend.DHCPClient())
+	state.Put("taggingClient", backend.TaggingClient())
+	state.Put("searchClient", backend.SearchClient())
+	return state
+}
+
+// testInstanceState returns a state bag for the steps running after StepCreateInstance, with an active
+// instance created from an image with the given operating system.
+func testInstanceState(t *testing.T, backend *fake.Backend, os string) (*multistep.BasicStateBag, string) {
+	state := testBackendState(t, backend)
+	imageID := backend.AddImage("source-image", os)
+	networkID := backend.AddNetwork("network", "pub-vlan")
+	ins, err := backend.InstanceClient().Create(&models.PVMInstanceCreate{
+		ServerName: core.StringPtr("packer-test"),
+		ImageID:    core.StringPtr(imageID),
+		Networks:   []*models.PVMInstanceAddNetwork{{NetworkID: core.StringPtr(networkID)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := *(*ins)[0].PvmInstanceID
+	in, err := backend.InstanceClient().Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Put("instance", in)
+	state.Put("os_type", imageOSType(&models.ImageReference{Specifications: &models.ImageSpecifications{OperatingSystem: os}}))
+	return state, id
+}
+
+// assertHalted fails the test unless the step halted with an error in the state bag.
+func assertHalted(t *testing.T, action multistep.StepAction, state multistep.StateBag) {
+	t.Helper()
+	if action != multistep.ActionHalt {
+		t.Fatalf("Run() = %v, want ActionHalt", action)
+	}
+	if _, ok := state.GetOk("error"); !ok {
+		t.Fatal("expected an error in the state bag")
+	}
+}
+
+// assertContinued fails the test unless the step continued without error.
+func assertContinued(t *testing.T, action multistep.StepAction, state multistep.StateBag) {
+	t.Helper()
+	if action != multistep.ActionContinue {
+		t.Fatalf("Run() = %v, error: %v", action, state.Get("error"))
+	}
+}
+
+// exitCommunicator exits with status from the commands containing match, and runs the other commands
+// as its MockCommunicator.
+type exitCommunicator struct {
+	*packersdk.MockCommunicator
+	match  string
+	status int
+}
+
+func (c *exitCommunicator) Start(ctx context.Context, cmd *packersdk.RemoteCmd) error {
+	if !strings.Contains(cmd.Command, c.match) {
+		return c.MockCommunicator.Start(ctx, cmd)
+	}
+	c.StartCmd = cmd
+	go cmd.SetExited(c.status)
+	return nil
+}
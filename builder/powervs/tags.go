@@ -0,0 +1,47 @@
+package powervs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// attachTags attaches user tags to the resource identified by crn through the Global Tagging API.
+// It does nothing when there are no tags to attach.
+func attachTags(ctx context.Context, state multistep.StateBag, crn string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	if crn == "" {
+		return errors.New("resource has no CRN to attach tags to")
+	}
+
+	ui := state.Get("ui").(packersdk.Ui)
+	taggingClient := state.Get("taggingClient").(common.TaggingClient)
+
+	ui.Say(fmt.Sprintf("Attaching tags %v to %s", tags, crn))
+	results, _, err := taggingClient.AttachTagWithContext(ctx, &globaltaggingv1.AttachTagOptions{
+		Resources: []globaltaggingv1.Resource{{ResourceID: core.StringPtr(crn)}},
+		TagNames:  tags,
+		TagType:   core.StringPtr(globaltaggingv1.AttachTagOptionsTagTypeUserConst),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach tags: %w", err)
+	}
+	for _, result := range results.Results {
+		if result.IsError != nil && *result.IsError {
+			message := ""
+			if result.Message != nil {
+				message = *result.Message
+			}
+			return fmt.Errorf("failed to attach tags to %s: %s", crn, message)
+		}
+	}
+	return nil
+}
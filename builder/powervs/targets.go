@@ -0,0 +1,137 @@
+//go:generate packer-sdc struct-markdown
+
+package powervs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Target is a workspace the image is built in. The IBM Cloud credentials and endpoints, and the rest of
+// the configuration, are those of the builder.
+type Target struct {
+	// Power VS ServiceInstanceID. Required unless `workspace_name` is set.
+	ServiceInstanceID string `mapstructure:"service_instance_id" required:"false"`
+	// Name of the PowerVS workspace. Can not be used with `service_instance_id`.
+	WorkspaceName string `mapstructure:"workspace_name" required:"false"`
+	// Zone of the workspace. Required with `service_instance_id`.
+	Zone string `mapstructure:"zone" required:"false"`
+	// Region of the workspace. Derived from the zone when not set.
+	Region string `mapstructure:"region" required:"false"`
+	// The subnets of the workspace the instance is attached to. Default: the `subnet_ids` of the
+	// builder.
+	SubnetIDs []string `mapstructure:"subnet_ids" required:"false"`
+}
+
+// prepareTargets validates the targets and returns the configuration of the build in each of them.
+func (b *Builder) prepareTargets() ([]*Config, []error) {
+	var errs []error
+	if b.config.ServiceInstanceID != "" || b.config.WorkspaceName != "" || b.config.Zone != "" {
+		errs = append(errs, errors.New("service_instance_id, workspace_name and zone can not be set with targets, set them in each target"))
+	}
+	destination := b.config.Capture.Destination
+	if destination == "" {
+		destination = CaptureDestinationDefault
+	}
+	switch destination {
+	case CaptureDestinationCloudStorage, CaptureDestinationBoth:
+		if len(b.config.Targets) > 1 {
+			errs = append(errs, fmt.Errorf("the capture destination %q exports the image of every target to the same object, use %q with several targets",
+				destination, CaptureDestinationImageCatalog))
+		}
+	}
+
+	var configs []*Config
+	for i, target := range b.config.Targets {
+		config := b.config
+		// Every target authenticates and opens its own PowerVS session.
+		config.AccessConfig.Reset()
+		config.ServiceInstanceID = target.ServiceInstanceID
+		config.WorkspaceName = target.WorkspaceName
+		config.Zone = target.Zone
+		config.Region = target.Region
+		if target.SubnetIDs != nil {
+			config.SubnetIDs = target.SubnetIDs
+		}
+		for _, err := range config.AccessConfig.Prepare() {
+			errs = append(errs, fmt.Errorf("targets[%d]: %w", i, err))
+		}
+		configs = append(configs, &config)
+	}
+	return configs, errs
+}
+
+// resolveTargets resolves the workspace names of the targets and gives each target its own cleanup
+// journal.
+func resolveTargets(ctx context.Context, configs []*Config) error {
+	workspaces := map[string]bool{}
+	for i, config := range configs {
+		if err := config.ResolveWorkspace(ctx); err != nil {
+			return fmt.Errorf("targets[%d]: %w", i, err)
+		}
+		if workspaces[config.ServiceInstanceID] {
+			return fmt.Errorf("targets[%d]: the workspace %s is already a target", i, config.ServiceInstanceID)
+		}
+		workspaces[config.ServiceInstanceID] = true
+		ext := filepath.Ext(config.CleanupJournal)
+		config.CleanupJournal = strings.TrimSuffix(config.CleanupJournal, ext) + "-" + config.ServiceInstanceID + ext
+	}
+	return nil
+}
+
+// runTargets runs the build in every target concurrently, each with its own state bag and cleanup, and
+// returns one artifact with the images of all the targets. The artifact is the one of the first target,
+// with the images of every target in `target_images`. When a target fails there is no artifact, Packer
+// drops it with the error, and the error lists the images the other targets captured.
+func (b *Builder) runTargets(ctx context.Context, ui packer.Ui, hook packer.Hook) (packer.Artifact, error) {
+	artifacts := make([]*Artifact, len(b.targets))
+	errs := make([]error, len(b.targets))
+	// The provisioners are shared by the targets, they provision one instance at a time.
+	var provisioning sync.Mutex
+	var wg sync.WaitGroup
+	for i, config := range b.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			targetUi := &PrefixedUi{Ui: ui, Prefix: fmt.Sprintf("[%s] ", workspaceKey(config.Zone, config.ServiceInstanceID))}
+			artifacts[i], errs[i] = b.run(ctx, config, targetUi, hook, &provisioning)
+		}()
+	}
+	wg.Wait()
+
+	images := map[string]string{}
+	var kept []string
+	for i, config := range b.targets {
+		workspace := workspaceKey(config.Zone, config.ServiceInstanceID)
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("build in %s failed: %w", workspace, errs[i])
+			continue
+		}
+		if id := artifacts[i].stateString("image_id"); id != "" {
+			images[workspace] = id
+			kept = append(kept, fmt.Sprintf("%s in %s", id, workspace))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		// The images of the targets that succeeded are not deleted, but reach no post-processor.
+		if len(kept) > 0 {
+			err = fmt.Errorf("%w\nthe images of the other targets are kept: %s", err, strings.Join(kept, ", "))
+		}
+		return nil, err
+	}
+	artifact := artifacts[0]
+	artifact.StateData["target_images"] = images
+	return artifact, nil
+}
+
+// workspaceKey identifies a workspace as `<zone>/<service instance ID>`, as the regions of the images
+// in the HCP Packer registry.
+func workspaceKey(zone, serviceInstanceID string) string {
+	return zone + "/" + serviceInstanceID
+}
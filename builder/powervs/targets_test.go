@@ -0,0 +1,163 @@
+package powervs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+// testTargets returns a server for the workspaces dr-1 in wdc06 and dr-2 in syd05, and their backends.
+func testTargets(t *testing.T) (*fake.Server, *fake.Backend, *fake.Backend) {
+	server := fake.NewServer(fake.NewBackend())
+	t.Cleanup(server.Close)
+	var backends []*fake.Backend
+	for _, workspace := range [][2]string{{"dr-1", "wdc06"}, {"dr-2", "syd05"}} {
+		backend := fake.NewBackend()
+		backend.AddStockImage("CentOS-Stream-9", "rhel")
+		backend.JobPolls = 2
+		server.Backend.AddServiceInstance(workspace[0], workspace[1])
+		server.AddWorkspace(workspace[0], backend)
+		backends = append(backends, backend)
+	}
+	return server, backends[0], backends[1]
+}
+
+var testTargetOptions = map[string]interface{}{
+	"service_instance_id": "",
+	"zone":                "",
+	"targets": []map[string]interface{}{
+		{"service_instance_id": "dr-1", "zone": "wdc06"},
+		{"service_instance_id": "dr-2", "zone": "syd05"},
+	},
+}
+
+func TestBuilder_Prepare_Targets(t *testing.T) {
+	server, _, _ := testTargets(t)
+	for name, options := range map[string]map[string]interface{}{
+		"workspace and targets": {"service_instance_id": "workspace"},
+		"no zone":               {"service_instance_id": "", "zone": "", "targets": []map[string]interface{}{{"service_instance_id": "dr-1"}}},
+		"same workspace twice": {"service_instance_id": "", "zone": "", "targets": []map[string]interface{}{
+			{"service_instance_id": "dr-1", "zone": "wdc06"},
+			{"service_instance_id": "dr-1", "zone": "wdc06"},
+		}},
+		"cloud storage": {"capture": map[string]interface{}{"name": "captured", "destination": CaptureDestinationCloudStorage,
+			"cos": map[string]interface{}{"bucket": "images", "region": "us-south", "access_key": "access", "secret_key": "secret"}}},
+		// The default destination is cloud-storage.
+		"default destination": {"capture": map[string]interface{}{"name": "captured",
+			"cos": map[string]interface{}{"bucket": "images", "region": "us-south", "access_key": "access", "secret_key": "secret"}}},
+	} {
+		config := map[string]interface{}{
+			"api_key":       "api-key",
+			"zone":          "dal10",
+			"region":        "us-south",
+			"endpoint":      server.URL,
+			"instance_name": "packer-test",
+			"key_pair_name": "key",
+			"communicator":  "none",
+			"source":        map[string]interface{}{"stock_image": map[string]interface{}{"name": "CentOS-Stream-9"}},
+			"capture":       map[string]interface{}{"name": "captured", "destination": CaptureDestinationImageCatalog},
+		}
+		for key, value := range testTargetOptions {
+			config[key] = value
+		}
+		for key, value := range options {
+			config[key] = value
+		}
+		var b Builder
+		if _, _, err := b.Prepare(config); err == nil {
+			t.Errorf("Prepare() with %s succeeded", name)
+		}
+	}
+}
+
+func TestBuilder_Run_Targets(t *testing.T) {
+	server, wdc, syd := testTargets(t)
+	b, journal := testEndpointBuilder(t, server, testTargetOptions)
+
+	artifact, err := b.Run(context.Background(), packersdk.TestUi(t), &packersdk.MockHook{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every target captured its image and cleaned up the rest.
+	var ids []string
+	for _, backend := range []*fake.Backend{wdc, syd} {
+		images := backend.ImageIDs()
+		if len(images) != 1 {
+			t.Fatalf("images = %v, want the captured image", images)
+		}
+		if image, _ := backend.Image(images[0]); *image.Name != "captured" {
+			t.Errorf("image = %s, want captured", *image.Name)
+		}
+		if ids := backend.InstanceIDs(); len(ids) != 0 {
+			t.Errorf("instances left: %v", ids)
+		}
+		if ids := backend.NetworkIDs(); len(ids) != 0 {
+			t.Errorf("networks left: %v", ids)
+		}
+		ids = append(ids, images[0])
+	}
+	// Tags are global, only the tagging calls reach the default backend.
+	for _, call := range server.Backend.Calls() {
+		if !strings.HasPrefix(call, "TaggingClient.") {
+			t.Errorf("call to the default workspace: %s", call)
+		}
+	}
+
+	if artifact.State("zone") != "wdc06" || artifact.State("service_instance_id") != "dr-1" || artifact.Id() != ids[0] {
+		t.Errorf("artifact = %s in %v, want the image of the first target", artifact.Id(), artifact.State("zone"))
+	}
+	targets := artifact.State("target_images").(map[string]string)
+	if targets["wdc06/dr-1"] != ids[0] || targets["syd05/dr-2"] != ids[1] {
+		t.Errorf("target images = %v, want %v", targets, ids)
+	}
+	images := artifact.State(registryimage.ArtifactStateURI).([]*registryimage.Image)
+	if len(images) != 2 || images[1].ProviderRegion != "syd05/dr-2" || images[1].ImageID != ids[1] {
+		t.Errorf("registry images = %+v, want one image per target", images)
+	}
+
+	ext := filepath.Ext(journal)
+	for _, workspace := range []string{"dr-1", "dr-2"} {
+		path := strings.TrimSuffix(journal, ext) + "-" + workspace + ext
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("journal %s not removed: %v", path, err)
+		}
+	}
+}
+
+func TestBuilder_Run_TargetFailure(t *testing.T) {
+	server, wdc, syd := testTargets(t)
+	syd.FailOn("InstanceClient.Create", errors.New("no capacity"))
+	b, _ := testEndpointBuilder(t, server, testTargetOptions)
+
+	artifact, err := b.Run(context.Background(), packersdk.TestUi(t), &packersdk.MockHook{})
+	if err == nil || !strings.Contains(err.Error(), "syd05/dr-2") {
+		t.Fatalf("Run() error = %v, want the failure of syd05/dr-2", err)
+	}
+	if artifact != nil {
+		t.Errorf("artifact = %v, want none with the error", artifact)
+	}
+
+	// The other target still completes its build and its image is listed in the error, the failed one
+	// cleans up.
+	ids := wdc.ImageIDs()
+	if len(ids) != 1 {
+		t.Fatalf("images of wdc06 = %v, want the captured image", ids)
+	}
+	if want := ids[0] + " in wdc06/dr-1"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Run() error = %v, want the kept image %s", err, want)
+	}
+	if ids := syd.ImageIDs(); len(ids) != 0 {
+		t.Errorf("images left in syd05: %v", ids)
+	}
+	if ids := syd.NetworkIDs(); len(ids) != 0 {
+		t.Errorf("networks left in syd05: %v", ids)
+	}
+}
@@ -1,10 +1,43 @@
 package powervs
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 )
 
+// polling holds the poll intervals and timeouts of the steps, modified in tests.
+var polling = struct {
+	jobInterval, jobTimeout                 time.Duration
+	imageImportInterval, imageImportTimeout time.Duration
+	imageDeleteInterval                     time.Duration
+	captureInterval, captureTimeout         time.Duration
+	dhcpServerInterval, dhcpServerTimeout   time.Duration
+	instanceCreateInterval                  time.Duration
+	instanceCreateTimeout                   time.Duration
+	cleanupInterval                         time.Duration
+	prepareInterval                         time.Duration
+}{
+	jobInterval:            JobPollInterval,
+	jobTimeout:             JobWaitThreshold,
+	imageImportInterval:    ImageImportPollInterval,
+	imageImportTimeout:     ImageImportThreshold,
+	imageDeleteInterval:    10 * time.Second,
+	captureInterval:        CaptureJobPollInterval,
+	captureTimeout:         CaptureJobWaitThreshold,
+	dhcpServerInterval:     DHCPServerInterval,
+	dhcpServerTimeout:      DHCPServerActiveTimeOut,
+	instanceCreateInterval: 30 * time.Second,
+	instanceCreateTimeout:  5 * time.Minute,
+	cleanupInterval:        CleanupPollInterval,
+	prepareInterval:        PreparePollInterval,
+}
+
 // pollUntil validates if a certain condition is met at defined poll intervals.
 // If a timeout is reached, an associated error is returned to the caller.
 // condition contains the use-case specific code that returns true when a certain condition is achieved.
@@ -22,3 +55,45 @@ func pollUntil(pollInterval, timeOut <-chan time.Time, condition func() (bool, e
 		}
 	}
 }
+
+// generatedData returns the variables of the build published to the provisioners and post-processors,
+// see generatedDataKeys.
+func generatedData(state multistep.StateBag) *packerbuilderdata.GeneratedData {
+	return &packerbuilderdata.GeneratedData{State: state}
+}
+
+// instanceIP publishes the address host finds for the communicator as InstanceIP.
+func instanceIP(host func(multistep.StateBag) (string, error)) func(multistep.StateBag) (string, error) {
+	return func(state multistep.StateBag) (string, error) {
+		ip, err := host(state)
+		if err == nil {
+			generatedData(state).Put("InstanceIP", ip)
+		}
+		return ip, err
+	}
+}
+
+// stepSerialized runs a step holding a lock shared with the builds of the other targets.
+type stepSerialized struct {
+	multistep.Step
+	mu *sync.Mutex
+}
+
+func (s *stepSerialized) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Step.Run(ctx, state)
+}
+
+// PrefixedUi prefixes the messages of a Ui, e.g. with the workspace of concurrent builds or imports.
+type PrefixedUi struct {
+	packer.Ui
+	Prefix string
+}
+
+func (u *PrefixedUi) Say(message string)     { u.Ui.Say(u.Prefix + message) }
+func (u *PrefixedUi) Message(message string) { u.Ui.Message(u.Prefix + message) }
+func (u *PrefixedUi) Error(message string)   { u.Ui.Error(u.Prefix + message) }
+
+func (u *PrefixedUi) Sayf(format string, args ...any)   { u.Say(fmt.Sprintf(format, args...)) }
+func (u *PrefixedUi) Errorf(format string, args ...any) { u.Error(fmt.Sprintf(format, args...)) }
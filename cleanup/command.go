@@ -0,0 +1,226 @@
+// Package cleanup implements the cleanup subcommand of the plugin binary, which sweeps the resources
+// failed or killed builds leave behind in a PowerVS workspace.
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	powervscommon "github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// CommandName is the first argument of the plugin binary that runs the cleanup subcommand.
+const CommandName = "cleanup"
+
+const usage = `Usage: packer-plugin-powervs cleanup [options]
+
+  Finds the instances, DHCP servers, networks and images left behind by failed or killed
+  builds in a PowerVS workspace and deletes them with --force. Instances and images are
+  selected by name prefix and/or tag, plus a minimum age. Networks and DHCP servers have no
+  name of the build nor a creation date: they are only selected by tag, when no instance
+  is attached to them. Without --force the matches are only reported.
+
+  With --journal, the resources recorded in the cleanup journal of an interrupted build are
+  selected instead, and the workspace is read from the journal.
+
+Options:
+`
+
+// Run runs the cleanup subcommand with the arguments following CommandName and returns the exit code.
+func Run(args []string) int {
+	return run(context.Background(), args, os.Stdout, os.Stderr)
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	var access powervscommon.AccessConfig
+	var filter Filter
+	var force bool
+	var journalPath string
+	var instanceDeleteTimeout time.Duration
+
+	flags := flag.NewFlagSet(CommandName, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&access.AuthMethod, "auth-method", powervscommon.AuthMethodAPIKey, "how to authenticate: api-key, trusted-profile or vpc-instance")
+	flags.StringVar(&access.APIKey, "api-key", "", "IBM Cloud API key (default $IBMCLOUD_API_KEY or $IC_API_KEY)")
+	flags.StringVar(&access.CredentialsFile, "credentials-file", "", "read the API key from the JSON `file` written by ibmcloud iam api-key-create")
+	flags.StringVar(&access.TrustedProfileID, "trusted-profile-id", "", "trusted profile ID of the trusted-profile and vpc-instance auth methods")
+	flags.StringVar(&access.TrustedProfileName, "trusted-profile-name", "", "trusted profile name of the trusted-profile auth method")
+	flags.StringVar(&access.CRTokenFile, "cr-token-file", "", "compute resource token `file` of the trusted-profile auth method")
+	flags.StringVar(&access.Region, "region", "", "PowerVS region (default: derived from the zone)")
+	flags.StringVar(&access.Zone, "zone", "", "PowerVS zone")
+	flags.StringVar(&access.AccountID, "account-id", "", "IBM Cloud account ID (default: the account of the API key)")
+	flags.StringVar(&access.ServiceInstanceID, "service-instance-id", "", "PowerVS workspace ID")
+	flags.StringVar(&access.WorkspaceName, "workspace-name", "", "PowerVS workspace `name`, instead of --service-instance-id")
+	flags.StringVar(&access.Endpoint, "endpoint", "", "base `URL` of the PowerVS, IAM and Global Tagging APIs (default: IBM Cloud)")
+	flags.StringVar(&access.IAMURL, "iam-url", "", "`URL` of the IAM service")
+	flags.StringVar(&access.PowerVSEndpoint, "powervs-endpoint", "", "`URL` of the PowerVS API")
+	flags.BoolVar(&access.UsePrivateEndpoints, "use-private-endpoints", false, "use the private IBM Cloud endpoints")
+	flags.StringVar(&filter.Prefix, "prefix", "", "select resources whose name starts with `prefix`")
+	flags.StringVar(&filter.Tag, "tag", "", "select resources carrying the `key:value` tag, e.g. a run_tags entry")
+	flags.DurationVar(&filter.OlderThan, "older-than", 24*time.Hour, "select resources created at least `duration` ago")
+	flags.BoolVar(&force, "force", false, "delete the selected resources instead of only reporting them")
+	flags.StringVar(&journalPath, "journal", "", "select the resources recorded in the cleanup journal at `path`")
+	flags.DurationVar(&instanceDeleteTimeout, "instance-delete-timeout", 10*time.Minute, "maximum `duration` to wait for instances to be deleted before deleting networks")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 1
+	}
+
+	var journal *powervscommon.Journal
+	if journalPath != "" {
+		var err error
+		if journal, err = powervscommon.ReadJournal(journalPath); err != nil {
+			fmt.Fprintf(stderr, "Error: failed to read journal: %s\n", err)
+			return 1
+		}
+		for flagValue, journalValue := range map[*string]string{
+			&access.Region:            journal.Region,
+			&access.Zone:              journal.Zone,
+			&access.ServiceInstanceID: journal.ServiceInstanceID,
+		} {
+			if journalValue != "" {
+				*flagValue = journalValue
+			}
+		}
+	}
+
+	if err := validate(&access, filter, journal != nil); err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		flags.Usage()
+		return 1
+	}
+
+	if err := access.ResolveWorkspace(ctx); err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	if err := access.CheckWorkspaceZone(ctx); err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+
+	sweeper, err := NewSweeper(ctx, &access, filter)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: failed to create PowerVS clients: %s\n", err)
+		return 1
+	}
+	var resources []Resource
+	if journal != nil {
+		resources = sweeper.JournalResources(journal)
+	} else if resources, err = sweeper.Find(ctx); err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+
+	if len(resources) == 0 {
+		fmt.Fprintln(stdout, "No matching resources found.")
+		return finishJournal(journal, stderr)
+	}
+	for _, r := range resources {
+		fmt.Fprintln(stdout, formatResource(r))
+	}
+	if !force {
+		fmt.Fprintf(stdout, "Found %d matching resources, run with --force to delete them.\n", len(resources))
+		return 0
+	}
+
+	failed := 0
+	var instances []string
+	for _, r := range resources {
+		// Networks cannot be deleted while the instances attached to them still exist.
+		if r.Type != powervscommon.ResourceTypeInstance && len(instances) != 0 {
+			for _, id := range instances {
+				fmt.Fprintf(stdout, "Waiting for instance %s to be deleted\n", id)
+				if err := sweeper.WaitInstanceDeleted(ctx, id, instanceDeleteTimeout); err != nil {
+					fmt.Fprintf(stderr, "Error: %s\n", err)
+				}
+			}
+			instances = nil
+		}
+
+		fmt.Fprintf(stdout, "Deleting %s %s (%s)\n", r.Type, r.Name, r.ID)
+		if err := sweeper.Delete(r); err != nil {
+			fmt.Fprintf(stderr, "Error: failed to delete %s %s: %s\n", r.Type, r.ID, err)
+			failed++
+			continue
+		}
+		if r.Type == powervscommon.ResourceTypeInstance {
+			instances = append(instances, r.ID)
+		}
+		if journal != nil {
+			if err := journal.Remove(r.Type, r.ID); err != nil {
+				fmt.Fprintf(stderr, "Error: failed to update journal: %s\n", err)
+			}
+		}
+	}
+	if failed != 0 {
+		fmt.Fprintf(stderr, "Failed to delete %d of %d resources.\n", failed, len(resources))
+		return 1
+	}
+	fmt.Fprintf(stdout, "Deleted %d resources.\n", len(resources))
+	return finishJournal(journal, stderr)
+}
+
+// finishJournal removes the journal file once all of its resources are deleted.
+func finishJournal(journal *powervscommon.Journal, stderr io.Writer) int {
+	if journal == nil {
+		return 0
+	}
+	if _, err := journal.Finish(); err != nil {
+		fmt.Fprintf(stderr, "Error: failed to remove journal: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func validate(access *powervscommon.AccessConfig, filter Filter, fromJournal bool) error {
+	var missing []string
+	if access.WorkspaceName == "" {
+		if access.Zone == "" {
+			missing = append(missing, "--zone")
+		}
+		if access.ServiceInstanceID == "" {
+			missing = append(missing, "--service-instance-id")
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("missing required options: %s", strings.Join(missing, ", "))
+	}
+	if errs := access.Prepare(); len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+	if fromJournal {
+		return nil
+	}
+	// Never sweep a whole workspace by age alone.
+	if filter.Prefix == "" && filter.Tag == "" {
+		return errors.New("at least one of --prefix or --tag is required")
+	}
+	if filter.Tag != "" && (!strings.Contains(filter.Tag, ":") || strings.HasPrefix(filter.Tag, ":")) {
+		return fmt.Errorf("invalid --tag: %q (use key:value)", filter.Tag)
+	}
+	if filter.OlderThan < 0 {
+		return fmt.Errorf("invalid --older-than: %s (must not be negative)", filter.OlderThan)
+	}
+	return nil
+}
+
+func formatResource(r Resource) string {
+	age := "unknown age"
+	if r.Age != 0 {
+		age = r.Age.Truncate(time.Minute).String()
+	}
+	return fmt.Sprintf("%-12s %-40s %s (%s)", r.Type, r.Name, r.ID, age)
+}
@@ -0,0 +1,96 @@
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	powervscommon "github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+// testRun runs the cleanup subcommand against the server for the workspace "workspace".
+func testRun(t *testing.T, server *fake.Server, args ...string) (int, string) {
+	t.Helper()
+	args = append([]string{
+		"--api-key", "api-key",
+		"--zone", "dal10",
+		"--service-instance-id", "workspace",
+		"--endpoint", server.URL,
+	}, args...)
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr)
+	if stderr.Len() != 0 {
+		t.Logf("stderr: %s", stderr.String())
+	}
+	return code, stdout.String()
+}
+
+func TestRun_Tag(t *testing.T) {
+	backend := fake.NewBackend()
+	server := fake.NewServer(backend)
+	t.Cleanup(server.Close)
+	testWorkspace(t, backend)
+
+	// Without --force the matches are only reported.
+	code, out := testRun(t, server, "--tag", "packer:ci", "--older-than", "0")
+	if code != 0 || !strings.Contains(out, "packer-centos") || !strings.Contains(out, "packer-network-1") {
+		t.Fatalf("run() = %d, output:\n%s", code, out)
+	}
+	if ids := backend.InstanceIDs(); len(ids) != 2 {
+		t.Fatalf("instances = %v, want both kept", ids)
+	}
+
+	code, out = testRun(t, server, "--tag", "packer:ci", "--older-than", "0", "--force")
+	if code != 0 || !strings.Contains(out, "Deleted 2 resources.") {
+		t.Fatalf("run() = %d, output:\n%s", code, out)
+	}
+	if ids := backend.InstanceIDs(); len(ids) != 1 {
+		t.Errorf("instances = %v, want the database kept", ids)
+	}
+	if ids := backend.NetworkIDs(); len(ids) != 2 {
+		t.Errorf("networks = %v, want the networks of the owner kept", ids)
+	}
+}
+
+func TestRun_Journal(t *testing.T) {
+	backend := fake.NewBackend()
+	server := fake.NewServer(backend)
+	t.Cleanup(server.Close)
+	image := backend.AddImage("packer-centos-image", "rhel")
+	kept := backend.AddImage("rhel-golden", "rhel")
+
+	path := filepath.Join(t.TempDir(), "journal.json")
+	journal := powervscommon.NewJournal(path, &powervscommon.AccessConfig{Region: "us-south", Zone: "dal10", ServiceInstanceID: "workspace"})
+	if err := journal.Add(powervscommon.ResourceTypeImage, image, "packer-centos-image"); err != nil {
+		t.Fatal(err)
+	}
+
+	code, out := testRun(t, server, "--journal", path, "--force")
+	if code != 0 || !strings.Contains(out, "Deleted 1 resources.") {
+		t.Fatalf("run() = %d, output:\n%s", code, out)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("journal not removed: %v", err)
+	}
+	_, _ = backend.ImageClient().Get(image)
+	if ids := backend.ImageIDs(); len(ids) != 1 || ids[0] != kept {
+		t.Errorf("images = %v, want %s kept", ids, kept)
+	}
+}
+
+func TestRun_NoFilter(t *testing.T) {
+	server := fake.NewServer(fake.NewBackend())
+	t.Cleanup(server.Close)
+
+	// Never sweep a whole workspace by age alone.
+	if code, _ := testRun(t, server, "--force"); code != 1 {
+		t.Errorf("run() = %d, want 1", code)
+	}
+	if calls := server.Backend.Calls(); len(calls) != 0 {
+		t.Errorf("calls = %v, want none", calls)
+	}
+}
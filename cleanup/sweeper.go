@@ -0,0 +1,316 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
+	powervscommon "github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// instanceDeletePollInterval is the time between two checks of an instance being deleted.
+const instanceDeletePollInterval = 30 * time.Second
+
+// importClockSkew is the difference of clocks tolerated when matching an image with its import job.
+const importClockSkew = time.Minute
+
+// Resource is a PowerVS resource found by the Sweeper.
+type Resource struct {
+	Type string
+	ID   string
+	Name string
+	// Age is zero for resources PowerVS reports no creation date for.
+	Age time.Duration
+}
+
+// Filter selects the resources considered to be left behind by Packer. A resource must match every
+// criteria that is set.
+type Filter struct {
+	// Prefix the resource name must start with.
+	Prefix string
+	// Tag, in `key:value` form, the resource must carry.
+	Tag string
+	// OlderThan is the minimum age of a resource.
+	OlderThan time.Duration
+}
+
+// Networks and DHCP servers carry neither a name set by the builder nor a creation date: they are only
+// selected by Tag, and only when no instance is attached to them.
+func (f Filter) selectsNetworks() bool {
+	return f.Tag != ""
+}
+
+// Sweeper finds and deletes the instances, DHCP servers, networks and images of a workspace that match a Filter.
+type Sweeper struct {
+	Filter Filter
+
+	ImageClient    powervscommon.ImageClient
+	InstanceClient powervscommon.InstanceClient
+	NetworkClient  powervscommon.NetworkClient
+	DHCPClient     powervscommon.DHCPClient
+	TaggingClient  powervscommon.TaggingClient
+
+	now func() time.Time
+}
+
+// NewSweeper creates a Sweeper with clients for the workspace configured in the AccessConfig.
+func NewSweeper(ctx context.Context, c *powervscommon.AccessConfig, filter Filter) (*Sweeper, error) {
+	imageClient, err := c.ImageClient(ctx, c.ServiceInstanceID)
+	if err != nil {
+		return nil, err
+	}
+	instanceClient, err := c.InstanceClient(ctx, c.ServiceInstanceID)
+	if err != nil {
+		return nil, err
+	}
+	networkClient, err := c.NetworkClient(ctx, c.ServiceInstanceID)
+	if err != nil {
+		return nil, err
+	}
+	dhcpClient, err := c.DHCPClient(ctx, c.ServiceInstanceID)
+	if err != nil {
+		return nil, err
+	}
+	taggingClient, err := c.TaggingClient()
+	if err != nil {
+		return nil, err
+	}
+	retrier := c.Retrier(ctx)
+	return &Sweeper{
+		Filter:         filter,
+		ImageClient:    retrier.ImageClient(imageClient),
+		InstanceClient: retrier.InstanceClient(instanceClient),
+		NetworkClient:  retrier.NetworkClient(networkClient),
+		DHCPClient:     retrier.DHCPClient(dhcpClient),
+		TaggingClient:  taggingClient,
+		now:            time.Now,
+	}, nil
+}
+
+// Find returns the matching resources in the order they have to be deleted: instances first, then
+// DHCP servers, networks and images.
+func (s *Sweeper) Find(ctx context.Context) ([]Resource, error) {
+	var found []Resource
+
+	instances, err := s.InstanceClient.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+	// Networks still attached to an instance that is kept are in use.
+	inUse := map[string]bool{}
+	for _, in := range instances.PvmInstances {
+		age := s.age(time.Time(in.CreationDate))
+		ok, err := s.matches(ctx, *in.ServerName, string(in.Crn), age)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, Resource{Type: powervscommon.ResourceTypeInstance, ID: *in.PvmInstanceID, Name: *in.ServerName, Age: age})
+			continue
+		}
+		for _, net := range in.Networks {
+			inUse[net.NetworkID] = true
+		}
+	}
+
+	if s.Filter.selectsNetworks() {
+		networks, err := s.findNetworks(ctx, inUse)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, networks...)
+	}
+
+	images, err := s.ImageClient.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	for _, image := range images.Images {
+		var age time.Duration
+		if image.CreationDate != nil {
+			age = s.age(time.Time(*image.CreationDate))
+		}
+		ok, err := s.matches(ctx, *image.Name, string(image.Crn), age)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, Resource{Type: powervscommon.ResourceTypeImage, ID: *image.ImageID, Name: *image.Name, Age: age})
+		}
+	}
+
+	return found, nil
+}
+
+// findNetworks returns the DHCP servers and networks carrying the tag of the filter that are not in use.
+func (s *Sweeper) findNetworks(ctx context.Context, inUse map[string]bool) ([]Resource, error) {
+	var found []Resource
+	networks, err := s.NetworkClient.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+	networkCRNs := map[string]string{}
+	for _, net := range networks.Networks {
+		networkCRNs[*net.NetworkID] = string(net.Crn)
+	}
+
+	dhcpServers, err := s.DHCPClient.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DHCP servers: %w", err)
+	}
+	dhcpNetworks := map[string]bool{}
+	for _, server := range dhcpServers {
+		if server.Network == nil || server.Network.ID == nil {
+			continue
+		}
+		dhcpNetworks[*server.Network.ID] = true
+		if inUse[*server.Network.ID] {
+			continue
+		}
+		ok, err := s.tagged(ctx, networkCRNs[*server.Network.ID])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, Resource{Type: powervscommon.ResourceTypeDHCPServer, ID: *server.ID, Name: *server.Network.Name})
+		}
+	}
+
+	for _, net := range networks.Networks {
+		// DHCP networks are deleted together with their DHCP server.
+		if dhcpNetworks[*net.NetworkID] || inUse[*net.NetworkID] {
+			continue
+		}
+		ok, err := s.tagged(ctx, string(net.Crn))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, Resource{Type: powervscommon.ResourceTypeNetwork, ID: *net.NetworkID, Name: *net.Name})
+		}
+	}
+	return found, nil
+}
+
+// Delete deletes a resource returned by Find.
+func (s *Sweeper) Delete(r Resource) error {
+	switch r.Type {
+	case powervscommon.ResourceTypeInstance:
+		return s.InstanceClient.Delete(r.ID)
+	case powervscommon.ResourceTypeDHCPServer:
+		return s.DHCPClient.Delete(r.ID)
+	case powervscommon.ResourceTypeNetwork:
+		return s.NetworkClient.Delete(r.ID)
+	case powervscommon.ResourceTypeImage:
+		return s.ImageClient.Delete(r.ID)
+	case powervscommon.ResourceTypeImageImport:
+		return s.deleteImported(r)
+	default:
+		return fmt.Errorf("unknown resource type: %s", r.Type)
+	}
+}
+
+// deleteImported deletes the image of a journaled import job: the images with the name of the job's
+// image created since the job was started. Nothing is deleted when the job imported no image.
+func (s *Sweeper) deleteImported(r Resource) error {
+	images, err := s.ImageClient.GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list images: %w", err)
+	}
+	for _, image := range images.Images {
+		if *image.Name != r.Name || image.CreationDate == nil {
+			continue
+		}
+		// The clocks of the build host and PowerVS may differ by a little.
+		if s.age(time.Time(*image.CreationDate)) > r.Age+importClockSkew {
+			continue
+		}
+		if err := s.ImageClient.Delete(*image.ImageID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sweeper) age(created time.Time) time.Duration {
+	if created.IsZero() {
+		return 0
+	}
+	return s.now().Sub(created)
+}
+
+// matches reports whether a resource passes the filter. An age of zero means the creation date is unknown,
+// such a resource is never old enough.
+func (s *Sweeper) matches(ctx context.Context, name, crn string, age time.Duration) (bool, error) {
+	if s.Filter.Prefix != "" && !strings.HasPrefix(name, s.Filter.Prefix) {
+		return false, nil
+	}
+	if s.Filter.OlderThan != 0 && (age == 0 || age < s.Filter.OlderThan) {
+		return false, nil
+	}
+	if s.Filter.Tag == "" {
+		return true, nil
+	}
+	return s.tagged(ctx, crn)
+}
+
+// tagged reports whether a resource carries the tag of the filter.
+func (s *Sweeper) tagged(ctx context.Context, crn string) (bool, error) {
+	if crn == "" {
+		return false, nil
+	}
+	tags, err := s.tags(ctx, crn)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(tags, s.Filter.Tag), nil
+}
+
+func (s *Sweeper) tags(ctx context.Context, crn string) ([]string, error) {
+	list, _, err := s.TaggingClient.ListTagsWithContext(ctx, &globaltaggingv1.ListTagsOptions{
+		AttachedTo: core.StringPtr(crn),
+		TagType:    core.StringPtr(globaltaggingv1.ListTagsOptionsTagTypeUserConst),
+		Providers:  []string{globaltaggingv1.ListTagsOptionsProvidersGhostConst},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %w", crn, err)
+	}
+	var tags []string
+	for _, tag := range list.Items {
+		tags = append(tags, *tag.Name)
+	}
+	return tags, nil
+}
+
+// JournalResources returns the resources recorded in a journal in the order they have to be deleted.
+func (s *Sweeper) JournalResources(j *powervscommon.Journal) []Resource {
+	var resources []Resource
+	for _, resourceType := range powervscommon.ResourceTypesDeleteOrder {
+		for _, e := range j.Resources {
+			if e.Type == resourceType {
+				resources = append(resources, Resource{Type: e.Type, ID: e.ID, Name: e.Name, Age: s.age(e.CreatedAt)})
+			}
+		}
+	}
+	return resources
+}
+
+// WaitInstanceDeleted waits until an instance is gone, so the networks attached to it can be deleted.
+func (s *Sweeper) WaitInstanceDeleted(ctx context.Context, id string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		if _, err := s.InstanceClient.Get(id); err != nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for instance %s to be deleted", id)
+		case <-time.After(instanceDeletePollInterval):
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package cleanup
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
+	powervscommon "github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+// testSweeper returns a sweeper of the backend, two days from now.
+func testSweeper(backend *fake.Backend, filter Filter) *Sweeper {
+	return &Sweeper{
+		Filter:         filter,
+		ImageClient:    backend.ImageClient(),
+		InstanceClient: backend.InstanceClient(),
+		NetworkClient:  backend.NetworkClient(),
+		DHCPClient:     backend.DHCPClient(),
+		TaggingClient:  backend.TaggingClient(),
+		now:            func() time.Time { return time.Now().Add(48 * time.Hour) },
+	}
+}
+
+func tag(t *testing.T, backend *fake.Backend, crn models.CRN) {
+	t.Helper()
+	_, _, err := backend.TaggingClient().AttachTagWithContext(context.Background(), &globaltaggingv1.AttachTagOptions{
+		Resources: []globaltaggingv1.Resource{{ResourceID: core.StringPtr(string(crn))}},
+		TagNames:  []string{"packer:ci"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createInstance(t *testing.T, backend *fake.Backend, name, networkID string) *models.PVMInstance {
+	t.Helper()
+	list, err := backend.InstanceClient().Create(&models.PVMInstanceCreate{
+		ServerName: core.StringPtr(name),
+		ImageID:    core.StringPtr("image"),
+		Networks:   []*models.PVMInstanceAddNetwork{{NetworkID: core.StringPtr(networkID)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := backend.InstanceClient().Get(*(*list)[0].PvmInstanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return in
+}
+
+func resourceNames(resources []Resource) []string {
+	var names []string
+	for _, r := range resources {
+		names = append(names, r.Type+" "+r.Name)
+	}
+	return names
+}
+
+// testWorkspace adds the resources of a leaked build and of the workspace owner to the backend.
+func testWorkspace(t *testing.T, backend *fake.Backend) {
+	// The network of a leaked build has no name of the build, only its run tags.
+	leaked, _ := backend.NetworkClient().Get(backend.AddNetwork("packer-network-1", "pub-vlan"))
+	tag(t, backend, leaked.Crn)
+	tag(t, backend, createInstance(t, backend, "packer-centos", *leaked.NetworkID).Crn)
+	backend.AddImage("packer-centos-image", "rhel")
+	// A build that just started.
+	recent := backend.AddImage("packer-rhel-image", "rhel")
+	backend.SetImageCreationDate(recent, time.Now().Add(47*time.Hour))
+
+	// The resources of the owner, one network matching the prefix and one used by a kept instance.
+	backend.AddNetwork("packer-production", "vlan")
+	used, _ := backend.NetworkClient().Get(backend.AddNetwork("database", "vlan"))
+	tag(t, backend, used.Crn)
+	createInstance(t, backend, "database", *used.NetworkID)
+	backend.AddImage("rhel-golden", "rhel")
+}
+
+func TestSweeper_FindByPrefix(t *testing.T) {
+	backend := fake.NewBackend()
+	testWorkspace(t, backend)
+
+	found, err := testSweeper(backend, Filter{Prefix: "packer-", OlderThan: 24 * time.Hour}).Find(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Networks are never selected by name.
+	want := []string{"instance packer-centos", "image packer-centos-image"}
+	if got := resourceNames(found); !slices.Equal(got, want) {
+		t.Errorf("Find() = %v, want %v", got, want)
+	}
+}
+
+func TestSweeper_FindByTag(t *testing.T) {
+	backend := fake.NewBackend()
+	testWorkspace(t, backend)
+
+	found, err := testSweeper(backend, Filter{Tag: "packer:ci", OlderThan: 24 * time.Hour}).Find(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The tagged network of the kept instance is in use.
+	want := []string{"instance packer-centos", "network packer-network-1"}
+	if got := resourceNames(found); !slices.Equal(got, want) {
+		t.Errorf("Find() = %v, want %v", got, want)
+	}
+}
+
+func TestSweeper_DeleteImageImport(t *testing.T) {
+	backend := fake.NewBackend()
+	earlier := backend.AddImage("cos-image", "rhel")
+	backend.SetImageCreationDate(earlier, time.Now().Add(-time.Hour))
+	imported := backend.AddImage("cos-image", "rhel")
+
+	journal := powervscommon.NewJournal(t.TempDir()+"/journal.json", &powervscommon.AccessConfig{})
+	if err := journal.Add(powervscommon.ResourceTypeImageImport, "job-1", "cos-image"); err != nil {
+		t.Fatal(err)
+	}
+	sweeper := testSweeper(backend, Filter{})
+	sweeper.now = time.Now
+	for _, r := range sweeper.JournalResources(journal) {
+		if err := sweeper.Delete(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the image imported by the job is deleted.
+	for _, id := range []string{earlier, imported} {
+		_, _ = backend.ImageClient().Get(id)
+	}
+	if ids := backend.ImageIDs(); !slices.Equal(ids, []string{earlier}) {
+		t.Errorf("images = %v, want %s kept and %s deleted", ids, earlier, imported)
+	}
+}
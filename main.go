@@ -3,8 +3,14 @@ package main
 import (
 	"fmt"
 	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/cleanup"
 	powervsData "github.com/ppc64le-cloud/packer-plugin-powervs/datasource/powervs"
+	powervsConvert "github.com/ppc64le-cloud/packer-plugin-powervs/post-processor/convert"
+	powervsImport "github.com/ppc64le-cloud/packer-plugin-powervs/post-processor/cosimport"
+	powervsExport "github.com/ppc64le-cloud/packer-plugin-powervs/post-processor/export"
+	powervsManifest "github.com/ppc64le-cloud/packer-plugin-powervs/post-processor/manifest"
 	powervsPP "github.com/ppc64le-cloud/packer-plugin-powervs/post-processor/powervs"
+	powervsRetention "github.com/ppc64le-cloud/packer-plugin-powervs/post-processor/retention"
 	powervsProv "github.com/ppc64le-cloud/packer-plugin-powervs/provisioner/powervs"
 	powervsVersion "github.com/ppc64le-cloud/packer-plugin-powervs/version"
 	"os"
@@ -13,10 +19,19 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == cleanup.CommandName {
+		os.Exit(cleanup.Run(os.Args[2:]))
+	}
+
 	pps := plugin.NewSet()
 	pps.RegisterBuilder(plugin.DEFAULT_NAME, new(powervs.Builder))
 	pps.RegisterProvisioner(plugin.DEFAULT_NAME, new(powervsProv.Provisioner))
 	pps.RegisterPostProcessor(plugin.DEFAULT_NAME, new(powervsPP.PostProcessor))
+	pps.RegisterPostProcessor("manifest", new(powervsManifest.PostProcessor))
+	pps.RegisterPostProcessor("retention", new(powervsRetention.PostProcessor))
+	pps.RegisterPostProcessor("export", new(powervsExport.PostProcessor))
+	pps.RegisterPostProcessor("import", new(powervsImport.PostProcessor))
+	pps.RegisterPostProcessor("convert", new(powervsConvert.PostProcessor))
 	pps.RegisterDatasource(plugin.DEFAULT_NAME, new(powervsData.Datasource))
 	pps.SetVersion(powervsVersion.PluginVersion)
 	err := pps.Run()
@@ -0,0 +1,54 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// BuilderId is the ID of the artifacts of the post-processor.
+const BuilderId = "packer.post-processor.powervs-convert"
+
+// Artifact is the disk files converted from the OVA.
+type Artifact struct {
+	// Format is the format of the disk files, qcow2 or raw.
+	Format string
+	// Paths are the disk files, in the order of the OVA.
+	Paths []string
+}
+
+func (*Artifact) BuilderId() string {
+	return BuilderId
+}
+
+func (a *Artifact) Files() []string {
+	return a.Paths
+}
+
+// Id returns the file of the first disk, the boot disk of the image.
+func (a *Artifact) Id() string {
+	if len(a.Paths) == 0 {
+		return ""
+	}
+	return a.Paths[0]
+}
+
+func (a *Artifact) String() string {
+	return fmt.Sprintf("PowerVS disks in %s format: %s", a.Format, strings.Join(a.Paths, ", "))
+}
+
+func (a *Artifact) State(name string) interface{} {
+	if name == "format" {
+		return a.Format
+	}
+	return nil
+}
+
+func (a *Artifact) Destroy() error {
+	for _, path := range a.Paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
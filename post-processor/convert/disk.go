@@ -0,0 +1,183 @@
+package convert
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// clusterBits is the log2 of the qcow2 cluster size, 64 KiB as qemu-img. Raw disks are written by
+	// clusters too, a cluster of zeros is left as a hole.
+	clusterBits = 16
+	clusterSize = 1 << clusterBits
+
+	qcow2Magic   = 0x514649fb // "QFI\xfb"
+	qcow2Version = 2
+	// qcow2Copied flags the L1 and L2 entries of clusters with a refcount of 1.
+	qcow2Copied = 1 << 63
+	// qcow2HeaderSize is the size of a version 2 header.
+	qcow2HeaderSize = 72
+	// qcow2RefcountsPerBlock is the number of 16 bits refcounts of a refcount block.
+	qcow2RefcountsPerBlock = clusterSize / 2
+	qcow2EntriesPerTable   = clusterSize / 8
+)
+
+// readClusters reads the size bytes of the disk r by clusters and calls write with the index and data of
+// each cluster that is not all zeros. The data of the last cluster is padded with zeros.
+func readClusters(r io.Reader, size int64, write func(index int64, data []byte) error) error {
+	buf := make([]byte, clusterSize)
+	for index := int64(0); index*clusterSize < size; index++ {
+		n := int(min(clusterSize, size-index*clusterSize))
+		if _, err := io.ReadFull(r, buf[:n]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return fmt.Errorf("the disk ends before its %d bytes", size)
+			}
+			return err
+		}
+		clear(buf[n:])
+		if isZero(buf) {
+			continue
+		}
+		if err := write(index, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// writeRaw writes the raw disk r of size bytes to f as a sparse file.
+func writeRaw(f *os.File, r io.Reader, size int64) error {
+	err := readClusters(r, size, func(index int64, data []byte) error {
+		n := min(clusterSize, size-index*clusterSize)
+		_, err := f.WriteAt(data[:n], index*clusterSize)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return f.Truncate(size)
+}
+
+// writeQCOW2 writes the raw disk r of size bytes to f as a version 2 qcow2 image, as `qemu-img convert
+// -O qcow2 -o compat=0.10`. Only the clusters that are not all zeros are allocated. The clusters are
+// laid out as they are read: the header, the data, the L2 tables, the L1 table, the refcount table and
+// the refcount blocks.
+func writeQCOW2(f *os.File, r io.Reader, size int64) error {
+	clusters := (size + clusterSize - 1) / clusterSize
+	l1Size := (clusters + qcow2EntriesPerTable - 1) / qcow2EntriesPerTable
+	// The host offset of every guest cluster, 0 when it is not allocated.
+	l2 := make([]uint64, l1Size*qcow2EntriesPerTable)
+
+	offset := int64(clusterSize)
+	err := readClusters(r, size, func(index int64, data []byte) error {
+		if _, err := f.WriteAt(data, offset); err != nil {
+			return err
+		}
+		l2[index] = uint64(offset) | qcow2Copied
+		offset += clusterSize
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l1 := make([]uint64, l1Size)
+	for i := range l1 {
+		table := l2[int64(i)*qcow2EntriesPerTable : int64(i+1)*qcow2EntriesPerTable]
+		if isZeroTable(table) {
+			continue
+		}
+		if err := writeTable(f, offset, table); err != nil {
+			return err
+		}
+		l1[i] = uint64(offset) | qcow2Copied
+		offset += clusterSize
+	}
+	l1Offset := offset
+	if err := writeTable(f, l1Offset, l1); err != nil {
+		return err
+	}
+	offset += clusterCount(l1Size*8) * clusterSize
+
+	// The refcount blocks count themselves and the refcount table: grow them until they cover every
+	// cluster.
+	used := offset / clusterSize
+	var blocks, tableClusters int64
+	for {
+		needBlocks := (used + blocks + tableClusters + qcow2RefcountsPerBlock - 1) / qcow2RefcountsPerBlock
+		needTable := clusterCount(needBlocks * 8)
+		if needBlocks == blocks && needTable == tableClusters {
+			break
+		}
+		blocks, tableClusters = needBlocks, needTable
+	}
+	tableOffset := offset
+	blocksOffset := tableOffset + tableClusters*clusterSize
+	total := used + blocks + tableClusters
+
+	table := make([]uint64, tableClusters*qcow2EntriesPerTable)
+	for i := range blocks {
+		table[i] = uint64(blocksOffset + i*clusterSize)
+	}
+	if err := writeTable(f, tableOffset, table); err != nil {
+		return err
+	}
+	block := make([]byte, clusterSize)
+	for i := range blocks {
+		clear(block)
+		for c := i * qcow2RefcountsPerBlock; c < min(total, (i+1)*qcow2RefcountsPerBlock); c++ {
+			binary.BigEndian.PutUint16(block[(c-i*qcow2RefcountsPerBlock)*2:], 1)
+		}
+		if _, err := f.WriteAt(block, blocksOffset+i*clusterSize); err != nil {
+			return err
+		}
+	}
+
+	header := make([]byte, qcow2HeaderSize)
+	binary.BigEndian.PutUint32(header[0:], qcow2Magic)
+	binary.BigEndian.PutUint32(header[4:], qcow2Version)
+	binary.BigEndian.PutUint32(header[20:], clusterBits)
+	binary.BigEndian.PutUint64(header[24:], uint64(size))
+	binary.BigEndian.PutUint32(header[36:], uint32(l1Size))
+	binary.BigEndian.PutUint64(header[40:], uint64(l1Offset))
+	binary.BigEndian.PutUint64(header[48:], uint64(tableOffset))
+	binary.BigEndian.PutUint32(header[56:], uint32(tableClusters))
+	_, err = f.WriteAt(header, 0)
+	return err
+}
+
+// clusterCount returns the number of clusters holding n bytes, at least one.
+func clusterCount(n int64) int64 {
+	return max(1, (n+clusterSize-1)/clusterSize)
+}
+
+func isZeroTable(table []uint64) bool {
+	for _, entry := range table {
+		if entry != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// writeTable writes the big-endian entries of a qcow2 table at offset, padded to a whole cluster.
+func writeTable(f *os.File, offset int64, entries []uint64) error {
+	buf := make([]byte, clusterCount(int64(len(entries))*8)*clusterSize)
+	for i, entry := range entries {
+		binary.BigEndian.PutUint64(buf[i*8:], entry)
+	}
+	_, err := f.WriteAt(buf, offset)
+	return err
+}
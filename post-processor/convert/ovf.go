@@ -0,0 +1,104 @@
+package convert
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// envelope is the part of the OVF descriptor of an OVA describing its disks.
+type envelope struct {
+	Files []ovfFile `xml:"References>File"`
+	Disks []ovfDisk `xml:"DiskSection>Disk"`
+}
+
+type ovfFile struct {
+	ID   string `xml:"id,attr"`
+	Href string `xml:"href,attr"`
+	Size string `xml:"size,attr"`
+}
+
+type ovfDisk struct {
+	DiskID                  string `xml:"diskId,attr"`
+	FileRef                 string `xml:"fileRef,attr"`
+	Capacity                string `xml:"capacity,attr"`
+	CapacityAllocationUnits string `xml:"capacityAllocationUnits,attr"`
+}
+
+// disk is a disk of the OVA, with the size of its file given by the OVF descriptor.
+type disk struct {
+	ID   string
+	Href string
+	Size int64
+}
+
+// allocationUnits matches the programmatic units of OVF, e.g. `byte * 2^30`.
+var allocationUnits = regexp.MustCompile(`^byte(?:\*(\d+)(?:\^(\d{1,2}))?)?$`)
+
+// parseOVF returns the disks of the OVF descriptor data, by the name of their file in the OVA.
+func parseOVF(data []byte) (map[string]disk, error) {
+	var e envelope
+	if err := xml.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to parse the OVF descriptor: %w", err)
+	}
+	files := map[string]ovfFile{}
+	for _, file := range e.Files {
+		files[file.ID] = file
+	}
+	disks := map[string]disk{}
+	for _, d := range e.Disks {
+		file, ok := files[d.FileRef]
+		if !ok {
+			return nil, fmt.Errorf("the disk %s of the OVF descriptor has no file", d.DiskID)
+		}
+		size, err := capacity(d.Capacity, d.CapacityAllocationUnits)
+		if err != nil {
+			return nil, fmt.Errorf("the disk %s of the OVF descriptor: %w", d.DiskID, err)
+		}
+		// The file of a raw disk is the disk itself.
+		if file.Size != "" && file.Size != strconv.FormatInt(size, 10) {
+			return nil, fmt.Errorf("the file %s of the disk %s is %s bytes, its capacity is %d bytes", file.Href, d.DiskID, file.Size, size)
+		}
+		disks[file.Href] = disk{ID: d.DiskID, Href: file.Href, Size: size}
+	}
+	if len(disks) == 0 {
+		return nil, errors.New("the OVF descriptor has no disk")
+	}
+	return disks, nil
+}
+
+// capacity returns the capacity of a disk in bytes.
+func capacity(value, units string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid capacity %q", value)
+	}
+	unit := int64(1)
+	if units != "" {
+		m := allocationUnits.FindStringSubmatch(strings.ReplaceAll(units, " ", ""))
+		if m == nil {
+			return 0, fmt.Errorf("unsupported capacity allocation units %q", units)
+		}
+		if m[1] != "" {
+			base, _ := strconv.ParseInt(m[1], 10, 64)
+			exp := int64(1)
+			if m[2] != "" {
+				exp, _ = strconv.ParseInt(m[2], 10, 64)
+			}
+			for range exp {
+				if base != 0 && unit > math.MaxInt64/base {
+					return 0, fmt.Errorf("unsupported capacity allocation units %q", units)
+				}
+				unit *= base
+			}
+		}
+	}
+	if unit != 0 && n > math.MaxInt64/unit {
+		return 0, fmt.Errorf("invalid capacity %q", value)
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,246 @@
+//go:generate packer-sdc struct-markdown
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+// Package convert implements the powervs-convert post-processor, which downloads the OVA exported to
+// Cloud Object Storage by the powervs builder and converts its disks to qcow2 or raw files, e.g. to boot
+// the image with KVM/QEMU.
+package convert
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs"
+	powervscommon "github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+const (
+	FormatQCOW2 = "qcow2"
+	FormatRaw   = "raw"
+)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The bucket the OVA is downloaded from and its HMAC keys, as the `cos` block of `capture`. The
+	// bucket and region default to the ones the artifact was exported to. Required.
+	COS *powervscommon.CaptureCOS `mapstructure:"cos" required:"true"`
+
+	// The object of the OVA in the bucket. Default: the object the artifact was exported to.
+	Object string `mapstructure:"object" required:"false"`
+
+	// URL of the S3 API of Cloud Object Storage. Defaults to the public or private endpoint of the
+	// bucket region depending on `use_private_endpoints`.
+	COSEndpoint string `mapstructure:"cos_endpoint" required:"false"`
+
+	// Use the private endpoint of Cloud Object Storage. Default `false`.
+	UsePrivateEndpoints bool `mapstructure:"use_private_endpoints" required:"false"`
+
+	// The format of the disk files, `qcow2` or `raw`. Raw disks are written as sparse files.
+	// Default `qcow2`.
+	Format string `mapstructure:"format" required:"false"`
+
+	// The directory the disk files are written to. A disk is written to a file named after its file in
+	// the OVA, with the extension of the format. Default: `output-<build name>`.
+	OutputDirectory string `mapstructure:"output_directory" required:"false"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+
+	// Client, created for the bucket of every artifact when not set by tests.
+	cosClient powervscommon.COSClient
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "packer.post-processor.powervs-convert",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packersdk.MultiError
+	if p.config.COS == nil || p.config.COS.AccessKey == "" || p.config.COS.SecretKey == "" {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("cos access_key and secret_key are required"))
+	}
+	switch p.config.Format {
+	case "":
+		p.config.Format = FormatQCOW2
+	case FormatQCOW2, FormatRaw:
+	default:
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("invalid format: %q (use %q or %q)", p.config.Format, FormatQCOW2, FormatRaw))
+	}
+	if p.config.OutputDirectory == "" {
+		p.config.OutputDirectory = "output-" + p.config.PackerBuildName
+	}
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	packersdk.LogSecretFilter.Set(p.config.COS.AccessKey, p.config.COS.SecretKey)
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, source packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	if source.BuilderId() != powervs.BuilderId {
+		return nil, false, false, fmt.Errorf("unsupported artifact of the builder %s, only the artifacts of the powervs builder are supported", source.BuilderId())
+	}
+	cos := *p.config.COS
+	if cos.Bucket == "" {
+		cos.Bucket, _ = source.State("cos_bucket").(string)
+	}
+	if cos.Region == "" {
+		cos.Region, _ = source.State("cos_region").(string)
+	}
+	object := p.config.Object
+	if object == "" {
+		object, _ = source.State("cos_object").(string)
+	}
+	if cos.Bucket == "" || cos.Region == "" || object == "" {
+		return nil, false, false, errors.New("cos bucket, region and object are required when the artifact was not exported to Cloud Object Storage")
+	}
+	cosClient := p.cosClient
+	if cosClient == nil {
+		endpoint := p.config.COSEndpoint
+		if endpoint == "" {
+			endpoint = powervscommon.COSEndpoint(cos.Region, p.config.UsePrivateEndpoints)
+		}
+		var err error
+		if cosClient, err = powervscommon.NewCOSClient(&cos, endpoint); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	ui.Say(fmt.Sprintf("Downloading %s from the bucket %s", object, cos.Bucket))
+	output, err := cosClient.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cos.Bucket),
+		Key:    aws.String(object),
+	})
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed to download %s: %w", object, err)
+	}
+	defer output.Body.Close()
+
+	var r io.Reader = output.Body
+	if strings.HasSuffix(object, ".gz") {
+		gz, err := gzip.NewReader(output.Body)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("failed to decompress %s: %w", object, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	if err := os.MkdirAll(p.config.OutputDirectory, 0o755); err != nil {
+		return nil, false, false, err
+	}
+	files, err := p.convertOVA(ui, r)
+	if err != nil {
+		for _, file := range files {
+			os.Remove(file)
+		}
+		return nil, false, false, fmt.Errorf("failed to convert %s: %w", object, err)
+	}
+	return &Artifact{Format: p.config.Format, Paths: files}, true, false, nil
+}
+
+// convertOVA converts the disks of the OVA r and returns their files. The files written so far are
+// returned with an error too.
+func (p *PostProcessor) convertOVA(ui packersdk.Ui, r io.Reader) ([]string, error) {
+	var disks map[string]disk
+	var files []string
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return files, fmt.Errorf("failed to read the OVA: %w", err)
+		}
+		name := path.Base(header.Name)
+		switch {
+		case disks == nil:
+			// The OVF descriptor is the first file of an OVA.
+			if path.Ext(name) != ".ovf" {
+				return files, fmt.Errorf("the OVA starts with %s instead of its OVF descriptor", name)
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return files, fmt.Errorf("failed to read the OVF descriptor: %w", err)
+			}
+			if disks, err = parseOVF(data); err != nil {
+				return files, err
+			}
+		case disks[name].Href != "":
+			d := disks[name]
+			if header.Size != d.Size {
+				return files, fmt.Errorf("the disk %s is %d bytes, the OVF descriptor gives a capacity of %d bytes", name, header.Size, d.Size)
+			}
+			file := filepath.Join(p.config.OutputDirectory, strings.TrimSuffix(name, path.Ext(name))+"."+p.config.Format)
+			ui.Say(fmt.Sprintf("Converting the disk %s (%d bytes) to %s", name, d.Size, file))
+			files = append(files, file)
+			if err := writeDisk(file, p.config.Format, tr, d.Size); err != nil {
+				return files, fmt.Errorf("failed to convert the disk %s: %w", name, err)
+			}
+			delete(disks, name)
+		default:
+			ui.Message(fmt.Sprintf("Skipping %s", name))
+		}
+	}
+	if disks == nil {
+		return files, errors.New("the OVA has no OVF descriptor")
+	}
+	if len(disks) != 0 {
+		var missing []string
+		for name := range disks {
+			missing = append(missing, name)
+		}
+		slices.Sort(missing)
+		return files, fmt.Errorf("the disks %s of the OVF descriptor are not in the OVA", strings.Join(missing, ", "))
+	}
+	return files, nil
+}
+
+// writeDisk writes the raw disk r of size bytes to file in format.
+func writeDisk(file, format string, r io.Reader, size int64) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if format == FormatRaw {
+		err = writeRaw(f, r, size)
+	} else {
+		err = writeQCOW2(f, r, size)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,237 @@
+package convert
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/post-processor/internal/pptest"
+)
+
+const testOVF = `<?xml version="1.0" encoding="UTF-8"?>
+<ovf:Envelope xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1">
+  <ovf:References>
+    <ovf:File ovf:href="golden-disk0.raw" ovf:id="file1" ovf:size="%d"/>
+  </ovf:References>
+  <ovf:DiskSection>
+    <ovf:Info>Disks</ovf:Info>
+    <ovf:Disk ovf:capacity="%d" ovf:capacityAllocationUnits="byte * 2^10" ovf:diskId="disk1" ovf:fileRef="file1"/>
+  </ovf:DiskSection>
+</ovf:Envelope>
+`
+
+// testDisk returns a raw disk of 3 MiB and 1 KiB, ending with a partial cluster, with data in its
+// first, third and last clusters.
+func testDisk() []byte {
+	data := make([]byte, 3*1024*1024+1024)
+	copy(data, "boot")
+	copy(data[2*clusterSize+100:], "root")
+	copy(data[len(data)-4:], "last")
+	return data
+}
+
+// testOVA returns an OVA of the disk, gzipped, with the capacity of the disk in KiB in its OVF descriptor.
+func testOVA(t *testing.T, disk []byte, capacityKiB int) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"golden.ovf", []byte(fmt.Sprintf(testOVF, capacityKiB*1024, capacityKiB))},
+		{"golden.mf", []byte("SHA256(golden-disk0.raw)= 0\n")},
+		{"golden-disk0.raw", disk},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testPostProcessor(t *testing.T, raw map[string]interface{}, ova []byte) *PostProcessor {
+	raw["cos"] = pptest.COS()
+	raw["output_directory"] = t.TempDir()
+	var p PostProcessor
+	pptest.Configure(t, &p, raw)
+	p.cosClient = &pptest.COSClient{Objects: map[string]pptest.COSObject{pptest.Object: {Data: ova}}}
+	return &p
+}
+
+// readQCOW2 returns the raw disk of a qcow2 image written by writeQCOW2, checking that every cluster of
+// the file has a refcount of 1.
+func readQCOW2(t *testing.T, data []byte) []byte {
+	t.Helper()
+	be := binary.BigEndian
+	if be.Uint32(data) != qcow2Magic || be.Uint32(data[4:]) != qcow2Version || be.Uint32(data[20:]) != clusterBits {
+		t.Fatalf("invalid qcow2 header %x", data[:qcow2HeaderSize])
+	}
+	if len(data)%clusterSize != 0 {
+		t.Fatalf("qcow2 image of %d bytes, not a whole number of clusters", len(data))
+	}
+	size := be.Uint64(data[24:])
+	l1Size := be.Uint32(data[36:])
+	l1Offset := be.Uint64(data[40:])
+	tableOffset := be.Uint64(data[48:])
+
+	for cluster := 0; cluster < len(data)/clusterSize; cluster++ {
+		block := be.Uint64(data[tableOffset+uint64(cluster/qcow2RefcountsPerBlock)*8:])
+		if refcount := be.Uint16(data[block+uint64(cluster%qcow2RefcountsPerBlock)*2:]); refcount != 1 {
+			t.Errorf("refcount of the cluster %d = %d, want 1", cluster, refcount)
+		}
+	}
+
+	disk := make([]byte, size)
+	for i := range uint64(l1Size) {
+		l2Offset := be.Uint64(data[l1Offset+i*8:]) &^ qcow2Copied
+		if l2Offset == 0 {
+			continue
+		}
+		for j := range uint64(qcow2EntriesPerTable) {
+			offset := be.Uint64(data[l2Offset+j*8:]) &^ qcow2Copied
+			if offset != 0 {
+				copy(disk[(i*qcow2EntriesPerTable+j)*clusterSize:], data[offset:offset+clusterSize])
+			}
+		}
+	}
+	return disk
+}
+
+func TestPostProcessor_Configure(t *testing.T) {
+	for name, raw := range map[string]map[string]interface{}{
+		"no cos":         {},
+		"no secret key":  {"cos": map[string]interface{}{"access_key": "access"}},
+		"invalid format": {"cos": pptest.COS(), "format": "vmdk"},
+	} {
+		var p PostProcessor
+		if err := p.Configure(raw); err == nil {
+			t.Errorf("Configure() with %s succeeded", name)
+		}
+	}
+
+	var p PostProcessor
+	if err := p.Configure(map[string]interface{}{
+		"packer_build_name": "centos",
+		"cos":               pptest.COS(),
+	}); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	if p.config.Format != FormatQCOW2 || p.config.OutputDirectory != "output-centos" {
+		t.Errorf("format = %s, output directory = %s", p.config.Format, p.config.OutputDirectory)
+	}
+}
+
+func TestPostProcessor_PostProcess(t *testing.T) {
+	disk := testDisk()
+	for _, format := range []string{FormatQCOW2, FormatRaw} {
+		t.Run(format, func(t *testing.T) {
+			p := testPostProcessor(t, map[string]interface{}{"format": format}, testOVA(t, disk, len(disk)/1024))
+
+			artifact, keep, forceOverride, err := p.PostProcess(context.Background(), packersdk.TestUi(t), pptest.Artifact(powervs.CaptureDestinationCloudStorage, ""))
+			if err != nil {
+				t.Fatalf("PostProcess() error = %v", err)
+			}
+			if !keep || forceOverride {
+				t.Errorf("PostProcess() keep = %t, force override = %t", keep, forceOverride)
+			}
+			file := filepath.Join(p.config.OutputDirectory, "golden-disk0."+format)
+			if files := artifact.Files(); len(files) != 1 || files[0] != file || artifact.Id() != file {
+				t.Fatalf("artifact files = %v, want %s", files, file)
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format == FormatQCOW2 {
+				// The header, 3 data clusters, an L2 table, the L1 table, the refcount table and block.
+				if len(data) != 8*clusterSize {
+					t.Errorf("qcow2 image of %d bytes, want %d", len(data), 8*clusterSize)
+				}
+				data = readQCOW2(t, data)
+			}
+			if !bytes.Equal(data, disk) {
+				t.Error("the converted disk differs from the disk of the OVA")
+			}
+		})
+	}
+}
+
+func TestPostProcessor_PostProcess_Buckets(t *testing.T) {
+	disk := testDisk()
+	p := testPostProcessor(t, map[string]interface{}{}, testOVA(t, disk, len(disk)/1024))
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), pptest.Artifact(powervs.CaptureDestinationCloudStorage, "")); err != nil {
+		t.Fatalf("PostProcess() error = %v", err)
+	}
+
+	// The next artifact is downloaded from its own bucket.
+	other := pptest.Artifact(powervs.CaptureDestinationCloudStorage, "")
+	other.StateData["cos_bucket"] = "other"
+	other.StateData["cos_region"] = "eu-de"
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), other); err == nil || !strings.Contains(err.Error(), "other") {
+		t.Errorf("PostProcess() error = %v, want the object of the bucket other downloaded", err)
+	}
+	if p.config.COS.Bucket != "" || p.config.COS.Region != "" {
+		t.Errorf("cos = %+v, want the configuration unchanged", p.config.COS)
+	}
+}
+
+func TestPostProcessor_PostProcess_SizeMismatch(t *testing.T) {
+	disk := make([]byte, 4096)
+	// The OVF descriptor gives 8 KiB for a disk of 4 KiB.
+	p := testPostProcessor(t, map[string]interface{}{}, testOVA(t, disk, 8))
+
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), pptest.Artifact(powervs.CaptureDestinationCloudStorage, "")); err == nil {
+		t.Fatal("PostProcess() succeeded with a disk smaller than its capacity")
+	}
+	if entries, _ := os.ReadDir(p.config.OutputDirectory); len(entries) != 0 {
+		t.Errorf("files left in the output directory: %v", entries)
+	}
+}
+
+func TestPostProcessor_PostProcess_NoObject(t *testing.T) {
+	p := testPostProcessor(t, map[string]interface{}{}, nil)
+	source := &powervs.Artifact{StateData: map[string]interface{}{"image_id": "captured"}}
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), source); err == nil {
+		t.Fatal("PostProcess() succeeded without an object in Cloud Object Storage")
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	for _, tt := range []struct {
+		value, units string
+		want         int64
+		wantErr      bool
+	}{
+		{value: "21474836480", want: 21474836480},
+		{value: "20", units: "byte * 2^30", want: 20 << 30},
+		{value: "512", units: "byte * 1024", want: 512 * 1024},
+		{value: "20", units: "byte * 2^70", wantErr: true},
+		{value: "20", units: "MB", wantErr: true},
+		{value: "-1", wantErr: true},
+	} {
+		got, err := capacity(tt.value, tt.units)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("capacity(%q, %q) = %d, %v, want %d", tt.value, tt.units, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+//go:generate packer-sdc struct-markdown
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,Workspace
+
+// Package cosimport implements the powervs-import post-processor, which imports the image exported to
+// Cloud Object Storage by the powervs builder into the image catalog of other workspaces.
+package cosimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs"
+	powervscommon "github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+// jobPollInterval is the time between two checks of an import job, modified in tests.
+var jobPollInterval = powervs.JobPollInterval
+
+type Config struct {
+	common.PackerConfig        `mapstructure:",squash"`
+	powervscommon.AccessConfig `mapstructure:",squash"`
+
+	// The workspaces the image is imported into. The workspace options of the post-processor itself,
+	// `service_instance_id` and `workspace_name`, can not be set. Required.
+	Workspaces []Workspace `mapstructure:"workspaces" required:"true"`
+
+	// The object imported, as the `cos` block of `source`. `bucket`, `object` and `region` default to
+	// the bucket, object and region the image was exported to. The bucket is read with `access_key`
+	// and `secret_key` when they are set, as a public bucket otherwise.
+	COS *powervscommon.COS `mapstructure:"cos" required:"false"`
+
+	// Name of the imported images. Default: the name of the captured image, or else the name of the
+	// object without `.ova.gz`.
+	ImageName string `mapstructure:"image_name" required:"false"`
+
+	// Storage type of the imported images. Default: `tier1`.
+	StorageType string `mapstructure:"storage_type" required:"false"`
+
+	workspaces []powervscommon.AccessConfig
+	ctx        interpolate.Context
+}
+
+// Workspace is a workspace the image is imported into. The IBM Cloud credentials and endpoints are
+// those of the post-processor.
+type Workspace struct {
+	// Power VS ServiceInstanceID. Required unless `workspace_name` is set.
+	ServiceInstanceID string `mapstructure:"service_instance_id" required:"false"`
+	// Name of the PowerVS workspace. Can not be used with `service_instance_id`.
+	WorkspaceName string `mapstructure:"workspace_name" required:"false"`
+	// Zone of the workspace. Required with `service_instance_id`.
+	Zone string `mapstructure:"zone" required:"false"`
+	// Region of the workspace. Derived from the zone when not set.
+	Region string `mapstructure:"region" required:"false"`
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "packer.post-processor.powervs-import",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packersdk.MultiError
+	if p.config.ServiceInstanceID != "" || p.config.WorkspaceName != "" {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("service_instance_id and workspace_name can not be set, list the workspaces in workspaces"))
+	}
+	if len(p.config.Workspaces) == 0 {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("workspaces is required"))
+	}
+	if p.config.COS != nil && (p.config.COS.AccessKey == "") != (p.config.COS.SecretKey == "") {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("cos access_key and secret_key must be set together"))
+	}
+	if p.config.StorageType == "" {
+		p.config.StorageType = powervs.StorageTypeTier1
+	}
+
+	// Every workspace gets the credentials and endpoints of the post-processor.
+	p.config.workspaces = nil
+	for i, workspace := range p.config.Workspaces {
+		access := p.config.AccessConfig
+		access.Reset()
+		access.ServiceInstanceID = workspace.ServiceInstanceID
+		access.WorkspaceName = workspace.WorkspaceName
+		access.Zone = workspace.Zone
+		access.Region = workspace.Region
+		for _, err := range access.Prepare() {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("workspaces[%d]: %w", i, err))
+		}
+		p.config.workspaces = append(p.config.workspaces, access)
+	}
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	for i := range p.config.workspaces {
+		if err := p.config.workspaces[i].ResolveWorkspace(context.Background()); err != nil {
+			return fmt.Errorf("workspaces[%d]: %w", i, err)
+		}
+	}
+	packersdk.LogSecretFilter.Set(p.config.APIKey)
+	if p.config.COS != nil && p.config.COS.SecretKey != "" {
+		packersdk.LogSecretFilter.Set(p.config.COS.AccessKey, p.config.COS.SecretKey)
+	}
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, source packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	if source.BuilderId() != powervs.BuilderId {
+		return nil, false, false, fmt.Errorf("unsupported artifact of the builder %s, only the artifacts of the powervs builder are supported", source.BuilderId())
+	}
+	cos := p.object(source)
+	if cos.Bucket == "" || cos.Object == "" || cos.Region == "" {
+		return nil, false, false, fmt.Errorf("the artifact has no image in Cloud Object Storage, capture it with the destination %q or %q, or set the cos bucket, object and region",
+			powervs.CaptureDestinationCloudStorage, powervs.CaptureDestinationBoth)
+	}
+	name := p.config.ImageName
+	if name == "" {
+		name, _ = source.State("image_name").(string)
+	}
+	if name == "" {
+		name = strings.TrimSuffix(path.Base(cos.Object), powervs.CaptureCOSObjectSuffix)
+	}
+
+	ui.Say(fmt.Sprintf("Importing %s from the bucket %s (%s) as %s into %d workspaces", cos.Object, cos.Bucket, cos.Region, name, len(p.config.workspaces)))
+	images := make([]string, len(p.config.workspaces))
+	errs := make([]error, len(p.config.workspaces))
+	var wg sync.WaitGroup
+	for i := range p.config.workspaces {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			images[i], errs[i] = p.importImage(ctx, ui, &p.config.workspaces[i], cos, name)
+		}(i)
+	}
+	wg.Wait()
+
+	imported := map[string]string{}
+	for i, access := range p.config.workspaces {
+		workspace := access.Zone + "/" + access.ServiceInstanceID
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("failed to import the image into %s: %w", workspace, errs[i])
+			continue
+		}
+		imported[workspace] = images[i]
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, false, false, err
+	}
+
+	artifact := powervs.CopyArtifact(source)
+	artifact.StateData["imported_images"] = imported
+	return artifact, true, false, nil
+}
+
+// object returns the object imported, from the configuration or else from the artifact.
+func (p *PostProcessor) object(source packersdk.Artifact) *powervscommon.COS {
+	cos := &powervscommon.COS{}
+	if p.config.COS != nil {
+		*cos = *p.config.COS
+	}
+	for _, field := range []struct {
+		value *string
+		key   string
+	}{
+		{&cos.Bucket, "cos_bucket"},
+		{&cos.Object, "cos_object"},
+		{&cos.Region, "cos_region"},
+	} {
+		if *field.value == "" {
+			*field.value, _ = source.State(field.key).(string)
+		}
+	}
+	return cos
+}
+
+// importImage imports the object into the workspace of access and returns the ID of the image.
+func (p *PostProcessor) importImage(ctx context.Context, ui packersdk.Ui, access *powervscommon.AccessConfig, cos *powervscommon.COS, name string) (string, error) {
+	ui = &powervs.PrefixedUi{Ui: ui, Prefix: fmt.Sprintf("[%s/%s] ", access.Zone, access.ServiceInstanceID)}
+	if err := access.CheckWorkspaceZone(ctx); err != nil {
+		return "", err
+	}
+	imageClient, err := access.ImageClient(ctx, access.ServiceInstanceID)
+	if err != nil {
+		return "", err
+	}
+	jobClient, err := access.JobClient(ctx, access.ServiceInstanceID)
+	if err != nil {
+		return "", err
+	}
+	retrier := access.Retrier(ctx)
+
+	ui.Say(fmt.Sprintf("Importing the image %s", name))
+	jobRef, err := retrier.ImageClient(imageClient).CreateCosImage(powervs.CosImageImportJob(name, cos, p.config.StorageType))
+	if err != nil {
+		return "", fmt.Errorf("failed to CreateCosImage: %w", err)
+	}
+	imageRef, err := powervs.WaitCOSImageImport(ui, retrier.ImageClient(imageClient), retrier.JobClient(jobClient), *jobRef.ID, name, jobPollInterval, nil)
+	if err != nil {
+		return "", err
+	}
+	ui.Say(fmt.Sprintf("Image %s imported: %s", name, *imageRef.ImageID))
+	return *imageRef.ImageID, nil
+}
@@ -0,0 +1,139 @@
+package cosimport
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/post-processor/internal/pptest"
+)
+
+func TestMain(m *testing.M) {
+	jobPollInterval = time.Millisecond
+	os.Exit(m.Run())
+}
+
+// testServer serves the backend for the workspaces dr-1 in wdc06 and dr-2 in syd05.
+func testServer(t *testing.T, backend *fake.Backend) *fake.Server {
+	backend.AddServiceInstance("dr-1", "wdc06")
+	backend.AddServiceInstance("dr-2", "syd05")
+	server := fake.NewServer(backend)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testConfig imports the image into two workspaces of the server.
+func testConfig(server *fake.Server) map[string]interface{} {
+	raw := pptest.Config(server)
+	delete(raw, "zone")
+	delete(raw, "service_instance_id")
+	raw["workspaces"] = []map[string]interface{}{
+		{"service_instance_id": "dr-1", "zone": "wdc06"},
+		{"service_instance_id": "dr-2", "zone": "syd05"},
+	}
+	return raw
+}
+
+func testPostProcessor(t *testing.T, raw map[string]interface{}) *PostProcessor {
+	var p PostProcessor
+	pptest.Configure(t, &p, raw)
+	return &p
+}
+
+func TestPostProcessor_Configure(t *testing.T) {
+	server := testServer(t, fake.NewBackend())
+
+	for name, change := range map[string]func(map[string]interface{}){
+		"no workspaces":       func(raw map[string]interface{}) { delete(raw, "workspaces") },
+		"top-level workspace": func(raw map[string]interface{}) { raw["service_instance_id"] = "workspace" },
+		"workspace without zone": func(raw map[string]interface{}) {
+			raw["workspaces"] = []map[string]interface{}{{"service_instance_id": "dr-1"}}
+		},
+		"no secret key": func(raw map[string]interface{}) { delete(raw["cos"].(map[string]interface{}), "secret_key") },
+	} {
+		raw := testConfig(server)
+		change(raw)
+		var p PostProcessor
+		if err := p.Configure(raw); err == nil {
+			t.Errorf("Configure() with %s succeeded", name)
+		}
+	}
+
+	p := testPostProcessor(t, testConfig(server))
+	if p.config.StorageType != powervs.StorageTypeTier1 || len(p.config.workspaces) != 2 || p.config.workspaces[1].Zone != "syd05" {
+		t.Errorf("storage type = %s, workspaces = %+v", p.config.StorageType, p.config.workspaces)
+	}
+}
+
+func TestPostProcessor_PostProcess(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.JobPolls = 2
+	server := testServer(t, backend)
+	p := testPostProcessor(t, testConfig(server))
+
+	artifact, keep, forceOverride, err := p.PostProcess(context.Background(), packersdk.TestUi(t), pptest.Artifact(powervs.CaptureDestinationCloudStorage, ""))
+	if err != nil {
+		t.Fatalf("PostProcess() error = %v", err)
+	}
+	if !keep || forceOverride {
+		t.Errorf("PostProcess() keep = %t, force override = %t", keep, forceOverride)
+	}
+
+	imports := 0
+	for _, call := range backend.Calls() {
+		if call == "ImageClient.CreateCosImage" {
+			imports++
+		}
+	}
+	if imports != 2 {
+		t.Errorf("imports = %d, want one per workspace", imports)
+	}
+	imported, _ := artifact.State("imported_images").(map[string]string)
+	ids := backend.ImageIDs()
+	for _, workspace := range []string{"wdc06/dr-1", "syd05/dr-2"} {
+		if !slices.Contains(ids, imported[workspace]) {
+			t.Errorf("imported image of %s = %q, want one of %v", workspace, imported[workspace], ids)
+		}
+	}
+	for _, id := range ids {
+		if image, _ := backend.Image(id); *image.Name != pptest.ImageName {
+			t.Errorf("image name = %s, want golden", *image.Name)
+		}
+	}
+	if artifact.State("cos_object") != pptest.Object {
+		t.Errorf("artifact state cos_object = %v, want the source object", artifact.State("cos_object"))
+	}
+}
+
+func TestPostProcessor_PostProcess_JobFailed(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.JobResult = fake.JobStateFailed
+	server := testServer(t, backend)
+	p := testPostProcessor(t, testConfig(server))
+
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), pptest.Artifact(powervs.CaptureDestinationCloudStorage, "")); err == nil {
+		t.Fatal("PostProcess() succeeded with failed import jobs")
+	}
+}
+
+func TestPostProcessor_PostProcess_NoObject(t *testing.T) {
+	backend := fake.NewBackend()
+	server := testServer(t, backend)
+	p := testPostProcessor(t, testConfig(server))
+
+	source := &powervs.Artifact{StateData: map[string]interface{}{
+		"capture_destination": powervs.CaptureDestinationImageCatalog,
+		"image_id":            "captured",
+	}}
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), source); err == nil {
+		t.Fatal("PostProcess() succeeded without an object in Cloud Object Storage")
+	}
+	if calls := backend.Calls(); len(calls) != 0 {
+		t.Errorf("calls = %v, want none", calls)
+	}
+}
@@ -0,0 +1,189 @@
+//go:generate packer-sdc struct-markdown
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+// Package export implements the powervs-export post-processor, which exports the image captured to the
+// image catalog by the powervs builder to a Cloud Object Storage bucket.
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/IBM-Cloud/power-go-client/power/models"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs"
+	powervscommon "github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+const (
+	// JobPollInterval is the time between two checks of the export job.
+	JobPollInterval = 30 * time.Second
+	// JobTimeoutDefault is the job_timeout when it is not set.
+	JobTimeoutDefault = time.Hour
+)
+
+// modified in tests
+var jobPollInterval = JobPollInterval
+
+type Config struct {
+	common.PackerConfig        `mapstructure:",squash"`
+	powervscommon.AccessConfig `mapstructure:",squash"`
+
+	// The bucket the image is exported to and its HMAC keys, as the `cos` block of `capture`. Required.
+	COS *powervscommon.CaptureCOS `mapstructure:"cos" required:"true"`
+
+	// The folder of the bucket the image is exported to, e.g. `nightly/centos`. The object is
+	// `<prefix>/<image name>.ova.gz`. Default: the root of the bucket.
+	Prefix string `mapstructure:"prefix" required:"false"`
+
+	// The maximum time to wait for the export job. Format: duration string (e.g., "30m", "1h30m").
+	// Default: 1 hour.
+	JobTimeout string `mapstructure:"job_timeout" required:"false"`
+
+	jobTimeout time.Duration
+	ctx        interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "packer.post-processor.powervs-export",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packersdk.MultiError
+	errs = packersdk.MultiErrorAppend(errs, p.config.AccessConfig.Prepare()...)
+	if p.config.COS == nil {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("cos is required"))
+	} else {
+		for _, field := range []struct{ name, value string }{
+			{"bucket", p.config.COS.Bucket},
+			{"region", p.config.COS.Region},
+			{"access_key", p.config.COS.AccessKey},
+			{"secret_key", p.config.COS.SecretKey},
+		} {
+			if field.value == "" {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("cos %s is required", field.name))
+			}
+		}
+	}
+	p.config.Prefix = strings.Trim(p.config.Prefix, "/")
+	p.config.jobTimeout = JobTimeoutDefault
+	if p.config.JobTimeout != "" {
+		p.config.jobTimeout, err = time.ParseDuration(p.config.JobTimeout)
+		if err != nil || p.config.jobTimeout <= 0 {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("invalid job_timeout: %q (use a positive duration, e.g. 1h)", p.config.JobTimeout))
+		}
+	}
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	if err := p.config.ResolveWorkspace(context.Background()); err != nil {
+		return err
+	}
+	packersdk.LogSecretFilter.Set(p.config.APIKey, p.config.COS.AccessKey, p.config.COS.SecretKey)
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, source packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	if source.BuilderId() != powervs.BuilderId {
+		return nil, false, false, fmt.Errorf("unsupported artifact of the builder %s, only the artifacts of the powervs builder are supported", source.BuilderId())
+	}
+	imageID, _ := source.State("image_id").(string)
+	imageName, _ := source.State("image_name").(string)
+	if imageID == "" {
+		return nil, false, false, fmt.Errorf("the artifact has no image in the image catalog, capture it with the destination %q or %q",
+			powervs.CaptureDestinationImageCatalog, powervs.CaptureDestinationBoth)
+	}
+	if workspace, _ := source.State("service_instance_id").(string); workspace != "" && workspace != p.config.ServiceInstanceID {
+		return nil, false, false, fmt.Errorf("the image %s is in the workspace %s, not in %s", imageID, workspace, p.config.ServiceInstanceID)
+	}
+
+	if err := p.config.CheckWorkspaceZone(ctx); err != nil {
+		return nil, false, false, err
+	}
+	imageClient, err := p.config.ImageClient(ctx, p.config.ServiceInstanceID)
+	if err != nil {
+		return nil, false, false, err
+	}
+	jobClient, err := p.config.JobClient(ctx, p.config.ServiceInstanceID)
+	if err != nil {
+		return nil, false, false, err
+	}
+	retrier := p.config.Retrier(ctx)
+
+	// PowerVS writes the image to the folder given after the bucket name.
+	bucketPath := p.config.COS.Bucket
+	if p.config.Prefix != "" {
+		bucketPath += "/" + p.config.Prefix
+	}
+	ui.Say(fmt.Sprintf("Exporting the image %s (%s) to the bucket %s", imageName, imageID, bucketPath))
+	jobRef, err := retrier.ImageClient(imageClient).ExportImage(imageID, &models.ExportImage{
+		AccessKey:  &p.config.COS.AccessKey,
+		SecretKey:  p.config.COS.SecretKey,
+		BucketName: &bucketPath,
+		Region:     p.config.COS.Region,
+	})
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed to export the image: %w", err)
+	}
+	if err := p.waitJob(ctx, ui, retrier.JobClient(jobClient), *jobRef.ID); err != nil {
+		return nil, false, false, err
+	}
+
+	object := path.Join(p.config.Prefix, imageName+powervs.CaptureCOSObjectSuffix)
+	ui.Say(fmt.Sprintf("Image exported to %s/%s", p.config.COS.Bucket, object))
+
+	// The image is kept in the catalog, the artifact now also holds the exported object.
+	artifact := powervs.CopyArtifact(source)
+	artifact.StateData["cos_bucket"] = p.config.COS.Bucket
+	artifact.StateData["cos_region"] = p.config.COS.Region
+	artifact.StateData["cos_object"] = object
+	return artifact, true, false, nil
+}
+
+// waitJob waits for the export job to complete.
+func (p *PostProcessor) waitJob(ctx context.Context, ui packersdk.Ui, jobClient powervscommon.JobClient, id string) error {
+	timeout := time.After(p.config.jobTimeout)
+	for {
+		job, err := jobClient.Get(id)
+		if err != nil {
+			return fmt.Errorf("failed to get the export job: %w", err)
+		}
+		ui.Say(powervs.JobStatus(job))
+		switch *job.Status.State {
+		case "failed":
+			return fmt.Errorf("export job failed: %s", job.Status.Message)
+		case "completed":
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return errors.New("timed out while waiting for the image to be exported")
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package export
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatConfig struct {
+	PackerBuildName     *string                `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType   *string                `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion   *string                `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug         *bool                  `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce         *bool                  `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError       *string                `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars      map[string]string      `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars []string               `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	AuthMethod          *string                `mapstructure:"auth_method" required:"false" cty:"auth_method" hcl:"auth_method"`
+	APIKey              *string                `mapstructure:"api_key" required:"false" cty:"api_key" hcl:"api_key"`
+	CredentialsFile     *string                `mapstructure:"credentials_file" required:"false" cty:"credentials_file" hcl:"credentials_file"`
+	TrustedProfileID    *string                `mapstructure:"trusted_profile_id" required:"false" cty:"trusted_profile_id" hcl:"trusted_profile_id"`
+	TrustedProfileName  *string                `mapstructure:"trusted_profile_name" required:"false" cty:"trusted_profile_name" hcl:"trusted_profile_name"`
+	CRTokenFile         *string                `mapstructure:"cr_token_file" required:"false" cty:"cr_token_file" hcl:"cr_token_file"`
+	Region              *string                `mapstructure:"region" required:"false" cty:"region" hcl:"region"`
+	Zone                *string                `mapstructure:"zone" required:"false" cty:"zone" hcl:"zone"`
+	AccountID           *string                `mapstructure:"account_id" required:"false" cty:"account_id" hcl:"account_id"`
+	Debug               *bool                  `mapstructure:"debug" required:"false" cty:"debug" hcl:"debug"`
+	ServiceInstanceID   *string                `mapstructure:"service_instance_id" required:"false" cty:"service_instance_id" hcl:"service_instance_id"`
+	WorkspaceName       *string                `mapstructure:"workspace_name" required:"false" cty:"workspace_name" hcl:"workspace_name"`
+	Endpoint            *string                `mapstructure:"endpoint" required:"false" cty:"endpoint" hcl:"endpoint"`
+	IAMURL              *string                `mapstructure:"iam_url" required:"false" cty:"iam_url" hcl:"iam_url"`
+	PowerVSEndpoint     *string                `mapstructure:"powervs_endpoint" required:"false" cty:"powervs_endpoint" hcl:"powervs_endpoint"`
+	UsePrivateEndpoints *bool                  `mapstructure:"use_private_endpoints" required:"false" cty:"use_private_endpoints" hcl:"use_private_endpoints"`
+	MaxRetries          *int                   `mapstructure:"max_retries" required:"false" cty:"max_retries" hcl:"max_retries"`
+	COS                 *common.FlatCaptureCOS `mapstructure:"cos" required:"true" cty:"cos" hcl:"cos"`
+	Prefix              *string                `mapstructure:"prefix" required:"false" cty:"prefix" hcl:"prefix"`
+	JobTimeout          *string                `mapstructure:"job_timeout" required:"false" cty:"job_timeout" hcl:"job_timeout"`
+}
+
+// FlatMapstructure returns a new FlatConfig.
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatConfig)
+}
+
+// HCL2Spec returns the hcl spec of a Config.
+// This spec is used by HCL to read the fields of Config.
+// The decoded values from this spec will then be applied to a FlatConfig.
+func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"packer_build_name":          &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":        &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":        &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":               &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":               &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":            &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":      &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables": &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"auth_method":                &hcldec.AttrSpec{Name: "auth_method", Type: cty.String, Required: false},
+		"api_key":                    &hcldec.AttrSpec{Name: "api_key", Type: cty.String, Required: false},
+		"credentials_file":           &hcldec.AttrSpec{Name: "credentials_file", Type: cty.String, Required: false},
+		"trusted_profile_id":         &hcldec.AttrSpec{Name: "trusted_profile_id", Type: cty.String, Required: false},
+		"trusted_profile_name":       &hcldec.AttrSpec{Name: "trusted_profile_name", Type: cty.String, Required: false},
+		"cr_token_file":              &hcldec.AttrSpec{Name: "cr_token_file", Type: cty.String, Required: false},
+		"region":                     &hcldec.AttrSpec{Name: "region", Type: cty.String, Required: false},
+		"zone":                       &hcldec.AttrSpec{Name: "zone", Type: cty.String, Required: false},
+		"account_id":                 &hcldec.AttrSpec{Name: "account_id", Type: cty.String, Required: false},
+		"debug":                      &hcldec.AttrSpec{Name: "debug", Type: cty.Bool, Required: false},
+		"service_instance_id":        &hcldec.AttrSpec{Name: "service_instance_id", Type: cty.String, Required: false},
+		"workspace_name":             &hcldec.AttrSpec{Name: "workspace_name", Type: cty.String, Required: false},
+		"endpoint":                   &hcldec.AttrSpec{Name: "endpoint", Type: cty.String, Required: false},
+		"iam_url":                    &hcldec.AttrSpec{Name: "iam_url", Type: cty.String, Required: false},
+		"powervs_endpoint":           &hcldec.AttrSpec{Name: "powervs_endpoint", Type: cty.String, Required: false},
+		"use_private_endpoints":      &hcldec.AttrSpec{Name: "use_private_endpoints", Type: cty.Bool, Required: false},
+		"max_retries":                &hcldec.AttrSpec{Name: "max_retries", Type: cty.Number, Required: false},
+		"cos":                        &hcldec.BlockSpec{TypeName: "cos", Nested: hcldec.ObjectSpec((*common.FlatCaptureCOS)(nil).HCL2Spec())},
+		"prefix":                     &hcldec.AttrSpec{Name: "prefix", Type: cty.String, Required: false},
+		"job_timeout":                &hcldec.AttrSpec{Name: "job_timeout", Type: cty.String, Required: false},
+	}
+	return s
+}
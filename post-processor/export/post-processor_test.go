@@ -0,0 +1,128 @@
+package export
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/post-processor/internal/pptest"
+)
+
+func TestMain(m *testing.M) {
+	jobPollInterval = time.Millisecond
+	os.Exit(m.Run())
+}
+
+// testConfig exports the image to the bucket of the artifacts.
+func testConfig(server *fake.Server) map[string]interface{} {
+	raw := pptest.Config(server)
+	raw["region"] = pptest.Region
+	cos := raw["cos"].(map[string]interface{})
+	cos["bucket"] = pptest.Bucket
+	cos["region"] = pptest.Region
+	return raw
+}
+
+func testPostProcessor(t *testing.T, raw map[string]interface{}) *PostProcessor {
+	var p PostProcessor
+	pptest.Configure(t, &p, raw)
+	return &p
+}
+
+func TestPostProcessor_Configure(t *testing.T) {
+	server := fake.NewServer(fake.NewBackend())
+	defer server.Close()
+
+	for name, change := range map[string]func(map[string]interface{}){
+		"no cos":          func(raw map[string]interface{}) { delete(raw, "cos") },
+		"no secret key":   func(raw map[string]interface{}) { delete(raw["cos"].(map[string]interface{}), "secret_key") },
+		"invalid timeout": func(raw map[string]interface{}) { raw["job_timeout"] = "soon" },
+	} {
+		raw := testConfig(server)
+		change(raw)
+		var p PostProcessor
+		if err := p.Configure(raw); err == nil {
+			t.Errorf("Configure() with %s succeeded", name)
+		}
+	}
+
+	raw := testConfig(server)
+	raw["prefix"] = "/nightly/centos/"
+	p := testPostProcessor(t, raw)
+	if p.config.Prefix != "nightly/centos" || p.config.jobTimeout != JobTimeoutDefault {
+		t.Errorf("prefix = %q, job timeout = %s", p.config.Prefix, p.config.jobTimeout)
+	}
+}
+
+func TestPostProcessor_PostProcess(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.JobPolls = 2
+	imageID := backend.AddImage(pptest.ImageName, "rhel")
+	server := fake.NewServer(backend)
+	defer server.Close()
+	raw := testConfig(server)
+	raw["prefix"] = "nightly"
+	p := testPostProcessor(t, raw)
+
+	artifact, keep, forceOverride, err := p.PostProcess(context.Background(), packersdk.TestUi(t), pptest.Artifact(powervs.CaptureDestinationImageCatalog, imageID))
+	if err != nil {
+		t.Fatalf("PostProcess() error = %v", err)
+	}
+	if !keep || forceOverride {
+		t.Errorf("PostProcess() keep = %t, force override = %t", keep, forceOverride)
+	}
+
+	export := backend.ImageExport(imageID)
+	if export == nil || *export.BucketName != "images/nightly" || export.Region != "us-south" || *export.AccessKey != "access" || export.SecretKey != "secret" {
+		t.Fatalf("export = %+v, want an export to images/nightly", export)
+	}
+	for key, want := range map[string]string{
+		"image_id":            imageID,
+		"capture_destination": powervs.CaptureDestinationImageCatalog,
+		"cos_bucket":          pptest.Bucket,
+		"cos_region":          pptest.Region,
+		"cos_object":          pptest.Object,
+	} {
+		if got := artifact.State(key); got != want {
+			t.Errorf("artifact state %s = %v, want %s", key, got, want)
+		}
+	}
+	if artifact.Id() != imageID {
+		t.Errorf("artifact ID = %s, want the image %s", artifact.Id(), imageID)
+	}
+}
+
+func TestPostProcessor_PostProcess_JobFailed(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.JobResult = fake.JobStateFailed
+	imageID := backend.AddImage(pptest.ImageName, "rhel")
+	server := fake.NewServer(backend)
+	defer server.Close()
+	p := testPostProcessor(t, testConfig(server))
+
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), pptest.Artifact(powervs.CaptureDestinationImageCatalog, imageID)); err == nil {
+		t.Fatal("PostProcess() succeeded with a failed export job")
+	}
+}
+
+func TestPostProcessor_PostProcess_NoCatalogImage(t *testing.T) {
+	backend := fake.NewBackend()
+	server := fake.NewServer(backend)
+	defer server.Close()
+	p := testPostProcessor(t, testConfig(server))
+
+	source := &powervs.Artifact{StateData: map[string]interface{}{
+		"capture_destination": powervs.CaptureDestinationCloudStorage,
+		"cos_object":          "golden.ova.gz",
+	}}
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), source); err == nil {
+		t.Fatal("PostProcess() succeeded without an image in the image catalog")
+	}
+	if calls := backend.Calls(); len(calls) != 0 {
+		t.Errorf("calls = %v, want none", calls)
+	}
+}
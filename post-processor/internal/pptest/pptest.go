@@ -0,0 +1,164 @@
+// Package pptest holds the test fixtures shared by the post-processors: their configuration for the
+// workspace of the fake PowerVS backend, the artifacts of the powervs builder they post-process and a
+// fake Cloud Object Storage bucket.
+package pptest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+)
+
+// The workspace, bucket and image of the artifacts.
+const (
+	Zone              = "dal10"
+	ServiceInstanceID = "workspace"
+	Bucket            = "images"
+	Region            = "us-south"
+	Object            = "nightly/golden.ova.gz"
+	ImageName         = "golden"
+)
+
+// COS returns the `cos` block of the post-processors with HMAC keys.
+func COS() map[string]interface{} {
+	return map[string]interface{}{"access_key": "access", "secret_key": "secret"}
+}
+
+// Config returns the configuration of a post-processor for the workspace of the artifacts, with the
+// `cos` block of COS. The post-processor calls the fake server, or the clients set by the test when
+// server is nil.
+func Config(server *fake.Server) map[string]interface{} {
+	raw := map[string]interface{}{
+		"api_key":             "api-key",
+		"zone":                Zone,
+		"service_instance_id": ServiceInstanceID,
+		"max_retries":         -1,
+		"cos":                 COS(),
+	}
+	if server != nil {
+		raw["endpoint"] = server.URL
+	}
+	return raw
+}
+
+// Configure configures the post-processor, failing the test on error.
+func Configure(t *testing.T, p packersdk.PostProcessor, raw map[string]interface{}) {
+	t.Helper()
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+}
+
+// Artifact returns the artifact of a build of the workspace captured to destination: the catalog image
+// imageID named ImageName, and the object Object of the bucket Bucket.
+func Artifact(destination, imageID string) *powervs.Artifact {
+	state := map[string]interface{}{
+		"zone":                Zone,
+		"service_instance_id": ServiceInstanceID,
+		"capture_destination": destination,
+	}
+	if destination != powervs.CaptureDestinationCloudStorage {
+		state["image_id"] = imageID
+		state["image_name"] = ImageName
+	}
+	if destination != powervs.CaptureDestinationImageCatalog {
+		state["cos_bucket"] = Bucket
+		state["cos_region"] = Region
+		state["cos_object"] = Object
+	}
+	return &powervs.Artifact{StateData: state}
+}
+
+// COSObject is an object of COSClient.
+type COSObject struct {
+	Data         []byte
+	LastModified time.Time
+}
+
+// COSClient is the bucket Bucket of Cloud Object Storage. Listing the objects has a single page.
+type COSClient struct {
+	mu      sync.Mutex
+	Objects map[string]COSObject
+	// Deleted are the keys of the deleted objects, in the order of their deletion.
+	Deleted []string
+}
+
+var _ common.COSClient = (*COSClient)(nil)
+
+// object returns the object of a request.
+func (c *COSClient) object(bucket, key *string) (COSObject, error) {
+	if aws.StringValue(bucket) != Bucket {
+		return COSObject{}, awserr.New(s3.ErrCodeNoSuchBucket, fmt.Sprintf("no bucket %s", aws.StringValue(bucket)), nil)
+	}
+	object, ok := c.Objects[aws.StringValue(key)]
+	if !ok {
+		return COSObject{}, awserr.New(s3.ErrCodeNoSuchKey, fmt.Sprintf("no object %s", aws.StringValue(key)), nil)
+	}
+	return object, nil
+}
+
+func (c *COSClient) ListObjectsV2PagesWithContext(_ context.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if aws.StringValue(input.Bucket) != Bucket {
+		return awserr.New(s3.ErrCodeNoSuchBucket, fmt.Sprintf("no bucket %s", aws.StringValue(input.Bucket)), nil)
+	}
+	page := &s3.ListObjectsV2Output{}
+	for key, object := range c.Objects {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			page.Contents = append(page.Contents, &s3.Object{Key: aws.String(key), LastModified: aws.Time(object.LastModified)})
+		}
+	}
+	fn(page, true)
+	return nil
+}
+
+func (c *COSClient) DeleteObjectWithContext(_ context.Context, input *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.object(input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	delete(c.Objects, *input.Key)
+	c.Deleted = append(c.Deleted, *input.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (c *COSClient) GetObjectWithContext(_ context.Context, input *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	object, err := c.object(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(object.Data)), LastModified: aws.Time(object.LastModified)}, nil
+}
+
+func (c *COSClient) HeadObjectWithContext(_ context.Context, input *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	object, err := c.object(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.HeadObjectOutput{
+		ETag:          aws.String(fmt.Sprintf("%q", fmt.Sprintf("%x", md5.Sum(object.Data)))),
+		ContentLength: aws.Int64(int64(len(object.Data))),
+		LastModified:  aws.Time(object.LastModified),
+	}, nil
+}
@@ -0,0 +1,247 @@
+//go:generate packer-sdc struct-markdown
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+// Package manifest implements the powervs-manifest post-processor, which records the images built by
+// the powervs builder in a manifest file for the tools consuming them, such as the Kubernetes
+// image-builder and cluster-api-provider-ibmcloud.
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// OutputDefault is the manifest file written when output is not set, the one of the manifest
+// post-processor of Packer.
+const OutputDefault = "packer-manifest.json"
+
+// artifactStateKeys are the artifact state data of the powervs builder copied to the custom data of
+// the manifest entries.
+var artifactStateKeys = []string{
+	"image_id",
+	"image_name",
+	"service_instance_id",
+	"zone",
+	"capture_destination",
+	"cos_bucket",
+	"cos_region",
+	"cos_object",
+}
+
+// secretBuildVars are the generated data of the build left out of the manifest.
+var secretBuildVars = []string{
+	"Password",
+	"SSHPrivateKey",
+	"SSHPrivateKeyFile",
+	"SSHPublicKey",
+	"WinRMPassword",
+}
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The manifest file. The builds are appended to it when it exists. Default
+	// `packer-manifest.json`.
+	Output string `mapstructure:"output" required:"false"`
+
+	// The format of the manifest: `json` or `yaml`. Defaults to `yaml` when the output ends with
+	// `.yaml` or `.yml`, `json` otherwise.
+	Format string `mapstructure:"format" required:"false"`
+
+	// The Kubernetes version installed in the image, recorded as `kubernetes_version`, e.g.
+	// `v1.31.2`.
+	KubernetesVersion string `mapstructure:"kubernetes_version" required:"false"`
+
+	// Additional entries of the custom data of the build, e.g. the build variables of image-builder.
+	// They override the entries of the plugin.
+	CustomData map[string]string `mapstructure:"custom_data" required:"false"`
+
+	ctx interpolate.Context
+}
+
+// Manifest is the content of the manifest file, in the layout of the manifest post-processor of
+// Packer that image-builder reads.
+type Manifest struct {
+	Builds      []Build `json:"builds"`
+	LastRunUUID string  `json:"last_run_uuid"`
+}
+
+// Build is a manifest entry.
+type Build struct {
+	Name          string            `json:"name"`
+	BuilderType   string            `json:"builder_type"`
+	BuildTime     int64             `json:"build_time,omitempty"`
+	Files         []File            `json:"files"`
+	ArtifactID    string            `json:"artifact_id"`
+	PackerRunUUID string            `json:"packer_run_uuid"`
+	CustomData    map[string]string `json:"custom_data"`
+}
+
+// File is a file of an artifact. The powervs builder produces none.
+type File struct {
+	Name string `json:"name"`
+	Size int64  `json:"size,omitempty"`
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "packer.post-processor.powervs-manifest",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.Output == "" {
+		p.config.Output = OutputDefault
+	}
+	if p.config.Format == "" {
+		p.config.Format = FormatJSON
+		if ext := filepath.Ext(p.config.Output); ext == ".yaml" || ext == ".yml" {
+			p.config.Format = FormatYAML
+		}
+	}
+	if p.config.Format != FormatJSON && p.config.Format != FormatYAML {
+		return fmt.Errorf("invalid format: %s (options: %s, %s)", p.config.Format, FormatJSON, FormatYAML)
+	}
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, source packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	if source.BuilderId() != powervs.BuilderId {
+		return nil, false, false, fmt.Errorf("unsupported artifact of the builder %s, only the artifacts of the powervs builder are supported", source.BuilderId())
+	}
+
+	build := p.build(source)
+	ui.Say(fmt.Sprintf("Adding %s to the manifest %s", build.ArtifactID, p.config.Output))
+
+	manifest, err := p.read()
+	if err != nil {
+		return nil, false, false, err
+	}
+	manifest.Builds = append(manifest.Builds, build)
+	manifest.LastRunUUID = build.PackerRunUUID
+	if err := p.write(manifest); err != nil {
+		return nil, false, false, err
+	}
+
+	// The manifest is a side output: the artifact of the build is kept as it is.
+	return source, true, true, nil
+}
+
+// build returns the manifest entry of an artifact.
+func (p *PostProcessor) build(source packersdk.Artifact) Build {
+	customData := map[string]string{}
+	if vars, ok := source.State("generated_data").(map[string]interface{}); ok {
+		for name, value := range vars {
+			value, ok := value.(string)
+			if !ok || value == "" || strings.HasPrefix(value, "ERR_") || slices.Contains(secretBuildVars, name) {
+				continue
+			}
+			customData[name] = value
+		}
+	}
+	for _, key := range artifactStateKeys {
+		if value, ok := source.State(key).(string); ok && value != "" {
+			customData[key] = value
+		}
+	}
+	if p.config.KubernetesVersion != "" {
+		customData["kubernetes_version"] = p.config.KubernetesVersion
+	}
+	for key, value := range p.config.CustomData {
+		customData[key] = value
+	}
+
+	return Build{
+		Name:          p.config.PackerBuildName,
+		BuilderType:   p.config.PackerBuilderType,
+		BuildTime:     time.Now().Unix(),
+		Files:         []File{},
+		ArtifactID:    source.Id(),
+		PackerRunUUID: os.Getenv("PACKER_RUN_UUID"),
+		CustomData:    customData,
+	}
+}
+
+// read reads the manifest file, and returns an empty manifest when there is none.
+func (p *PostProcessor) read() (*Manifest, error) {
+	manifest := &Manifest{}
+	data, err := os.ReadFile(p.config.Output)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest: %w", err)
+	}
+	// YAML is a superset of JSON, the manifest is read the same way in both formats.
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse the manifest %s: %w", p.config.Output, err)
+	}
+	return manifest, nil
+}
+
+// write replaces the manifest file, through a temporary file so that it is never left partially
+// written.
+func (p *PostProcessor) write(manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil && p.config.Format == FormatYAML {
+		data, err = yaml.JSONToYAML(data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode the manifest: %w", err)
+	}
+
+	dir := filepath.Dir(p.config.Output)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create the manifest directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(p.config.Output)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write the manifest: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write the manifest: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write the manifest: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to write the manifest: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p.config.Output); err != nil {
+		return fmt.Errorf("failed to write the manifest: %w", err)
+	}
+	return nil
+}
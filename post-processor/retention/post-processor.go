@@ -0,0 +1,414 @@
+//go:generate packer-sdc struct-markdown
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+// Package retention implements the powervs-retention post-processor, which prunes the catalog images
+// and the Cloud Object Storage objects of earlier builds according to retention rules.
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs"
+	powervscommon "github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+const (
+	ResourceTypeImage  = powervscommon.ResourceTypeImage
+	ResourceTypeObject = "object"
+)
+
+// ProtectTagsDefault are the user tags protecting catalog images when protect_tags is not set.
+var ProtectTagsDefault = []string{"keep"}
+
+type Config struct {
+	common.PackerConfig        `mapstructure:",squash"`
+	powervscommon.AccessConfig `mapstructure:",squash"`
+
+	// The prefix of the names of the catalog images, and of the Cloud Object Storage objects, the
+	// retention rules apply to, e.g. `centos-golden-`. Required.
+	NamePrefix string `mapstructure:"name_prefix" required:"true"`
+
+	// The number of the most recent images kept, and of the most recent objects. At least one of
+	// `keep_last_n` or `keep_days` is required.
+	KeepLastN int `mapstructure:"keep_last_n" required:"false"`
+
+	// The images and objects created less than this number of days ago are kept.
+	KeepDays int `mapstructure:"keep_days" required:"false"`
+
+	// The catalog images carrying one of these user tags are kept, e.g. `release:ga`. Default
+	// `["keep"]`.
+	ProtectTags []string `mapstructure:"protect_tags" required:"false"`
+
+	// Prunes the `.ova.gz` objects of the bucket too, with these HMAC keys. The bucket and region
+	// default to the ones the artifact was exported to.
+	COS *powervscommon.CaptureCOS `mapstructure:"cos" required:"false"`
+
+	// URL of the S3 API of Cloud Object Storage. Defaults to the public or private endpoint of the
+	// bucket region depending on `use_private_endpoints`.
+	COSEndpoint string `mapstructure:"cos_endpoint" required:"false"`
+
+	// Only reports the images and objects the retention rules select, without deleting them.
+	// Default `false`.
+	DryRun bool `mapstructure:"dry_run" required:"false"`
+
+	// A file the report of the images and objects deleted is written to, as JSON.
+	Report string `mapstructure:"report" required:"false"`
+
+	ctx interpolate.Context
+}
+
+// Resource is a catalog image or an object selected by the retention rules.
+type Resource struct {
+	Type    string    `json:"type"`
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created,omitempty"`
+	Error   string    `json:"error,omitempty"`
+
+	crn string
+}
+
+// Report lists the images and objects deleted, or that would be with dry_run.
+type Report struct {
+	DryRun  bool       `json:"dry_run"`
+	Deleted []Resource `json:"deleted"`
+	Failed  []Resource `json:"failed,omitempty"`
+}
+
+type PostProcessor struct {
+	config Config
+
+	// Clients, created from the configuration when not set by tests. The COS client is created for the
+	// bucket of every artifact.
+	imageClient   powervscommon.ImageClient
+	taggingClient powervscommon.TaggingClient
+	cosClient     powervscommon.COSClient
+
+	now func() time.Time
+}
+
+// cosBucket is the Cloud Object Storage bucket the objects of an artifact are pruned in.
+type cosBucket struct {
+	name   string
+	client powervscommon.COSClient
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "packer.post-processor.powervs-retention",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packersdk.MultiError
+	errs = packersdk.MultiErrorAppend(errs, p.config.AccessConfig.Prepare()...)
+	if p.config.NamePrefix == "" {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("name_prefix is required"))
+	}
+	if p.config.KeepLastN < 0 || p.config.KeepDays < 0 {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("keep_last_n and keep_days must not be negative"))
+	}
+	// Never prune every image of the prefix.
+	if p.config.KeepLastN == 0 && p.config.KeepDays == 0 {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("at least one of keep_last_n or keep_days is required"))
+	}
+	if p.config.ProtectTags == nil {
+		p.config.ProtectTags = ProtectTagsDefault
+	}
+	if p.config.COS != nil && (p.config.COS.AccessKey == "" || p.config.COS.SecretKey == "") {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("cos access_key and secret_key are required"))
+	}
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	if err := p.config.ResolveWorkspace(context.Background()); err != nil {
+		return err
+	}
+	packersdk.LogSecretFilter.Set(p.config.APIKey)
+	if p.config.COS != nil {
+		packersdk.LogSecretFilter.Set(p.config.COS.AccessKey, p.config.COS.SecretKey)
+	}
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, source packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	if source.BuilderId() != powervs.BuilderId {
+		return nil, false, false, fmt.Errorf("unsupported artifact of the builder %s, only the artifacts of the powervs builder are supported", source.BuilderId())
+	}
+	if err := p.config.CheckWorkspaceZone(ctx); err != nil {
+		return nil, false, false, err
+	}
+	if err := p.clients(ctx); err != nil {
+		return nil, false, false, err
+	}
+	bucket, err := p.bucket(source)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	ui.Say(fmt.Sprintf("Applying the retention rules to the images named %s*", p.config.NamePrefix))
+	// The artifact of the build is never pruned.
+	current := []string{stateString(source, "image_id"), stateString(source, "cos_object")}
+
+	selected, err := p.selectImages(ctx, current)
+	if err != nil {
+		return nil, false, false, err
+	}
+	if bucket != nil {
+		objects, err := p.selectObjects(ctx, bucket, current)
+		if err != nil {
+			return nil, false, false, err
+		}
+		selected = append(selected, objects...)
+	}
+
+	report := p.prune(ctx, ui, bucket, selected)
+	if p.config.Report != "" {
+		if err := writeReport(p.config.Report, report); err != nil {
+			return nil, false, false, err
+		}
+	}
+	if len(report.Failed) != 0 {
+		return nil, false, false, fmt.Errorf("failed to delete %d of %d images and objects", len(report.Failed), len(selected))
+	}
+	return source, true, true, nil
+}
+
+// clients creates the PowerVS clients not set yet.
+func (p *PostProcessor) clients(ctx context.Context) error {
+	if p.now == nil {
+		p.now = time.Now
+	}
+	if p.imageClient == nil {
+		imageClient, err := p.config.ImageClient(ctx, p.config.ServiceInstanceID)
+		if err != nil {
+			return err
+		}
+		p.imageClient = imageClient
+	}
+	if p.taggingClient == nil {
+		taggingClient, err := p.config.TaggingClient()
+		if err != nil {
+			return err
+		}
+		p.taggingClient = taggingClient
+	}
+	return nil
+}
+
+// bucket returns the bucket of the cos block, else the one the artifact was exported to, and nil
+// without a cos block.
+func (p *PostProcessor) bucket(source packersdk.Artifact) (*cosBucket, error) {
+	if p.config.COS == nil {
+		return nil, nil
+	}
+	cos := *p.config.COS
+	if cos.Bucket == "" {
+		cos.Bucket = stateString(source, "cos_bucket")
+	}
+	if cos.Region == "" {
+		cos.Region = stateString(source, "cos_region")
+	}
+	if cos.Bucket == "" || cos.Region == "" {
+		return nil, errors.New("cos bucket and region are required when the artifact was not exported to Cloud Object Storage")
+	}
+	if p.cosClient != nil {
+		return &cosBucket{name: cos.Bucket, client: p.cosClient}, nil
+	}
+	endpoint := p.config.COSEndpoint
+	if endpoint == "" {
+		endpoint = powervscommon.COSEndpoint(cos.Region, p.config.UsePrivateEndpoints)
+	}
+	client, err := powervscommon.NewCOSClient(&cos, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &cosBucket{name: cos.Bucket, client: client}, nil
+}
+
+// selectImages returns the catalog images of the prefix the retention rules do not keep.
+func (p *PostProcessor) selectImages(ctx context.Context, current []string) ([]Resource, error) {
+	images, err := p.imageClient.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	var candidates []Resource
+	for _, image := range images.Images {
+		if image.Name == nil || !strings.HasPrefix(*image.Name, p.config.NamePrefix) {
+			continue
+		}
+		r := Resource{Type: ResourceTypeImage, ID: *image.ImageID, Name: *image.Name, crn: string(image.Crn)}
+		if image.CreationDate != nil {
+			r.Created = time.Time(*image.CreationDate)
+		}
+		candidates = append(candidates, r)
+	}
+
+	var selected []Resource
+	for _, r := range p.expired(candidates, current) {
+		protected, err := p.protected(ctx, r.crn)
+		if err != nil {
+			return nil, err
+		}
+		if !protected {
+			selected = append(selected, r)
+		}
+	}
+	return selected, nil
+}
+
+// selectObjects returns the exported images of the prefix in the bucket the retention rules do not keep.
+func (p *PostProcessor) selectObjects(ctx context.Context, bucket *cosBucket, current []string) ([]Resource, error) {
+	var candidates []Resource
+	err := bucket.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket.name),
+		Prefix: aws.String(p.config.NamePrefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+			if !strings.HasSuffix(key, powervs.CaptureCOSObjectSuffix) {
+				continue
+			}
+			candidates = append(candidates, Resource{Type: ResourceTypeObject, ID: key, Name: key, Created: aws.TimeValue(object.LastModified)})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the objects of the bucket %s: %w", bucket.name, err)
+	}
+	return p.expired(candidates, current), nil
+}
+
+// expired returns the resources that are neither among the keep_last_n most recent ones, nor younger
+// than keep_days, nor current, the oldest first. Resources without a creation date are kept.
+func (p *PostProcessor) expired(resources []Resource, current []string) []Resource {
+	resources = slices.Clone(resources)
+	// The most recent first.
+	slices.SortFunc(resources, func(a, b Resource) int {
+		return b.Created.Compare(a.Created)
+	})
+	cutoff := p.now().AddDate(0, 0, -p.config.KeepDays)
+
+	var expired []Resource
+	for i, r := range resources {
+		switch {
+		case i < p.config.KeepLastN, slices.Contains(current, r.ID), r.Created.IsZero():
+		case p.config.KeepDays > 0 && r.Created.After(cutoff):
+		default:
+			expired = append(expired, r)
+		}
+	}
+	slices.Reverse(expired)
+	return expired
+}
+
+// protected reports whether the resource carries one of the protect_tags.
+func (p *PostProcessor) protected(ctx context.Context, crn string) (bool, error) {
+	if len(p.config.ProtectTags) == 0 {
+		return false, nil
+	}
+	if crn == "" {
+		// The tags cannot be checked, the image is kept.
+		return true, nil
+	}
+	list, _, err := p.taggingClient.ListTagsWithContext(ctx, &globaltaggingv1.ListTagsOptions{
+		AttachedTo: core.StringPtr(crn),
+		TagType:    core.StringPtr(globaltaggingv1.ListTagsOptionsTagTypeUserConst),
+		Providers:  []string{globaltaggingv1.ListTagsOptionsProvidersGhostConst},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list tags of %s: %w", crn, err)
+	}
+	for _, tag := range list.Items {
+		if tag.Name != nil && slices.Contains(p.config.ProtectTags, *tag.Name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// prune deletes the selected resources, unless dry_run is set, and reports them.
+func (p *PostProcessor) prune(ctx context.Context, ui packersdk.Ui, bucket *cosBucket, selected []Resource) *Report {
+	report := &Report{DryRun: p.config.DryRun, Deleted: []Resource{}}
+	if len(selected) == 0 {
+		ui.Say("No image or object to prune")
+		return report
+	}
+	for _, r := range selected {
+		if p.config.DryRun {
+			ui.Say(fmt.Sprintf("Would delete %s %s (%s), created %s", r.Type, r.Name, r.ID, r.Created.Format(time.RFC3339)))
+			report.Deleted = append(report.Deleted, r)
+			continue
+		}
+		ui.Say(fmt.Sprintf("Deleting %s %s (%s), created %s", r.Type, r.Name, r.ID, r.Created.Format(time.RFC3339)))
+		if err := p.delete(ctx, bucket, r); err != nil {
+			ui.Error(fmt.Sprintf("failed to delete %s %s: %v", r.Type, r.ID, err))
+			r.Error = err.Error()
+			report.Failed = append(report.Failed, r)
+			continue
+		}
+		report.Deleted = append(report.Deleted, r)
+	}
+	if p.config.DryRun {
+		ui.Say(fmt.Sprintf("Found %d images and objects to prune, dry_run is set: nothing deleted", len(report.Deleted)))
+	} else {
+		ui.Say(fmt.Sprintf("Deleted %d images and objects", len(report.Deleted)))
+	}
+	return report
+}
+
+func (p *PostProcessor) delete(ctx context.Context, bucket *cosBucket, r Resource) error {
+	if r.Type == ResourceTypeObject {
+		_, err := bucket.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket.name),
+			Key:    aws.String(r.ID),
+		})
+		return err
+	}
+	return p.imageClient.Delete(r.ID)
+}
+
+func writeReport(path string, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the retention report: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create the retention report directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write the retention report: %w", err)
+	}
+	return nil
+}
+
+func stateString(source packersdk.Artifact, name string) string {
+	s, _ := source.State(name).(string)
+	return s
+}
@@ -0,0 +1,203 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/fake"
+	"github.com/ppc64le-cloud/packer-plugin-powervs/post-processor/internal/pptest"
+)
+
+var testNow = time.Date(2026, 10, 19, 6, 0, 0, 0, time.UTC)
+
+// testPostProcessor keeps the images named golden-<n> of the workspace, and the objects of the bucket
+// when raw has a cos block.
+func testPostProcessor(t *testing.T, backend *fake.Backend, raw map[string]interface{}) *PostProcessor {
+	server := fake.NewServer(backend)
+	t.Cleanup(server.Close)
+	config := pptest.Config(server)
+	delete(config, "cos")
+	maps.Copy(config, raw)
+	config["name_prefix"] = "golden-"
+	var p PostProcessor
+	pptest.Configure(t, &p, config)
+	p.imageClient = backend.ImageClient()
+	p.taggingClient = backend.TaggingClient()
+	p.now = func() time.Time { return testNow }
+	return &p
+}
+
+// addImage adds a catalog image created days ago.
+func addImage(backend *fake.Backend, name string, days int) string {
+	id := backend.AddImage(name, "rhel")
+	backend.SetImageCreationDate(id, testNow.AddDate(0, 0, -days))
+	return id
+}
+
+// testArtifact returns the artifact of the build of golden-5.
+func testArtifact(imageID string) *powervs.Artifact {
+	artifact := pptest.Artifact(powervs.CaptureDestinationBoth, imageID)
+	artifact.StateData["cos_object"] = "golden-5.ova.gz"
+	return artifact
+}
+
+func TestPostProcessor_Configure(t *testing.T) {
+	for name, raw := range map[string]map[string]interface{}{
+		"no rule":       {"api_key": "api-key", "zone": "dal10", "service_instance_id": "workspace", "name_prefix": "golden-"},
+		"no prefix":     {"api_key": "api-key", "zone": "dal10", "service_instance_id": "workspace", "keep_last_n": 3},
+		"negative rule": {"api_key": "api-key", "zone": "dal10", "service_instance_id": "workspace", "name_prefix": "golden-", "keep_days": -1},
+		"no cos keys":   {"api_key": "api-key", "zone": "dal10", "service_instance_id": "workspace", "name_prefix": "golden-", "keep_last_n": 3, "cos": map[string]interface{}{"bucket": "images"}},
+	} {
+		var p PostProcessor
+		if err := p.Configure(raw); err == nil {
+			t.Errorf("Configure() with %s succeeded", name)
+		}
+	}
+
+	p := testPostProcessor(t, fake.NewBackend(), map[string]interface{}{"keep_last_n": 3})
+	if !reflect.DeepEqual(p.config.ProtectTags, ProtectTagsDefault) {
+		t.Errorf("protect_tags = %v, want %v", p.config.ProtectTags, ProtectTagsDefault)
+	}
+}
+
+func TestPostProcessor_PostProcess(t *testing.T) {
+	backend := fake.NewBackend()
+	oldest := addImage(backend, "golden-1", 40)
+	protected := addImage(backend, "golden-2", 35)
+	old := addImage(backend, "golden-3", 30)
+	recent := addImage(backend, "golden-4", 3)
+	current := addImage(backend, "golden-5", 0)
+	other := addImage(backend, "other-1", 50)
+	image, _ := backend.Image(protected)
+	if _, _, err := backend.TaggingClient().AttachTagWithContext(context.Background(), &globaltaggingv1.AttachTagOptions{
+		Resources: []globaltaggingv1.Resource{{ResourceID: core.StringPtr(string(image.Crn))}},
+		TagNames:  []string{"keep"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	report := filepath.Join(t.TempDir(), "retention.json")
+	p := testPostProcessor(t, backend, map[string]interface{}{
+		"keep_last_n": 1,
+		"keep_days":   7,
+		"report":      report,
+		"cos":         pptest.COS(),
+	})
+	cos := &pptest.COSClient{Objects: map[string]pptest.COSObject{
+		"golden-1.ova.gz":  {LastModified: testNow.AddDate(0, 0, -40)},
+		"golden-3.ova.gz":  {LastModified: testNow.AddDate(0, 0, -30)},
+		"golden-3.txt":     {LastModified: testNow.AddDate(0, 0, -30)},
+		"golden-4.ova.gz":  {LastModified: testNow.AddDate(0, 0, -3)},
+		"golden-5.ova.gz":  {LastModified: testNow},
+		"other-1.ova.gz":   {LastModified: testNow.AddDate(0, 0, -50)},
+		"golden-2.ova.gz":  {LastModified: testNow.AddDate(0, 0, -35)},
+		"golden-10.ova.gz": {LastModified: testNow.AddDate(0, 0, -10)},
+	}}
+	p.cosClient = cos
+
+	source := testArtifact(current)
+	artifact, keep, forceOverride, err := p.PostProcess(context.Background(), packersdk.TestUi(t), source)
+	if err != nil {
+		t.Fatalf("PostProcess() error = %v", err)
+	}
+	if artifact != source || !keep || !forceOverride {
+		t.Errorf("PostProcess() = %v, %t, %t, want the source artifact kept", artifact, keep, forceOverride)
+	}
+
+	var remaining []string
+	for _, id := range backend.ImageIDs() {
+		if _, err := backend.ImageClient().Get(id); err == nil {
+			remaining = append(remaining, id)
+		}
+	}
+	want := []string{protected, recent, current, other}
+	slices.Sort(want)
+	if !reflect.DeepEqual(remaining, want) {
+		t.Errorf("images = %v, want %v with %s and %s deleted", remaining, want, oldest, old)
+	}
+	slices.Sort(cos.Deleted)
+	if want := []string{"golden-1.ova.gz", "golden-10.ova.gz", "golden-2.ova.gz", "golden-3.ova.gz"}; !reflect.DeepEqual(cos.Deleted, want) {
+		t.Errorf("deleted objects = %v, want %v", cos.Deleted, want)
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.DryRun || len(r.Deleted) != 6 || len(r.Failed) != 0 {
+		t.Errorf("report = %+v, want 6 deletions", r)
+	}
+}
+
+func TestPostProcessor_PostProcess_Buckets(t *testing.T) {
+	backend := fake.NewBackend()
+	current := addImage(backend, "golden-5", 0)
+	p := testPostProcessor(t, backend, map[string]interface{}{"keep_last_n": 1, "cos": pptest.COS()})
+	p.cosClient = &pptest.COSClient{Objects: map[string]pptest.COSObject{"golden-5.ova.gz": {LastModified: testNow}}}
+
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), testArtifact(current)); err != nil {
+		t.Fatalf("PostProcess() error = %v", err)
+	}
+	// The bucket of the first artifact is not the one of the next.
+	other := testArtifact(current)
+	other.StateData["cos_bucket"] = "other"
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), other); err == nil || !strings.Contains(err.Error(), "other") {
+		t.Errorf("PostProcess() error = %v, want the objects of the bucket other listed", err)
+	}
+	if p.config.COS.Bucket != "" || p.config.COS.Region != "" {
+		t.Errorf("cos = %+v, want the configuration unchanged", p.config.COS)
+	}
+}
+
+func TestPostProcessor_PostProcess_DryRun(t *testing.T) {
+	backend := fake.NewBackend()
+	addImage(backend, "golden-1", 40)
+	current := addImage(backend, "golden-2", 0)
+
+	report := filepath.Join(t.TempDir(), "retention.json")
+	p := testPostProcessor(t, backend, map[string]interface{}{"keep_last_n": 1, "dry_run": true, "report": report})
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), testArtifact(current)); err != nil {
+		t.Fatalf("PostProcess() error = %v", err)
+	}
+
+	for _, id := range backend.ImageIDs() {
+		if _, err := backend.ImageClient().Get(id); err != nil {
+			t.Errorf("image %s deleted with dry_run", id)
+		}
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	if !r.DryRun || len(r.Deleted) != 1 || r.Deleted[0].Name != "golden-1" {
+		t.Errorf("report = %+v, want golden-1 reported", r)
+	}
+}
+
+func TestPostProcessor_PostProcess_OtherBuilder(t *testing.T) {
+	p := testPostProcessor(t, fake.NewBackend(), map[string]interface{}{"keep_last_n": 1})
+	source := &packersdk.MockArtifact{BuilderIdValue: "packer.builder.null"}
+	if _, _, _, err := p.PostProcess(context.Background(), packersdk.TestUi(t), source); err == nil {
+		t.Fatal("PostProcess() succeeded with the artifact of another builder")
+	}
+}
@@ -1,16 +1,108 @@
+//go:generate packer-sdc struct-markdown
 //go:generate packer-sdc mapstructure-to-hcl2 -type Config
 
 package powervs
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
 	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	powervscommon "github.com/ppc64le-cloud/packer-plugin-powervs/builder/powervs/common"
+)
+
+const (
+	// TaskRSCT installs the RSCT packages and starts RMC, which the HMC and PowerVS need for DLPAR.
+	TaskRSCT = "rsct"
+	// TaskCloudInit installs cloud-init and restricts it to the datasources PowerVS provides.
+	TaskCloudInit = "cloud-init"
+	// TaskMultipath installs and enables multipath for the VIOS-backed disks.
+	TaskMultipath = "multipath"
+	// TaskIBMVETH tunes the ibmveth virtual ethernet driver.
+	TaskIBMVETH = "ibmveth"
+)
+
+// TasksDefault is the ordered list of tasks run when tasks is not set.
+var TasksDefault = []string{
+	TaskRSCT,
+	TaskCloudInit,
+	TaskMultipath,
+	TaskIBMVETH,
+}
+
+const (
+	// ToolsRepoRPMDefault installs the IBM Power Tools repository, which holds the RSCT packages, on
+	// RHEL and SLES.
+	ToolsRepoRPMDefault = "https://public.dhe.ibm.com/software/server/POWER/Linux/yum/download/ibm-power-repo-latest.noarch.rpm"
+
+	// MultipathConfigDefault is the multipath configuration of the disks PowerVS attaches: virtual
+	// SCSI disks served by the VIOS, and FlashSystem volumes reached through NPIV.
+	MultipathConfigDefault = `devices {
+    device {
+        vendor "AIX"
+        product "VDASD"
+        path_grouping_policy "failover"
+        path_checker "tur"
+        failback "immediate"
+        no_path_retry 60
+    }
+    device {
+        vendor "IBM"
+        product "2145"
+        path_grouping_policy "group_by_prio"
+        prio "alua"
+        path_checker "tur"
+        failback "immediate"
+        no_path_retry "queue"
+    }
+}
+`
 )
 
+// CloudInitDatasourcesDefault are the cloud-init datasources of PowerVS instances: the user data
+// comes on a config drive.
+var CloudInitDatasourcesDefault = []string{"ConfigDrive", "NoCloud", "None"}
+
 type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The guest configuration tasks to run, in order. Default: all of `rsct`, `cloud-init`,
+	// `multipath` and `ibmveth`. Every task checks the state of the guest first and only changes
+	// what differs, so that the provisioner can be run again on the same guest.
+	Tasks []string `mapstructure:"tasks" required:"false"`
+
+	// Run the tasks with `sudo`. Defaults to `true` unless the communicator user is `root`.
+	UseSudo config.Trilean `mapstructure:"use_sudo" required:"false"`
+
+	// URL of the RPM installing the IBM Power Tools repository the RSCT packages are installed
+	// from on RHEL and SLES. Defaults to the latest `ibm-power-repo` package of IBM.
+	ToolsRepoRPM string `mapstructure:"tools_repo_rpm" required:"false"`
+
+	// APT source line of a repository holding the RSCT packages on Ubuntu, e.g.
+	// `deb [trusted=yes] https://mirror.example.com/ibm-power-tools ./`. When not set, the packages
+	// must be available from the sources already configured in the guest.
+	ToolsAptRepository string `mapstructure:"tools_apt_repository" required:"false"`
+
+	// The cloud-init datasources, in order. Default `["ConfigDrive", "NoCloud", "None"]`.
+	CloudInitDatasources []string `mapstructure:"cloud_init_datasources" required:"false"`
+
+	// Content of the multipath configuration written to `/etc/multipath/conf.d/powervs.conf`.
+	// Defaults to device sections for the VIOS virtual SCSI disks and the FlashSystem volumes.
+	MultipathConfig string `mapstructure:"multipath_config" required:"false"`
+
+	// Options of the ibmveth kernel module, written to `/etc/modprobe.d/ibmveth.conf`, e.g.
+	// `rx_copybreak=256`. The large send and receive offloads of the ibmveth interfaces are
+	// enabled in any case.
+	IBMVETHModuleOptions string `mapstructure:"ibmveth_module_options" required:"false"`
+
 	ctx interpolate.Context
 }
 
@@ -24,7 +116,7 @@ func (p *Provisioner) ConfigSpec() hcldec.ObjectSpec {
 
 func (p *Provisioner) Prepare(raws ...interface{}) error {
 	err := config.Decode(&p.config, &config.DecodeOpts{
-		PluginType:         "packer.provisioner.scaffolding",
+		PluginType:         "packer.provisioner.powervs",
 		Interpolate:        true,
 		InterpolateContext: &p.config.ctx,
 		InterpolateFilter: &interpolate.RenderFilter{
@@ -34,9 +126,85 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 	if err != nil {
 		return err
 	}
+
+	var errs *packer.MultiError
+	if len(p.config.Tasks) == 0 {
+		p.config.Tasks = TasksDefault
+	}
+	for _, task := range p.config.Tasks {
+		if !slices.Contains(TasksDefault, task) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid tasks entry: %s (options: %s)", task, strings.Join(TasksDefault, ", ")))
+		}
+	}
+	if p.config.ToolsRepoRPM == "" {
+		p.config.ToolsRepoRPM = ToolsRepoRPMDefault
+	}
+	if len(p.config.CloudInitDatasources) == 0 {
+		p.config.CloudInitDatasources = CloudInitDatasourcesDefault
+	}
+	if p.config.MultipathConfig == "" {
+		p.config.MultipathConfig = MultipathConfigDefault
+	}
+	// The options are quoted in the task scripts.
+	for _, option := range []struct{ name, value string }{
+		{"tools_repo_rpm", p.config.ToolsRepoRPM},
+		{"tools_apt_repository", p.config.ToolsAptRepository},
+		{"ibmveth_module_options", p.config.IBMVETHModuleOptions},
+	} {
+		if strings.ContainsAny(option.value, "'\n") {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("%s can not contain quotes or line breaks: %q", option.name, option.value))
+		}
+	}
+	if strings.Contains(p.config.MultipathConfig, "POWERVS_EOF") {
+		errs = packer.MultiErrorAppend(errs, errors.New("multipath_config can not contain POWERVS_EOF"))
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
 	return nil
 }
 
-func (p *Provisioner) Provision(_ context.Context, ui packer.Ui, _ packer.Communicator, generatedData map[string]interface{}) error {
+func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator, generatedData map[string]interface{}) error {
+	ui.Say("Configuring the guest for PowerVS")
+
+	var stdout bytes.Buffer
+	cmd := &packer.RemoteCmd{Command: "cat /etc/os-release", Stdout: &stdout}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return fmt.Errorf("failed to read /etc/os-release: %w", err)
+	}
+	if cmd.ExitStatus() != 0 {
+		return fmt.Errorf("failed to read /etc/os-release: exit status %d", cmd.ExitStatus())
+	}
+	distro, err := powervscommon.DetectDistro(stdout.String())
+	if err != nil {
+		return err
+	}
+	ui.Say(fmt.Sprintf("Detected distro family: %s", distro))
+
+	useSudo := p.config.UseSudo.True()
+	if p.config.UseSudo == config.TriUnset {
+		user, _ := generatedData["User"].(string)
+		useSudo = user != "root"
+	}
+	command := "sh -s"
+	if useSudo {
+		command = "sudo -n sh -s"
+	}
+
+	for _, task := range p.config.Tasks {
+		script, err := p.taskScript(task, distro)
+		if err != nil {
+			return err
+		}
+		ui.Say(fmt.Sprintf("Running task %s", task))
+		cmd := &packer.RemoteCmd{Command: command, Stdin: strings.NewReader(script)}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			return fmt.Errorf("failed to run task %s: %w", task, err)
+		}
+		if cmd.ExitStatus() != 0 {
+			return fmt.Errorf("task %s exited with status %d", task, cmd.ExitStatus())
+		}
+	}
 	return nil
 }
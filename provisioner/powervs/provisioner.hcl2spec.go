@@ -4,11 +4,27 @@ package powervs
 
 import (
 	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
 )
 
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
+	PackerBuildName      *string           `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType    *string           `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion    *string           `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug          *bool             `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce          *bool             `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError        *string           `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars       map[string]string `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars  []string          `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	Tasks                []string          `mapstructure:"tasks" required:"false" cty:"tasks" hcl:"tasks"`
+	UseSudo              *bool             `mapstructure:"use_sudo" required:"false" cty:"use_sudo" hcl:"use_sudo"`
+	ToolsRepoRPM         *string           `mapstructure:"tools_repo_rpm" required:"false" cty:"tools_repo_rpm" hcl:"tools_repo_rpm"`
+	ToolsAptRepository   *string           `mapstructure:"tools_apt_repository" required:"false" cty:"tools_apt_repository" hcl:"tools_apt_repository"`
+	CloudInitDatasources []string          `mapstructure:"cloud_init_datasources" required:"false" cty:"cloud_init_datasources" hcl:"cloud_init_datasources"`
+	MultipathConfig      *string           `mapstructure:"multipath_config" required:"false" cty:"multipath_config" hcl:"multipath_config"`
+	IBMVETHModuleOptions *string           `mapstructure:"ibmveth_module_options" required:"false" cty:"ibmveth_module_options" hcl:"ibmveth_module_options"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -22,6 +38,22 @@ func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec }
 // This spec is used by HCL to read the fields of Config.
 // The decoded values from this spec will then be applied to a FlatConfig.
 func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
-	s := map[string]hcldec.Spec{}
+	s := map[string]hcldec.Spec{
+		"packer_build_name":          &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":        &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":        &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":               &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":               &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":            &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":      &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables": &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"tasks":                      &hcldec.AttrSpec{Name: "tasks", Type: cty.List(cty.String), Required: false},
+		"use_sudo":                   &hcldec.AttrSpec{Name: "use_sudo", Type: cty.Bool, Required: false},
+		"tools_repo_rpm":             &hcldec.AttrSpec{Name: "tools_repo_rpm", Type: cty.String, Required: false},
+		"tools_apt_repository":       &hcldec.AttrSpec{Name: "tools_apt_repository", Type: cty.String, Required: false},
+		"cloud_init_datasources":     &hcldec.AttrSpec{Name: "cloud_init_datasources", Type: cty.List(cty.String), Required: false},
+		"multipath_config":           &hcldec.AttrSpec{Name: "multipath_config", Type: cty.String, Required: false},
+		"ibmveth_module_options":     &hcldec.AttrSpec{Name: "ibmveth_module_options", Type: cty.String, Required: false},
+	}
 	return s
 }
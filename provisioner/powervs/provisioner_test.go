@@ -0,0 +1,138 @@
+package powervs
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// recordingCommunicator records the commands run on the guest with their input. It answers the
+// os-release read with osRelease, and the commands reading a script with exitStatus.
+type recordingCommunicator struct {
+	packersdk.MockCommunicator
+
+	osRelease  string
+	exitStatus int
+	commands   []string
+	scripts    []string
+}
+
+func (c *recordingCommunicator) Start(ctx context.Context, rc *packersdk.RemoteCmd) error {
+	c.commands = append(c.commands, rc.Command)
+	if rc.Stdin != nil {
+		script, err := io.ReadAll(rc.Stdin)
+		if err != nil {
+			return err
+		}
+		c.scripts = append(c.scripts, string(script))
+		rc.SetExited(c.exitStatus)
+		return nil
+	}
+	if rc.Stdout != nil {
+		io.WriteString(rc.Stdout, c.osRelease)
+	}
+	rc.SetExited(0)
+	return nil
+}
+
+func testProvisioner(t *testing.T, raw map[string]interface{}) *Provisioner {
+	var p Provisioner
+	if err := p.Prepare(raw); err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	return &p
+}
+
+func TestProvisioner_Prepare(t *testing.T) {
+	p := testProvisioner(t, map[string]interface{}{})
+	if !reflect.DeepEqual(p.config.Tasks, TasksDefault) {
+		t.Errorf("tasks = %v, want %v", p.config.Tasks, TasksDefault)
+	}
+	if p.config.ToolsRepoRPM != ToolsRepoRPMDefault {
+		t.Errorf("tools_repo_rpm = %q, want the default", p.config.ToolsRepoRPM)
+	}
+	if p.config.MultipathConfig != MultipathConfigDefault {
+		t.Errorf("multipath_config = %q, want the default", p.config.MultipathConfig)
+	}
+
+	invalid := []map[string]interface{}{
+		{"tasks": []string{"rsct", "kdump"}},
+		{"ibmveth_module_options": "rx_copybreak=256'; reboot '"},
+		{"tools_apt_repository": "deb https://mirror.example.com/tools ./\ndeb https://other.example.com ./"},
+		{"multipath_config": "blacklist {}\nPOWERVS_EOF\nreboot"},
+	}
+	for _, raw := range invalid {
+		var p Provisioner
+		if err := p.Prepare(raw); err == nil {
+			t.Errorf("Prepare(%v) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestProvisioner_Provision(t *testing.T) {
+	p := testProvisioner(t, map[string]interface{}{
+		"tasks":                  []string{TaskCloudInit, TaskIBMVETH},
+		"ibmveth_module_options": "rx_copybreak=256",
+	})
+	comm := &recordingCommunicator{osRelease: "ID=\"rhel\"\nVERSION_ID=\"9.4\"\n"}
+
+	err := p.Provision(context.Background(), packersdk.TestUi(t), comm, map[string]interface{}{"User": "cloud-user"})
+	if err != nil {
+		t.Fatalf("Provision() error = %v", err)
+	}
+	want := []string{"cat /etc/os-release", "sudo -n sh -s", "sudo -n sh -s"}
+	if !reflect.DeepEqual(comm.commands, want) {
+		t.Errorf("commands = %q, want %q", comm.commands, want)
+	}
+	if len(comm.scripts) != 2 {
+		t.Fatalf("scripts = %d, want 2", len(comm.scripts))
+	}
+	if script := comm.scripts[0]; !strings.Contains(script, "datasource_list: [ ConfigDrive, NoCloud, None ]") {
+		t.Errorf("cloud-init script does not set the datasources:\n%s", script)
+	}
+	if script := comm.scripts[1]; !strings.Contains(script, "options ibmveth rx_copybreak=256") || !strings.Contains(script, `case "rhel" in`) {
+		t.Errorf("ibmveth script does not set the module options for rhel:\n%s", script)
+	}
+}
+
+func TestProvisioner_Provision_Root(t *testing.T) {
+	p := testProvisioner(t, map[string]interface{}{"tasks": []string{TaskMultipath}})
+	comm := &recordingCommunicator{osRelease: "ID=ubuntu\n"}
+
+	err := p.Provision(context.Background(), packersdk.TestUi(t), comm, map[string]interface{}{"User": "root"})
+	if err != nil {
+		t.Fatalf("Provision() error = %v", err)
+	}
+	if got := comm.commands[len(comm.commands)-1]; got != "sh -s" {
+		t.Errorf("task command = %q, want it without sudo", got)
+	}
+}
+
+func TestProvisioner_Provision_UnknownDistro(t *testing.T) {
+	p := testProvisioner(t, map[string]interface{}{})
+	comm := &recordingCommunicator{osRelease: "ID=alpine\n"}
+
+	if err := p.Provision(context.Background(), packersdk.TestUi(t), comm, nil); err == nil {
+		t.Fatal("Provision() succeeded, want an unsupported distro error")
+	}
+	if len(comm.scripts) != 0 {
+		t.Errorf("ran %d tasks, want none", len(comm.scripts))
+	}
+}
+
+func TestProvisioner_Provision_TaskFailed(t *testing.T) {
+	p := testProvisioner(t, map[string]interface{}{})
+	comm := &recordingCommunicator{osRelease: "ID=sles\n", exitStatus: 1}
+
+	err := p.Provision(context.Background(), packersdk.TestUi(t), comm, nil)
+	if err == nil || !strings.Contains(err.Error(), "task rsct exited with status 1") {
+		t.Fatalf("Provision() error = %v, want the rsct task to fail", err)
+	}
+	if len(comm.scripts) != 1 {
+		t.Errorf("ran %d tasks, want the build to stop at the first failure", len(comm.scripts))
+	}
+}
@@ -0,0 +1,199 @@
+package powervs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// scriptPrelude defines the helpers of the task scripts. The scripts run with `sh -s`, so they
+// must stick to POSIX sh.
+const scriptPrelude = `set -e
+export DEBIAN_FRONTEND=noninteractive
+
+# missing_packages prints the packages of its arguments that are not installed.
+missing_packages() {
+  for pkg in "$@"; do
+    case "{{.Distro}}" in
+      ubuntu) dpkg -s "$pkg" >/dev/null 2>&1 || echo "$pkg" ;;
+      *) rpm -q "$pkg" >/dev/null 2>&1 || echo "$pkg" ;;
+    esac
+  done
+}
+
+# install installs the packages of its arguments that are not installed yet.
+install() {
+  missing=$(missing_packages "$@")
+  if [ -z "$missing" ]; then
+    echo "Already installed: $*"
+    return 0
+  fi
+  echo "Installing:" $missing
+  case "{{.Distro}}" in
+    rhel)
+      if command -v dnf >/dev/null 2>&1; then dnf install -y $missing; else yum install -y $missing; fi ;;
+    sles) zypper --non-interactive install $missing ;;
+    ubuntu) apt-get update -q && apt-get install -y -q $missing ;;
+  esac
+}
+
+# write_file writes its input to the file of its argument when the content differs, and fails
+# when the file is already up to date.
+write_file() {
+  tmp=$(mktemp)
+  cat > "$tmp"
+  if [ -f "$1" ] && [ "$(cat "$1")" = "$(cat "$tmp")" ]; then
+    rm -f "$tmp"
+    echo "$1 is up to date"
+    return 1
+  fi
+  mkdir -p "$(dirname "$1")"
+  mv "$tmp" "$1"
+  chmod 644 "$1"
+  echo "Wrote $1"
+}
+
+# rebuild_initramfs rebuilds the initramfs of the running kernel.
+rebuild_initramfs() {
+  case "{{.Distro}}" in
+    ubuntu) update-initramfs -u ;;
+    *) dracut -f ;;
+  esac
+}
+`
+
+// taskScripts are the scripts of the tasks, appended to scriptPrelude.
+var taskScripts = map[string]string{
+	TaskRSCT: `
+case "{{.Distro}}" in
+  ubuntu) packages="rsct.core rsct.basic src devices.chrp.base.servicerm dynamicrm" ;;
+  *) packages="rsct.core rsct.basic src devices.chrp.base.ServiceRM DynamicRM" ;;
+esac
+
+if [ -n "$(missing_packages $packages)" ]; then
+  case "{{.Distro}}" in
+    rhel|sles)
+      if ! rpm -q ibm-power-repo >/dev/null 2>&1; then
+        if [ "{{.Distro}}" = sles ]; then
+          zypper --non-interactive --no-gpg-checks install '{{.ToolsRepoRPM}}'
+        elif command -v dnf >/dev/null 2>&1; then
+          dnf install -y '{{.ToolsRepoRPM}}'
+        else
+          yum install -y '{{.ToolsRepoRPM}}'
+        fi
+        # Accept the license of the IBM Power Tools and enable their repository.
+        echo y | /opt/ibm/lop/configure
+      fi ;;
+    ubuntu)
+{{- if .ToolsAptRepository}}
+      echo '{{.ToolsAptRepository}}' | write_file /etc/apt/sources.list.d/ibm-power-tools.list || :
+{{- end}}
+      ;;
+  esac
+fi
+install $packages
+
+# Start RMC and accept the connections of the management console, needed for DLPAR.
+if lssrc -s ctrmc 2>/dev/null | grep -q active; then
+  echo "RMC is active"
+else
+  /opt/rsct/bin/rmcctrl -A
+fi
+/opt/rsct/bin/rmcctrl -p
+`,
+
+	TaskCloudInit: `
+install cloud-init
+
+write_file /etc/cloud/cloud.cfg.d/99-powervs.cfg <<'POWERVS_EOF' || :
+# Written by the powervs Packer provisioner: PowerVS passes the user data on a config drive.
+datasource_list: [ {{join .CloudInitDatasources ", "}} ]
+POWERVS_EOF
+
+systemctl enable cloud-init-local.service cloud-init.service cloud-config.service cloud-final.service
+`,
+
+	TaskMultipath: `
+case "{{.Distro}}" in
+  rhel) install device-mapper-multipath ;;
+  *) install multipath-tools ;;
+esac
+
+changed=0
+if [ ! -f /etc/multipath.conf ]; then
+  write_file /etc/multipath.conf <<'POWERVS_EOF'
+defaults {
+    user_friendly_names yes
+    find_multipaths yes
+}
+POWERVS_EOF
+  changed=1
+fi
+if write_file /etc/multipath/conf.d/powervs.conf <<'POWERVS_EOF'
+{{.MultipathConfig}}
+POWERVS_EOF
+then
+  changed=1
+fi
+
+systemctl enable multipathd.service
+if [ "$changed" = 1 ]; then
+  systemctl reload-or-restart multipathd.service
+  # The root disk is multipathed from the initramfs on.
+  rebuild_initramfs
+fi
+`,
+
+	TaskIBMVETH: `
+install ethtool
+
+changed=0
+{{- if .IBMVETHModuleOptions}}
+if write_file /etc/modprobe.d/ibmveth.conf <<'POWERVS_EOF'
+options ibmveth {{.IBMVETHModuleOptions}}
+POWERVS_EOF
+then
+  changed=1
+fi
+{{- end}}
+
+write_file /etc/udev/rules.d/70-powervs-ibmveth.rules <<'POWERVS_EOF' || :
+# Written by the powervs Packer provisioner: enable the large send and receive offloads of ibmveth.
+ACTION=="add", SUBSYSTEM=="net", DRIVERS=="ibmveth", RUN+="/bin/sh -c 'ethtool -K $name tso on gro on'"
+POWERVS_EOF
+
+for dev in /sys/class/net/*; do
+  if [ "$(basename "$(readlink -f "$dev/device/driver")")" = ibmveth ]; then
+    ethtool -K "$(basename "$dev")" tso on gro on
+  fi
+done
+
+if [ "$changed" = 1 ]; then
+  # The module options apply from the next boot, ibmveth can be loaded from the initramfs.
+  rebuild_initramfs
+fi
+`,
+}
+
+// taskScript returns the script of a task for the distro family.
+func (p *Provisioner) taskScript(task, distro string) (string, error) {
+	script, ok := taskScripts[task]
+	if !ok {
+		return "", fmt.Errorf("unknown task %s", task)
+	}
+	tmpl, err := template.New(task).Funcs(template.FuncMap{"join": strings.Join}).Parse(scriptPrelude + script)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, map[string]interface{}{
+		"Distro":               distro,
+		"ToolsRepoRPM":         p.config.ToolsRepoRPM,
+		"ToolsAptRepository":   p.config.ToolsAptRepository,
+		"CloudInitDatasources": p.config.CloudInitDatasources,
+		"MultipathConfig":      strings.TrimRight(p.config.MultipathConfig, "\n"),
+		"IBMVETHModuleOptions": p.config.IBMVETHModuleOptions,
+	})
+	return buf.String(), err
+}